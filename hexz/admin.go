@@ -0,0 +1,286 @@
+package hexz
+
+// Admin console endpoints for operators.
+//
+// All endpoints are served behind basicAuthHandlerFunc and only act on the games
+// and players of this instance. Every action that changes state is counted
+// and logged together with the operator who requested it.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Snapshot of a game's internals, computed on the game master goroutine.
+type adminGameSnapshot struct {
+	state      GameState
+	move       int
+	board      *Board // Copy of the full board. Only set if requested.
+	players    []AdminPlayerInfo
+	spectators int
+}
+
+type ControlEventInspect struct {
+	withBoard bool
+	replyChan chan adminGameSnapshot
+}
+
+type ControlEventTerminate struct {
+	message string
+}
+
+type ControlEventKick struct {
+	playerId  string
+	replyChan chan bool // Receives true if the player was part of the game.
+}
+
+type ControlEventAnnounce struct {
+	message string
+}
+
+func (e ControlEventInspect) controlEventImpl()   {}
+func (e ControlEventTerminate) controlEventImpl() {}
+func (e ControlEventKick) controlEventImpl()      {}
+func (e ControlEventAnnounce) controlEventImpl()  {}
+
+// Returns a snapshot of the game's state. The snapshot includes a copy of the full
+// board if withBoard is true.
+func (g *GameHandle) inspect(withBoard bool) (adminGameSnapshot, error) {
+	ch := make(chan adminGameSnapshot)
+	if !g.sendEvent(ControlEventInspect{withBoard: withBoard, replyChan: ch}) {
+		return adminGameSnapshot{}, fmt.Errorf("game %s is over", g.id)
+	}
+	return <-ch, nil
+}
+
+// Removes the player from the game. Returns true if the player was part of it.
+func (g *GameHandle) kick(playerId string) bool {
+	ch := make(chan bool)
+	if !g.sendEvent(ControlEventKick{playerId: playerId, replyChan: ch}) {
+		return false
+	}
+	return <-ch
+}
+
+func (g *GameHandle) adminInfo(snapshot adminGameSnapshot) *AdminGameInfo {
+	return &AdminGameInfo{
+		GameInfo:     *g.info(true),
+		SinglePlayer: g.singlePlayer,
+		Private:      g.private,
+		State:        snapshot.state,
+		Move:         snapshot.move,
+		Players:      snapshot.players,
+		Spectators:   snapshot.spectators,
+	}
+}
+
+// Returns b with the internal state of its fields, for the admin's full board dump.
+func newAdminBoard(b *Board) *AdminBoard {
+	if b == nil {
+		return nil
+	}
+	fields := make([][]AdminField, len(b.Fields))
+	for i, row := range b.Fields {
+		fields[i] = make([]AdminField, len(row))
+		for j, f := range row {
+			fields[i][j] = AdminField{Field: f, Lifetime: f.Lifetime, NextVal: f.NextVal}
+		}
+	}
+	return &AdminBoard{Board: b, Fields: fields}
+}
+
+// Returns the name of the operator sending the request, for logging.
+// Operators are identified by their basic auth user name and their address.
+func operatorName(r *http.Request) string {
+	user, _, ok := r.BasicAuth()
+	if !ok || user == "" {
+		user = "anonymous"
+	}
+	return fmt.Sprintf("%s@%s", user, r.RemoteAddr)
+}
+
+// Counts and logs an operator's action.
+func (s *Server) logAdminAction(r *http.Request, action string, format string, args ...any) {
+	s.IncCounter("/admin/actions/" + action)
+	log.Printf("Admin %s: %s: %s", operatorName(r), action, fmt.Sprintf(format, args...))
+}
+
+// Returns all ongoing games of this instance, sorted by start time.
+func (s *Server) allGames() []*GameHandle {
+	s.ongoingGamesMut.Lock()
+	games := make([]*GameHandle, 0, len(s.ongoingGames))
+	for _, g := range s.ongoingGames {
+		games = append(games, g)
+	}
+	s.ongoingGamesMut.Unlock()
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].started.Before(games[j].started)
+	})
+	return games
+}
+
+func (s *Server) handleAdminGames(w http.ResponseWriter, r *http.Request) {
+	resp := AdminGameListResponse{Games: []*AdminGameInfo{}}
+	for _, g := range s.allGames() {
+		snapshot, err := g.inspect(false)
+		if err != nil {
+			continue // The game ended in the meantime.
+		}
+		resp.Games = append(resp.Games, g.adminInfo(snapshot))
+	}
+	s.logAdminAction(r, "games", "%d games", len(resp.Games))
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(resp); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
+
+// Sends a game's full internal board, including hidden fields. For debugging only.
+func (s *Server) handleAdminGame(w http.ResponseWriter, r *http.Request) {
+	gameId := path.Base(r.URL.Path)
+	game := s.lookupGame(gameId)
+	if game == nil {
+		http.Error(w, fmt.Sprintf("No game with ID %q", gameId), http.StatusNotFound)
+		return
+	}
+	snapshot, err := game.inspect(true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.logAdminAction(r, "inspect", "game %s", gameId)
+	resp := AdminGameResponse{
+		AdminGameInfo: *game.adminInfo(snapshot),
+		Board:         newAdminBoard(snapshot.board),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(resp); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
+
+// Ends a game. All players and spectators see the operator's message.
+func (s *Server) handleAdminTerminate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	var req AdminMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gameId := path.Base(r.URL.Path)
+	game := s.lookupGame(gameId)
+	if game == nil {
+		http.Error(w, fmt.Sprintf("No game with ID %q", gameId), http.StatusNotFound)
+		return
+	}
+	if !game.sendEvent(ControlEventTerminate{message: req.Message}) {
+		http.Error(w, fmt.Sprintf("Game %s is over", gameId), http.StatusNotFound)
+		return
+	}
+	s.logAdminAction(r, "terminate", "game %s: %q", gameId, req.Message)
+}
+
+// Removes a player from all games. The player's seat is freed and the game goes on,
+// waiting for another player to take the seat. The removed player can only watch
+// the game afterwards. /admin/logout/{playerId} also logs the player out.
+func (s *Server) handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	playerId := path.Base(r.URL.Path)
+	logout := strings.HasPrefix(r.URL.Path, "/admin/logout/")
+	resp := AdminKickResponse{Games: []string{}}
+	for _, g := range s.allGames() {
+		if g.kick(playerId) {
+			resp.Games = append(resp.Games, g.id)
+		}
+	}
+	if logout {
+		resp.LoggedOut = s.logoutPlayer(playerId)
+		s.logAdminAction(r, "logout", "player %s (logged out: %t, games: %v)", playerId, resp.LoggedOut, resp.Games)
+	} else {
+		s.logAdminAction(r, "kick", "player %s (games: %v)", playerId, resp.Games)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
+
+// Removes the player from the logged in players and the shared player store.
+// Returns false if the player was not logged in.
+func (s *Server) logoutPlayer(playerId string) bool {
+	s.loggedInPlayersMut.Lock()
+	_, ok := s.loggedInPlayers[playerId]
+	delete(s.loggedInPlayers, playerId)
+	s.loggedInPlayersMut.Unlock()
+	if s.playerStore != nil {
+		if err := s.playerStore.Delete(playerId); err != nil {
+			log.Printf("Cannot delete player %s from store: %s", playerId, err)
+		}
+	}
+	return ok
+}
+
+// Sends an announcement to all games of this instance.
+func (s *Server) handleAdminAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	var req AdminMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Message == "" {
+		http.Error(w, "Empty message", http.StatusBadRequest)
+		return
+	}
+	n := 0
+	for _, g := range s.allGames() {
+		if g.sendEvent(ControlEventAnnounce{message: req.Message}) {
+			n++
+		}
+	}
+	s.logAdminAction(r, "announce", "%d games: %q", n, req.Message)
+}
+
+// Returns (GET) or sets (POST) debug mode.
+func (s *Server) handleAdminDebug(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req AdminDebugMode
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.debugMode.Store(req.Enabled)
+		s.logAdminAction(r, "debug", "enabled: %t", req.Enabled)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(AdminDebugMode{Enabled: s.debugMode.Load()}); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
@@ -0,0 +1,167 @@
+package hexz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	s := NewServer(&ServerConfig{
+		DocumentRoot:      "./resources",
+		PlayerRemoveDelay: time.Minute,
+		LoginTtl:          time.Hour,
+		CompThinkTime:     time.Second,
+	})
+	srv := httptest.NewServer(s.createHandler())
+	defer srv.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.PostForm(srv.URL+"/hexz/login", url.Values{"name": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	resp, err = client.PostForm(srv.URL+"/hexz/new", url.Values{"type": {"Flagz"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	gameId := strings.TrimPrefix(resp.Header.Get("Location"), "/hexz/")
+	if s.lookupGame(gameId) == nil {
+		t.Fatalf("Game %q was not created", gameId)
+	}
+	getJSON := func(path string, v any) {
+		t.Helper()
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %s", path, resp.Status)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	post := func(path, body string) {
+		t.Helper()
+		resp, err := client.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s: %s", path, resp.Status)
+		}
+	}
+	var games AdminGameListResponse
+	getJSON("/admin/games", &games)
+	if len(games.Games) != 1 {
+		t.Fatalf("Want 1 game, got %d", len(games.Games))
+	}
+	if g := games.Games[0]; g.Id != gameId || g.OpenSeats != 2 || len(g.Players) != 0 {
+		t.Errorf("Unexpected game: %+v", *g)
+	}
+	var game AdminGameResponse
+	getJSON("/admin/game/"+gameId, &game)
+	if game.Board == nil || len(game.Board.Fields) == 0 {
+		t.Fatalf("Want full board, got %+v", game)
+	}
+	// The internal state of fields is included: rocks and grass live forever.
+	hasLifetime := false
+	for _, row := range game.Board.Fields {
+		for _, f := range row {
+			hasLifetime = hasLifetime || f.Lifetime == -1
+		}
+	}
+	if !hasLifetime {
+		t.Error("Want field lifetimes in full board")
+	}
+	post("/admin/debug", `{"enabled": true}`)
+	if !s.debugMode.Load() {
+		t.Error("Debug mode was not enabled")
+	}
+	post("/admin/announce", `{"message": "Maintenance in 5 minutes"}`)
+	post("/admin/terminate/"+gameId, `{"message": "Bye"}`)
+	for i := 0; i < 100 && s.lookupGame(gameId) != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.lookupGame(gameId) != nil {
+		t.Error("Game was not terminated")
+	}
+	if n := s.Counter("/admin/actions/terminate").Value(); n != 1 {
+		t.Errorf("Want 1 terminate action, got %d", n)
+	}
+	if n := s.Counter("/admin/actions/games").Value(); n != 1 {
+		t.Errorf("Want 1 games action, got %d", n)
+	}
+}
+
+func TestAdminKickFreesSeat(t *testing.T) {
+	s := NewServer(&ServerConfig{PlayerRemoveDelay: time.Minute, CompThinkTime: time.Second})
+	alice := Player{Id: "a1", Name: "alice"}
+	game, err := s.startNewGame(alice, gameTypeFlagz, gameOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	join := func(p Player) {
+		t.Helper()
+		ch, err := game.registerPlayer(p, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for range ch {
+			}
+		}()
+	}
+	seats := func() map[string]int {
+		t.Helper()
+		snapshot, err := game.inspect(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := make(map[string]int)
+		for _, p := range snapshot.players {
+			r[p.Name] = p.PlayerNum
+		}
+		return r
+	}
+	join(alice)
+	join(Player{Id: "b1", Name: "bob"})
+	w := httptest.NewRecorder()
+	s.handleAdminKick(w, httptest.NewRequest(http.MethodPost, "/admin/kick/a1", nil))
+	var resp AdminKickResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Games) != 1 || resp.Games[0] != game.id {
+		t.Errorf("Want alice removed from game %s, got %v", game.id, resp.Games)
+	}
+	// The game goes on with an open seat.
+	if got := seats(); len(got) != 1 || got["bob"] != 2 {
+		t.Errorf("Want only bob in seat 2, got %v", got)
+	}
+	if n := game.openSeats.Load(); n != 1 {
+		t.Errorf("Want 1 open seat, got %d", n)
+	}
+	// Alice can only watch, but carol can take her seat.
+	join(alice)
+	join(Player{Id: "c1", Name: "carol"})
+	if got := seats(); len(got) != 2 || got["carol"] != 1 || got["bob"] != 2 {
+		t.Errorf("Want carol in seat 1 and bob in seat 2, got %v", got)
+	}
+	game.sendEvent(ControlEventTerminate{})
+}
@@ -0,0 +1,277 @@
+package hexz
+
+// Position analysis ("hints") backed by MCTS.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Think time used if the client does not specify one.
+	defaultAnalyzeThinkTime = time.Duration(1) * time.Second
+	// Minimum time between two analyze requests of the same player.
+	analyzeRateLimit = time.Duration(10) * time.Second
+	// Maximum number of analyses running concurrently on the server.
+	maxConcurrentAnalyses = 4
+	// Maximum size of an analyze request. Full positions are only a few kB.
+	maxAnalyzeRequestBytes = 64 << 10
+)
+
+// Tracks when players last requested an analysis, to rate-limit hints.
+type analyzeLimiter struct {
+	lastRequest map[string]time.Time
+	sem         chan tok // Limits the number of concurrent analyses.
+	mut         sync.Mutex
+}
+
+func newAnalyzeLimiter(maxConcurrent int) *analyzeLimiter {
+	return &analyzeLimiter{
+		lastRequest: make(map[string]time.Time),
+		sem:         make(chan tok, maxConcurrent),
+	}
+}
+
+// Returns true if the player is allowed to run an analysis at time now,
+// and records the request in that case.
+func (l *analyzeLimiter) allow(playerId string, now time.Time, minInterval time.Duration) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if t, ok := l.lastRequest[playerId]; ok && now.Sub(t) < minInterval {
+		return false
+	}
+	// Opportunistically remove stale entries to keep the map small.
+	for pId, t := range l.lastRequest {
+		if now.Sub(t) >= minInterval {
+			delete(l.lastRequest, pId)
+		}
+	}
+	l.lastRequest[playerId] = now
+	return true
+}
+
+// Tries to acquire one of the analysis slots. Returns false if all are in use.
+func (l *analyzeLimiter) acquire() bool {
+	select {
+	case l.sem <- tok{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *analyzeLimiter) release() {
+	<-l.sem
+}
+
+// Snapshot of a game's engine, taken on the game master goroutine.
+type analyzeSnapshot struct {
+	ge  SinglePlayerGameEngine // nil if the game cannot be analyzed.
+	err error
+}
+
+// Creates a clone of the game engine for analysis on behalf of playerNum.
+// Fails if the game does not support analysis or if the board contains
+// any information hidden from the player.
+func snapshotForAnalysis(gameEngine GameEngine, playerNum int) analyzeSnapshot {
+	spge, ok := gameEngine.(SinglePlayerGameEngine)
+	if !ok {
+		return analyzeSnapshot{err: fmt.Errorf("game type %s does not support analysis", gameEngine.GameType())}
+	}
+	if spge.Board().State != Running {
+		return analyzeSnapshot{err: fmt.Errorf("game is not running")}
+	}
+	for _, f := range spge.Board().FlatFields {
+		if f.Hidden && f.Owner != playerNum {
+			return analyzeSnapshot{err: fmt.Errorf("board contains hidden fields")}
+		}
+	}
+	// The clone is used on a different goroutine, so it needs its own source.
+	return analyzeSnapshot{ge: spge.Clone(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Converts a client-provided board view into a Board.
+// The view must have the same shape as boards created by NewBoard.
+func boardFromView(v *BoardView) (*Board, error) {
+	b := NewBoard()
+	if len(v.Fields) != len(b.Fields) {
+		return nil, fmt.Errorf("wrong number of rows: %d", len(v.Fields))
+	}
+	for r := range b.Fields {
+		if len(v.Fields[r]) != len(b.Fields[r]) {
+			return nil, fmt.Errorf("wrong number of columns in row %d: %d", r, len(v.Fields[r]))
+		}
+		for c := range b.Fields[r] {
+			f := v.Fields[r][c]
+			if !f.Type.valid() || f.Owner < 0 || f.Owner > len(v.Score) {
+				return nil, fmt.Errorf("invalid field at (%d,%d)", r, c)
+			}
+			if f.Hidden {
+				return nil, fmt.Errorf("hidden fields are not supported")
+			}
+			b.Fields[r][c] = Field{Type: f.Type, Owner: f.Owner, Value: f.Value}
+			if b.Fields[r][c].occupied() {
+				b.Fields[r][c].Lifetime = -1
+			}
+		}
+	}
+	if v.Turn < 1 || v.Turn > len(v.Score) {
+		return nil, fmt.Errorf("invalid turn: %d", v.Turn)
+	}
+	if len(v.Resources) != len(v.Score) {
+		return nil, fmt.Errorf("need resources for each player")
+	}
+	b.Turn = v.Turn
+	b.Move = v.Move
+	b.Score = make([]int, len(v.Score))
+	copy(b.Score, v.Score)
+	b.Resources = make([]ResourceInfo, len(v.Resources))
+	copy(b.Resources, v.Resources)
+	b.State = Running
+	return b, nil
+}
+
+// Builds a game engine for a client-provided position. Only Flagz is supported.
+func engineFromPosition(gameType GameType, v *BoardView) (SinglePlayerGameEngine, error) {
+	if gameType != gameTypeFlagz {
+		return nil, fmt.Errorf("game type %q does not support analysis", gameType)
+	}
+	if len(v.Score) != 2 {
+		return nil, fmt.Errorf("need exactly two players")
+	}
+	b, err := boardFromView(v)
+	if err != nil {
+		return nil, err
+	}
+	// Positions the engine cannot play from would crash the search.
+	if err := checkFlagzPosition(b); err != nil {
+		return nil, err
+	}
+	ge := NewGameEngineFlagzFromBoard(b, rand.NewSource(time.Now().UnixNano()))
+	ge.recomputeState()
+	if ge.IsDone() {
+		return nil, fmt.Errorf("game is already finished")
+	}
+	return ge, nil
+}
+
+// Runs MCTS on ge and returns the candidate moves ranked by visit count.
+func analyzePosition(ge SinglePlayerGameEngine, thinkTime time.Duration) *AnalyzeResponse {
+	mcts := NewMCTS()
+	_, stats := mcts.SuggestMove(ge, thinkTime)
+	moves := make([]AnalyzeMove, len(stats.Moves))
+	for i, m := range stats.Moves {
+		moves[i] = AnalyzeMove{
+			Row:     m.row,
+			Col:     m.col,
+			Type:    m.cellType,
+			WinRate: m.Q,
+			Visits:  m.iterations,
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		if moves[i].Visits != moves[j].Visits {
+			return moves[i].Visits > moves[j].Visits
+		}
+		return moves[i].WinRate > moves[j].WinRate
+	})
+	return &AnalyzeResponse{
+		Turn:          ge.Board().Turn,
+		Move:          ge.Board().Move,
+		Moves:         moves,
+		Iterations:    stats.Iterations,
+		ElapsedMs:     stats.Elapsed.Milliseconds(),
+		FullyExplored: stats.FullyExplored,
+	}
+}
+
+func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	s.IncCounter("/requests/analyze/total")
+	p, err := s.validatePostRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAnalyzeRequestBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req AnalyzeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if proxy := s.peerProxyFor(req.GameId); proxy != nil && r.Header.Get(forwardedByHeader) == "" {
+		// The game is hosted by a peer instance.
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.forward(proxy, w, r)
+		return
+	}
+	thinkTime := time.Duration(req.ThinkTimeMs) * time.Millisecond
+	if thinkTime <= 0 {
+		thinkTime = defaultAnalyzeThinkTime
+	}
+	if thinkTime > s.live().compThinkTime {
+		thinkTime = s.live().compThinkTime
+	}
+	var ge SinglePlayerGameEngine
+	if req.GameId != "" {
+		game := s.lookupGame(req.GameId)
+		if game == nil {
+			http.Error(w, fmt.Sprintf("No game with ID %q", req.GameId), http.StatusNotFound)
+			return
+		}
+		if !game.singlePlayer && !s.debugMode.Load() {
+			// Hints in games between humans would be cheating.
+			http.Error(w, "Analysis is only available in single player games", http.StatusForbidden)
+			return
+		}
+		snapshot, err := game.analyzeSnapshot(p.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		ge = snapshot
+	} else if req.Board != nil {
+		ge, err = engineFromPosition(req.GameType, req.Board)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		http.Error(w, "Need either gameId or board", http.StatusBadRequest)
+		return
+	}
+	if !s.analyzeLimiter.allow(p.Id, time.Now(), analyzeRateLimit) {
+		s.IncCounter("/requests/analyze/rate_limited")
+		http.Error(w, "Too many analysis requests", http.StatusTooManyRequests)
+		return
+	}
+	if !s.analyzeLimiter.acquire() {
+		s.IncCounter("/requests/analyze/overloaded")
+		http.Error(w, "Server is busy, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.analyzeLimiter.release()
+	resp := analyzePosition(ge, thinkTime)
+	s.IncCounter("/requests/analyze/success")
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
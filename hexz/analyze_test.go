@@ -0,0 +1,158 @@
+package hexz
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeLimiter(t *testing.T) {
+	l := newAnalyzeLimiter(1)
+	now := time.Now()
+	if !l.allow("p1", now, time.Second) {
+		t.Error("First request should be allowed")
+	}
+	if l.allow("p1", now.Add(500*time.Millisecond), time.Second) {
+		t.Error("Second request within interval should be rejected")
+	}
+	if !l.allow("p2", now.Add(500*time.Millisecond), time.Second) {
+		t.Error("Request of a different player should be allowed")
+	}
+	if !l.allow("p1", now.Add(time.Second), time.Second) {
+		t.Error("Request after interval should be allowed")
+	}
+	if !l.acquire() {
+		t.Error("Should acquire free slot")
+	}
+	if l.acquire() {
+		t.Error("Should not acquire slot when all are in use")
+	}
+	l.release()
+	if !l.acquire() {
+		t.Error("Should acquire released slot")
+	}
+}
+
+func TestEngineFromPosition(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(123))
+	for i := 0; i < 10; i++ {
+		m, err := ge.RandomMove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ge.MakeMove(m)
+	}
+	view := ge.Board().ViewFor(0)
+	ge2, err := engineFromPosition(gameTypeFlagz, view)
+	if err != nil {
+		t.Fatalf("Cannot create engine from position: %s", err)
+	}
+	g := ge2.(*GameEngineFlagz)
+	if g.FreeCells != ge.FreeCells || g.NormalMoves != ge.NormalMoves {
+		t.Errorf("Derived state differs: want (%d, %v), got (%d, %v)",
+			ge.FreeCells, ge.NormalMoves, g.FreeCells, g.NormalMoves)
+	}
+	if _, err := engineFromPosition(gameTypeClassic, view); err == nil {
+		t.Error("Expected error for Classic game")
+	}
+	view.Fields = view.Fields[1:]
+	if _, err := engineFromPosition(gameTypeFlagz, view); err == nil {
+		t.Error("Expected error for wrong board shape")
+	}
+}
+
+func TestAnalyzePositionRanksMoves(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(123))
+	resp := analyzePosition(ge, time.Duration(50)*time.Millisecond)
+	if len(resp.Moves) == 0 {
+		t.Fatal("No moves returned")
+	}
+	for i := 1; i < len(resp.Moves); i++ {
+		if resp.Moves[i-1].Visits < resp.Moves[i].Visits {
+			t.Errorf("Moves not ranked by visits at %d: %d < %d", i, resp.Moves[i-1].Visits, resp.Moves[i].Visits)
+		}
+	}
+	if resp.Turn != 1 {
+		t.Errorf("Want turn 1, got %d", resp.Turn)
+	}
+}
+
+func TestHandleAnalyzeRejectsInvalidPositions(t *testing.T) {
+	s := NewServer(&ServerConfig{CompThinkTime: time.Second})
+	s.loginPlayer("p1", "alice")
+	post := func(v *BoardView) *httptest.ResponseRecorder {
+		body, err := json.Marshal(AnalyzeRequest{GameType: gameTypeFlagz, Board: v, ThinkTimeMs: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/hexz/analyze", bytes.NewReader(body))
+		r.AddCookie(&http.Cookie{Name: playerIdCookieName, Value: "p1"})
+		w := httptest.NewRecorder()
+		s.handleAnalyze(w, r)
+		return w
+	}
+	position := func() *BoardView {
+		ge := NewGameEngineFlagz(rand.NewSource(1))
+		for i := 0; i < 6; i++ {
+			m, _ := ge.RandomMove()
+			ge.MakeMove(m)
+		}
+		return ge.Board().ViewFor(0)
+	}
+	owned := func(v *BoardView) *Field {
+		for r := range v.Fields {
+			for c := range v.Fields[r] {
+				if f := &v.Fields[r][c]; f.Type == cellNormal && f.Owner > 0 {
+					return f
+				}
+			}
+		}
+		t.Fatal("No owned cell")
+		return nil
+	}
+	tests := []struct {
+		name    string
+		corrupt func(v *BoardView)
+	}{
+		{"no normal pieces", func(v *BoardView) {
+			v.Resources[0].NumPieces[cellNormal] = 0
+			owned(v).Value = 200
+		}},
+		{"value too large", func(v *BoardView) { owned(v).Value = flagzMaxValue + 1 }},
+		{"too many flags", func(v *BoardView) { v.Resources[1].NumPieces[cellFlag] = flagzNumFlags + 1 }},
+		{"fire pieces", func(v *BoardView) { v.Resources[0].NumPieces[cellFire] = 1 }},
+		{"owned grass", func(v *BoardView) { v.Fields[0][0] = Field{Type: cellGrass, Owner: 1, Value: 1} }},
+		{"dead cell", func(v *BoardView) { v.Fields[0][0] = Field{Type: cellDead} }},
+	}
+	for _, test := range tests {
+		v := position()
+		test.corrupt(v)
+		if w := post(v); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", test.name, http.StatusBadRequest, w.Code)
+		}
+	}
+	if w := post(position()); w.Code != http.StatusOK {
+		t.Errorf("Valid position: want status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if n := len(s.analyzeLimiter.sem); n != 0 {
+		t.Errorf("%d analysis slots were not released", n)
+	}
+}
+
+func TestHandleAnalyzeRejectsLargeRequests(t *testing.T) {
+	s := NewServer(&ServerConfig{CompThinkTime: time.Second})
+	s.loginPlayer("p1", "alice")
+	body := `{"gameType": "Flagz", "gameId": "` + strings.Repeat("x", maxAnalyzeRequestBytes) + `"}`
+	r := httptest.NewRequest(http.MethodPost, "/hexz/analyze", strings.NewReader(body))
+	r.AddCookie(&http.Cookie{Name: playerIdCookieName, Value: "p1"})
+	w := httptest.NewRecorder()
+	s.handleAnalyze(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Want status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package hexz
+
+// Rendering of structured announcements for clients that do not render them themselves.
+
+import (
+	"html"
+	"strings"
+)
+
+// English HTML templates of announcements. {param} is replaced by the escaped parameter.
+var announcementTemplates = map[AnnouncementCode]string{
+	announcePlayerJoined:    "Welcome {name}!",
+	announceGameBegins:      "The game begins!",
+	announceGameWon:         "&#127942; &#127942; &#127942; {winner} won &#127942; &#127942; &#127942;",
+	announceCpuConfidence:   "CPU confidence: {confidence}",
+	announceGameReset:       "Player {name} restarted the game.",
+	announcePlayerLeft:      "Player {name} left the game &#128546;. Game over.",
+	announcePlayerRemoved:   "Player {name} was removed by an operator. Their seat is open for another player.",
+	announceGameTerminated:  "The game was ended by an operator. Game over.",
+	announceOperatorMessage: "{message}",
+}
+
+// Creates an announcement with the given code. params are key/value pairs.
+func newAnnouncement(code AnnouncementCode, params ...string) Announcement {
+	a := Announcement{Code: code}
+	if len(params) > 0 {
+		a.Params = make(map[string]string, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			a.Params[params[i]] = params[i+1]
+		}
+	}
+	a.Text = a.render()
+	return a
+}
+
+// Returns the English HTML text of a, with all parameters escaped.
+func (a *Announcement) render() string {
+	tmpl, ok := announcementTemplates[a.Code]
+	if !ok {
+		return html.EscapeString(string(a.Code))
+	}
+	replacements := make([]string, 0, 2*len(a.Params))
+	for k, v := range a.Params {
+		replacements = append(replacements, "{"+k+"}", html.EscapeString(v))
+	}
+	return strings.NewReplacer(replacements...).Replace(tmpl)
+}
+
+// Adds announcements to e, both structured and as pre-rendered text.
+func (e *ServerEvent) announce(as ...Announcement) {
+	for _, a := range as {
+		e.AnnouncementEvents = append(e.AnnouncementEvents, a)
+		e.Announcements = append(e.Announcements, a.Text)
+	}
+}
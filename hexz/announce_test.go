@@ -0,0 +1,39 @@
+package hexz
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAnnouncementEscapesParams(t *testing.T) {
+	a := newAnnouncement(announceOperatorMessage, "message", `<script>alert("hi")</script>`)
+	want := "&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;"
+	if a.Text != want {
+		t.Errorf("Want escaped text %q, got %q", want, a.Text)
+	}
+	if a.Params["message"] != `<script>alert("hi")</script>` {
+		t.Errorf("Params must be sent unescaped, got %q", a.Params["message"])
+	}
+}
+
+func TestServerEventAnnounce(t *testing.T) {
+	var e ServerEvent
+	e.announce(newAnnouncement(announcePlayerJoined, "name", "alice"), newAnnouncement(announceGameBegins))
+	if len(e.Announcements) != 2 || e.Announcements[0] != "Welcome alice!" || e.Announcements[1] != "The game begins!" {
+		t.Errorf("Unexpected text announcements: %q", e.Announcements)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		AnnouncementEvents []Announcement `json:"announcementEvents"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.AnnouncementEvents) != 2 || got.AnnouncementEvents[0].Code != announcePlayerJoined ||
+		got.AnnouncementEvents[0].Params["name"] != "alice" {
+		t.Errorf("Unexpected structured announcements: %+v", got.AnnouncementEvents)
+	}
+}
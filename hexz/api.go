@@ -15,12 +15,60 @@ const (
 type ServerEvent struct {
 	Timestamp     string     `json:"timestamp"`
 	Board         *BoardView `json:"board"`
-	Role          int        `json:"role"` // 0: spectator, 1, 2: players
+	Role          int        `json:"role"` // 0: spectator, 1, 2, ...: players
 	PlayerNames   []string   `json:"playerNames"`
-	Announcements []string   `json:"announcements"`
+	Announcements []string   `json:"announcements"` // Pre-rendered English HTML of AnnouncementEvents, for old clients.
 	DebugMessage  string     `json:"debugMessage"`
 	Winner        int        `json:"winner,omitempty"` // Number of the player that wins. 0 if no winner yet or draw.
 	LastEvent     bool       `json:"lastEvent"`        // Signals to clients that this is the last event they will receive.
+	// Announcements for clients to render and localize.
+	AnnouncementEvents []Announcement `json:"announcementEvents,omitempty"`
+	// Only used for clients that opted into delta updates:
+	BoardVersion int         `json:"boardVersion,omitempty"` // Version of the client's board after applying this event.
+	Delta        *BoardDelta `json:"delta,omitempty"`        // Changes to the board of version BoardVersion-1. Board is nil if set.
+	Resync       bool        `json:"resync,omitempty"`       // Board holds the full board, which replaces the client's board.
+	// If true, the full board is sent even to clients that opted into delta updates.
+	resync bool
+}
+
+// Codes of structured announcements. The comments list the parameters of each code.
+type AnnouncementCode string
+
+const (
+	announcePlayerJoined    AnnouncementCode = "player_joined"    // name
+	announceGameBegins      AnnouncementCode = "game_begins"      // (none)
+	announceGameWon         AnnouncementCode = "game_won"         // winner
+	announceCpuConfidence   AnnouncementCode = "cpu_confidence"   // confidence
+	announceGameReset       AnnouncementCode = "game_reset"       // name
+	announcePlayerLeft      AnnouncementCode = "player_left"      // name
+	announcePlayerRemoved   AnnouncementCode = "player_removed"   // name
+	announceGameTerminated  AnnouncementCode = "game_terminated"  // (none)
+	announceOperatorMessage AnnouncementCode = "operator_message" // message
+)
+
+// A structured announcement. Clients render it based on its code and parameters,
+// which are plain text and must be escaped before being used in HTML.
+type Announcement struct {
+	Code   AnnouncementCode  `json:"code"`
+	Params map[string]string `json:"params,omitempty"`
+	Text   string            `json:"text"` // English HTML rendering with escaped parameters.
+}
+
+// Changes to a BoardView. Turn, score and resources are always sent in full.
+type BoardDelta struct {
+	BaseVersion int            `json:"baseVersion"` // Version of the board the changes apply to.
+	Turn        int            `json:"turn"`
+	Move        int            `json:"move"`
+	State       GameState      `json:"state"`
+	Score       []int          `json:"score"`
+	Resources   []ResourceInfo `json:"resources"`
+	Fields      []FieldUpdate  `json:"fields"` // Changed fields only.
+}
+
+type FieldUpdate struct {
+	Row   int   `json:"row"`
+	Col   int   `json:"col"`
+	Field Field `json:"field"`
 }
 
 // A player's or spectator's view of the board.
@@ -30,20 +78,29 @@ type BoardView struct {
 	Move        int            `json:"move"`
 	Fields      [][]Field      `json:"fields"` // The board's fields.
 	PlayerNames []string       `json:"playerNames"`
-	Score       []int          `json:"score"` // Depending on the number of players, 1 or 2 elements.
+	Score       []int          `json:"score"` // One element per player.
 	Resources   []ResourceInfo `json:"resources"`
 	State       GameState      `json:"state"`
+	// Colors in which the UI draws each player's cells. Player i uses PlayerColors[i-1].
+	PlayerColors []PlayerColors `json:"playerColors"`
+}
+
+// Colors of a player's cells, as CSS color strings.
+type PlayerColors struct {
+	Cell   string `json:"cell"`   // Color of the player's visible cells.
+	Hidden string `json:"hidden"` // Color of the player's hidden cells and of cells only the player can still occupy.
+	Icon   string `json:"icon"`   // Color of icons drawn on the player's cells.
 }
 
 type Field struct {
-	Type    CellType `json:"type"`
-	Owner   int      `json:"owner"` // Player number owning this field. 0 for unowned fields.
-	Hidden  bool     `json:"hidden,omitempty"`
-	Value   int      `json:"v"`                 // Some games assign different values to cells.
-	Blocked [2]bool  `json:"blocked,omitempty"` // Indicates which players this field is blocked for.
+	Type    CellType         `json:"type"`
+	Owner   int              `json:"owner"` // Player number owning this field. 0 for unowned fields.
+	Hidden  bool             `json:"hidden,omitempty"`
+	Value   int              `json:"v"`                 // Some games assign different values to cells.
+	Blocked [maxPlayers]bool `json:"blocked,omitempty"` // Indicates which players this field is blocked for.
 	// Internal fields, not exported in JSON
-	Lifetime int    `json:"-"` // Moves left until this cell gets cleared. -1 means infinity.
-	NextVal  [2]int `json:"-"` // If this cell would be occupied, what value would it have? (For Flagz)
+	Lifetime int             `json:"-"` // Moves left until this cell gets cleared. -1 means infinity.
+	NextVal  [maxPlayers]int `json:"-"` // If this cell would be occupied, what value would it have? (For Flagz)
 }
 
 // Information about the resources each player has left.
@@ -80,6 +137,31 @@ type MoveRequest struct {
 	Type CellType `json:"type"`
 }
 
+// Request to analyze a position. Either GameId or Board (with GameType) must be set.
+type AnalyzeRequest struct {
+	GameId      string     `json:"gameId,omitempty"`
+	GameType    GameType   `json:"gameType,omitempty"`
+	Board       *BoardView `json:"board,omitempty"`
+	ThinkTimeMs int        `json:"thinkTimeMs"` // Time budget for the analysis. Capped by the server.
+}
+
+type AnalyzeMove struct {
+	Row     int      `json:"row"`
+	Col     int      `json:"col"`
+	Type    CellType `json:"type"`
+	WinRate float64  `json:"winRate"` // Estimated probability that the player to move wins after this move.
+	Visits  int      `json:"visits"`
+}
+
+type AnalyzeResponse struct {
+	Turn          int           `json:"turn"` // The player to move in the analyzed position.
+	Move          int           `json:"move"`
+	Moves         []AnalyzeMove `json:"moves"` // Candidate moves, best first.
+	Iterations    int           `json:"iterations"`
+	ElapsedMs     int64         `json:"elapsedMs"`
+	FullyExplored bool          `json:"fullyExplored"`
+}
+
 type ResetRequest struct {
 	Message string `json:"message"`
 }
@@ -95,9 +177,29 @@ type StatuszDistribBucket struct {
 	Count int64   `json:"count"`
 }
 
+// Summary statistics of a distribution. Quantiles are estimated from the buckets.
+// All values are 0 if Count is 0.
+type StatuszDistribSummary struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// Summary of the values added during the last Window ("1m", "10m", "1h").
+type StatuszDistribWindow struct {
+	Window string `json:"window"`
+	StatuszDistribSummary
+}
+
 type StatuszDistrib struct {
-	Name    string                 `json:"name"`
+	Name string `json:"name"`
+	StatuszDistribSummary
 	Buckets []StatuszDistribBucket `json:"buckets"`
+	Windows []StatuszDistribWindow `json:"windows"`
 }
 
 type StatuszResponse struct {
@@ -112,8 +214,142 @@ type StatuszResponse struct {
 
 // Used in responses to list active games (/hexz/gamez).
 type GameInfo struct {
-	Id       string    `json:"id"`
-	Host     string    `json:"host"`
-	Started  time.Time `json:"started"`
-	GameType GameType  `json:"gameType"`
+	Id        string    `json:"id"`
+	Host      string    `json:"host"`
+	Started   time.Time `json:"started"`
+	GameType  GameType  `json:"gameType"`
+	OpenSeats int       `json:"openSeats"`
+	// Only set for finished games, for operators, and in debug mode,
+	// since the CPU player's moves can be predicted from its seed.
+	Seeds *GameSeeds `json:"seeds,omitempty"`
+	// Number of players chosen by the host. 0 if the game type's default is used.
+	NumPlayers int `json:"numPlayers,omitempty"`
+	// Name of the level the game was started from. Empty for random layouts.
+	Level string `json:"level,omitempty"`
+	// Difficulty of the CPU player. Only set for single player games.
+	Difficulty string `json:"difficulty,omitempty"`
+}
+
+// Summary of a Flagz level, as listed by /hexz/levels.
+type LevelInfo struct {
+	Name      string `json:"name"`
+	FreeCells int    `json:"freeCells"`
+}
+
+// Response to /hexz/levels.
+type LevelListResponse struct {
+	Levels []LevelInfo `json:"levels"`
+}
+
+// A value a game option can take.
+type GameOptionChoice struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// An option of new games, sent as a form value named Name to /hexz/new.
+type GameOption struct {
+	Name    string             `json:"name"`
+	Label   string             `json:"label"`
+	Choices []GameOptionChoice `json:"choices"`
+	Default string             `json:"default,omitempty"`
+	// If true, the option only applies to games against the computer.
+	SinglePlayerOnly bool `json:"singlePlayerOnly,omitempty"`
+}
+
+// A game type and its options, as listed by /hexz/gametypes.
+type GameTypeInfo struct {
+	Type           GameType     `json:"type"`
+	DisplayText    string       `json:"displayText"` // Name shown to players, including an icon.
+	MinPlayers     int          `json:"minPlayers"`
+	MaxPlayers     int          `json:"maxPlayers"`
+	DefaultPlayers int          `json:"defaultPlayers"`
+	SinglePlayer   bool         `json:"singlePlayer"` // True if the game can be played against the computer.
+	Options        []GameOption `json:"options,omitempty"`
+}
+
+// Response to /hexz/gametypes.
+type GameTypeListResponse struct {
+	GameTypes []GameTypeInfo `json:"gameTypes"`
+}
+
+// Response to /hexz/levels/validate.
+type ValidateLevelResponse struct {
+	Valid     bool   `json:"valid"`
+	Error     string `json:"error,omitempty"` // Reason why the level is invalid.
+	FreeCells int    `json:"freeCells,omitempty"`
+}
+
+// Seeds of the random number generators used by a game. A game started with the
+// same seeds has the same initial layout. If the CPU player's iteration budget
+// is fixed as well, its moves are also the same, given the same human moves.
+type GameSeeds struct {
+	Engine int64 `json:"engine"`
+	Cpu    int64 `json:"cpu"`
+}
+
+// Response to /hexz/gamez. Games holds one page of the matching games.
+type GameListResponse struct {
+	Games  []*GameInfo `json:"games"`
+	Total  int         `json:"total"` // Total number of matching games.
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+// Used by operators in POST requests to /admin/terminate/{gameId} and /admin/announce.
+type AdminMessageRequest struct {
+	Message string `json:"message"`
+}
+
+// Used by operators to query (GET) and set (POST) debug mode via /admin/debug.
+type AdminDebugMode struct {
+	Enabled bool `json:"enabled"`
+}
+
+type AdminPlayerInfo struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	PlayerNum int    `json:"playerNum"`
+	Connected bool   `json:"connected"`
+}
+
+// Game details only visible to operators.
+type AdminGameInfo struct {
+	GameInfo
+	SinglePlayer bool              `json:"singlePlayer"`
+	Private      bool              `json:"private"`
+	State        GameState         `json:"state"`
+	Move         int               `json:"move"`
+	Players      []AdminPlayerInfo `json:"players"`
+	Spectators   int               `json:"spectators"`
+}
+
+// Response to /admin/games.
+type AdminGameListResponse struct {
+	Games []*AdminGameInfo `json:"games"`
+}
+
+// A field including the internal state that is not exported in Field's JSON.
+type AdminField struct {
+	Field
+	Lifetime int             `json:"lifetime"`
+	NextVal  [maxPlayers]int `json:"nextVal"`
+}
+
+// The full board, including the internal state of all fields.
+type AdminBoard struct {
+	*Board
+	Fields [][]AdminField // Replaces the Fields of the embedded Board.
+}
+
+// Response to /admin/game/{gameId}. Contains the full, unfiltered board.
+type AdminGameResponse struct {
+	AdminGameInfo
+	Board *AdminBoard `json:"board"`
+}
+
+// Response to /admin/kick/{playerId} and /admin/logout/{playerId}.
+type AdminKickResponse struct {
+	Games     []string `json:"games"` // IDs of the games the player was removed from.
+	LoggedOut bool     `json:"loggedOut"`
 }
@@ -4,6 +4,25 @@ package hexz
 // The "classic" hexz game
 //
 
+import "math/rand"
+
+func init() {
+	registerGameType(&GameTypeDescriptor{
+		GameTypeInfo: GameTypeInfo{
+			Type:           gameTypeClassic,
+			DisplayText:    "\U0001F3B9 Classic",
+			MinPlayers:     2,
+			MaxPlayers:     2,
+			DefaultPlayers: 2,
+		},
+		NewEngine: func(numPlayers int, src rand.Source) GameEngine {
+			g := &GameEngineClassic{}
+			g.Init()
+			return g
+		},
+	})
+}
+
 type GameEngineClassic struct {
 	board *Board
 }
@@ -80,16 +99,29 @@ func (g *GameEngineClassic) recomputeScoreAndState() {
 	}
 }
 
-func (g *GameEngineClassic) floodFill(x idx, cb func(idx) bool) {
+func (g *GameEngineClassic) Validate() error {
 	b := g.board
-	var ns [6]idx
-	if !cb(x) {
-		return
+	var v validationErrors
+	v.checkBoard(b, 2)
+	score := make([]int, 2)
+	openCells := 0
+	for _, f := range b.FlatFields {
+		if f.Owner > 0 && f.Owner <= 2 && !f.Hidden {
+			score[f.Owner-1]++
+		}
+		if !f.occupied() {
+			openCells++
+		}
 	}
-	n := b.neighbors(x, ns[:])
-	for i := 0; i < n; i++ {
-		g.floodFill(ns[i], cb)
+	for i := range score {
+		if i < len(b.Score) && b.Score[i] != score[i] {
+			v.addf("P%d has score %d, want %d", i+1, b.Score[i], score[i])
+		}
 	}
+	if (openCells == 0) != (b.State == Finished) {
+		v.addf("game is %s with %d open cells", b.State, openCells)
+	}
+	return v.err()
 }
 
 func (g *GameEngineClassic) lifetime(c CellType) int {
@@ -120,9 +152,9 @@ func (g *GameEngineClassic) occupyFields(playerNum, r, c int, ct CellType) int {
 	f.Hidden = true
 	f.Lifetime = g.lifetime(ct)
 	var areas [6]struct {
-		size      int    // Number of free cells in the area
-		flags     [2]int // Number of flags along the boundary
-		deadCells int    // Number of dead cells along the boundary
+		size      int             // Number of free cells in the area
+		flags     [maxPlayers]int // Number of flags per player along the boundary
+		deadCells int             // Number of dead cells along the boundary
 	}
 	// If the current move sets a flag, this flag counts in all directions.
 	if ct == cellFlag {
@@ -138,7 +170,7 @@ func (g *GameEngineClassic) occupyFields(playerNum, r, c int, ct CellType) int {
 			// k's area is the same area as k-c for some c.
 			continue
 		}
-		g.floodFill(ns[k], func(x idx) bool {
+		b.floodFill(ns[k], func(x idx) bool {
 			if ms[x.r][x.c] == k {
 				// Already seen in this iteration.
 				return false
@@ -178,8 +210,10 @@ func (g *GameEngineClassic) occupyFields(playerNum, r, c int, ct CellType) int {
 	if numAreas > 1 {
 		// Now assign fields to player with most flags, or to current player on a tie.
 		occupator := playerNum
-		if areas[minK].flags[2-playerNum] > areas[minK].flags[playerNum-1] {
-			occupator = 3 - playerNum // The other player has more flags
+		for p, n := range areas[minK].flags {
+			if n > areas[minK].flags[occupator-1] {
+				occupator = p + 1 // Another player has more flags
+			}
 		}
 		for r := 0; r < len(b.Fields); r++ {
 			for c := 0; c < len(b.Fields[r]); c++ {
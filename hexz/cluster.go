@@ -0,0 +1,304 @@
+package hexz
+
+// Support for running multiple server instances behind one address.
+//
+// Each game is owned by the instance that created it. The owner's instance ID
+// is encoded as a prefix of the game ID ("A-XYZUVW"). Requests for games owned
+// by a peer instance are forwarded to that peer. Logged in players are kept in
+// a PlayerStore shared by all instances, so any instance can identify a player
+// from their cookie.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Header set on requests forwarded to a peer instance. Used to avoid forwarding loops.
+	forwardedByHeader = "X-Hexz-Forwarded-By"
+	// Separates the instance ID from the rest of the game ID.
+	gameIdInstanceSep = "-"
+)
+
+var (
+	instanceIdRegexp = regexp.MustCompile(`^[A-Z0-9]{1,8}$`)
+	playerIdRegexp   = regexp.MustCompile(`^[a-f0-9]{32}$`)
+
+	errPlayerNotFound = errors.New("player not found")
+)
+
+// Persistent storage for logged in players that can be shared between instances.
+type PlayerStore interface {
+	// Returns errPlayerNotFound if no player with the given ID exists.
+	Load(playerId string) (*Player, error)
+	Save(p *Player) error
+	Delete(playerId string) error
+}
+
+// A PlayerStore that keeps one JSON file per player in a directory.
+// Several instances can share the directory, e.g. on the same machine or via NFS.
+type fileSystemPlayerStore struct {
+	dir string
+}
+
+func NewFileSystemPlayerStore(dir string) (PlayerStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create player store directory: %w", err)
+	}
+	return &fileSystemPlayerStore{dir: dir}, nil
+}
+
+func (s *fileSystemPlayerStore) filename(playerId string) (string, error) {
+	// Player IDs end up in file names, so be strict about what we accept.
+	if !playerIdRegexp.MatchString(playerId) {
+		return "", fmt.Errorf("invalid player ID: %q", playerId)
+	}
+	return path.Join(s.dir, playerId+".json"), nil
+}
+
+func (s *fileSystemPlayerStore) Load(playerId string) (*Player, error) {
+	fn, err := s.filename(playerId)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(fn)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errPlayerNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	p := &Player{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *fileSystemPlayerStore) Save(p *Player) error {
+	fn, err := s.filename(p.Id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	// Write to a temp file first and rename it, so readers never see partial files.
+	tmp, err := os.CreateTemp(s.dir, p.Id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fn)
+}
+
+func (s *fileSystemPlayerStore) Delete(playerId string) error {
+	fn, err := s.filename(playerId)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fn); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Parses a comma-separated list of peers of the form "A=http://host1:8084,B=http://host2:8084".
+func ParsePeers(spec string) (map[string]string, error) {
+	peers := make(map[string]string)
+	if strings.TrimSpace(spec) == "" {
+		return peers, nil
+	}
+	for _, p := range strings.Split(spec, ",") {
+		id, addr, found := strings.Cut(strings.TrimSpace(p), "=")
+		if !found || !instanceIdRegexp.MatchString(id) {
+			return nil, fmt.Errorf("invalid peer %q: must be <INSTANCE_ID>=<URL>", p)
+		}
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL for peer %s: %q", id, addr)
+		}
+		peers[id] = addr
+	}
+	return peers, nil
+}
+
+func isValidInstanceId(id string) bool {
+	return instanceIdRegexp.MatchString(id)
+}
+
+// Checks that the multi-instance settings of cfg are consistent.
+func ValidateClusterConfig(cfg *ServerConfig) error {
+	if cfg.InstanceId != "" && !isValidInstanceId(cfg.InstanceId) {
+		return fmt.Errorf("instance ID must consist of 1-8 uppercase letters or digits")
+	}
+	if len(cfg.Peers) == 0 {
+		return nil
+	}
+	if cfg.InstanceId == "" {
+		return fmt.Errorf("an instance ID is required when peers are configured")
+	}
+	if cfg.PlayerStoreDir == "" {
+		return fmt.Errorf("a shared player store is required when peers are configured")
+	}
+	return nil
+}
+
+// Returns the ID of the instance owning the game, or "" if the ID has no instance prefix.
+func instanceFromGameId(gameId string) string {
+	id, _, found := strings.Cut(gameId, gameIdInstanceSep)
+	if !found {
+		return ""
+	}
+	return id
+}
+
+// Prefixes the game ID with this instance's ID, if one is configured.
+func (s *Server) qualifyGameId(id string) string {
+	if s.config.InstanceId == "" {
+		return id
+	}
+	return s.config.InstanceId + gameIdInstanceSep + id
+}
+
+// Returns the proxy for the peer owning gameId, or nil if the game is (or would be) owned by this instance.
+func (s *Server) peerProxyFor(gameId string) *httputil.ReverseProxy {
+	owner := instanceFromGameId(gameId)
+	if owner == "" || owner == s.config.InstanceId {
+		return nil
+	}
+	return s.peerProxies[owner]
+}
+
+func newPeerProxies(peers map[string]string) map[string]*httputil.ReverseProxy {
+	proxies := make(map[string]*httputil.ReverseProxy)
+	for id, addr := range peers {
+		u, err := url.Parse(addr)
+		if err != nil {
+			// Peers should have been validated by ParsePeers already.
+			log.Printf("Ignoring peer %s with invalid URL %q", id, addr)
+			continue
+		}
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		proxy.FlushInterval = -1 // Flush immediately, required for SSE.
+		proxies[id] = proxy
+	}
+	return proxies
+}
+
+// Forwards requests for games owned by peer instances.
+// Requests that were already forwarded once are never forwarded again.
+func (s *Server) routingHandler(h http.Handler) http.Handler {
+	if len(s.peerProxies) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/hexz/") || r.Header.Get(forwardedByHeader) != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		proxy := s.peerProxyFor(gameIdFromPath(r.URL.Path))
+		if proxy == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		s.forward(proxy, w, r)
+	})
+}
+
+func (s *Server) forward(proxy *httputil.ReverseProxy, w http.ResponseWriter, r *http.Request) {
+	s.IncCounter("/cluster/forwarded")
+	r.Header.Set(forwardedByHeader, s.config.InstanceId)
+	proxy.ServeHTTP(w, r)
+}
+
+// Returns true if r was sent or forwarded by one of the configured peers.
+func (s *Server) isPeerRequest(r *http.Request) bool {
+	id := r.Header.Get(forwardedByHeader)
+	if id == "" || id == s.config.InstanceId {
+		return false
+	}
+	_, ok := s.config.Peers[id]
+	return ok
+}
+
+// Queries all peers for their games matching the filter. Each peer is asked for
+// the first offset+limit games, which is enough to assemble the requested page.
+// Peers that cannot be reached are skipped.
+func (s *Server) listPeerGames(f gameFilter) ([]*GameInfo, int) {
+	var games []*GameInfo
+	total := 0
+	client := &http.Client{Timeout: time.Duration(2) * time.Second}
+	for id, addr := range s.config.Peers {
+		if id == s.config.InstanceId {
+			continue
+		}
+		q := url.Values{}
+		if f.gameType != "" {
+			q.Set("type", string(f.gameType))
+		}
+		if f.openSeats {
+			q.Set("open", "true")
+		}
+		if f.host != "" {
+			q.Set("host", f.host)
+		}
+		q.Set("limit", fmt.Sprint(f.offset+f.limit))
+		req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/hexz/gamez?"+q.Encode(), nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set(forwardedByHeader, s.config.InstanceId)
+		resp, err := client.Do(req)
+		if err != nil {
+			s.IncCounter("/cluster/gamez/peer_errors")
+			continue
+		}
+		var page GameListResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			s.IncCounter("/cluster/gamez/peer_errors")
+			continue
+		}
+		games = append(games, page.Games...)
+		total += page.Total
+	}
+	return games, total
+}
+
+// Merges the local page of games with the peers' games and extracts the requested page.
+func mergeGamePages(local []*GameInfo, localTotal int, peer []*GameInfo, peerTotal int, f gameFilter) ([]*GameInfo, int) {
+	all := append(append([]*GameInfo{}, local...), peer...)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Started.After(all[j].Started)
+	})
+	total := localTotal + peerTotal
+	if f.offset >= len(all) {
+		return []*GameInfo{}, total
+	}
+	end := f.offset + f.limit
+	if end > len(all) {
+		end = len(all)
+	}
+	return all[f.offset:end], total
+}
@@ -0,0 +1,195 @@
+package hexz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePeers(t *testing.T) {
+	peers, err := ParsePeers("A=http://localhost:8084, B=https://example.com:8085")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(peers) != 2 || peers["A"] != "http://localhost:8084" || peers["B"] != "https://example.com:8085" {
+		t.Errorf("Unexpected peers: %v", peers)
+	}
+	for _, spec := range []string{"A", "a=http://localhost", "A=localhost:8084", "A=ftp://localhost"} {
+		if _, err := ParsePeers(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestInstanceFromGameId(t *testing.T) {
+	tests := []struct {
+		gameId string
+		want   string
+	}{
+		{"ABCDEF", ""},
+		{"A-ABCDEF", "A"},
+		{"B2-ABCDEFGHIJKLMNOP", "B2"},
+	}
+	for _, test := range tests {
+		if got := instanceFromGameId(test.gameId); got != test.want {
+			t.Errorf("%s: want %q, got %q", test.gameId, test.want, got)
+		}
+	}
+}
+
+func TestFileSystemPlayerStore(t *testing.T) {
+	store, err := NewFileSystemPlayerStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Player{Id: generatePlayerId(), Name: "alice", LastActive: time.Now().Round(0)}
+	if _, err := store.Load(p.Id); err != errPlayerNotFound {
+		t.Errorf("Want errPlayerNotFound, got %v", err)
+	}
+	if err := store.Save(p); err != nil {
+		t.Fatalf("Cannot save player: %s", err)
+	}
+	got, err := store.Load(p.Id)
+	if err != nil {
+		t.Fatalf("Cannot load player: %s", err)
+	}
+	if got.Name != p.Name || !got.LastActive.Equal(p.LastActive) {
+		t.Errorf("want %+v, got %+v", p, got)
+	}
+	if err := store.Delete(p.Id); err != nil {
+		t.Errorf("Cannot delete player: %s", err)
+	}
+	if _, err := store.Load(p.Id); err != errPlayerNotFound {
+		t.Errorf("Want errPlayerNotFound after delete, got %v", err)
+	}
+	if err := store.Save(&Player{Id: "../etc/passwd"}); err == nil {
+		t.Error("Expected error for invalid player ID")
+	}
+}
+
+// Starts two server instances A and B that know each other as peers.
+func startTestCluster(t *testing.T) (urlA, urlB string, instances [2]*Server) {
+	storeDir := t.TempDir()
+	var handlers [2]http.Handler
+	var servers [2]*httptest.Server
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[i].Close)
+	}
+	peers := map[string]string{"A": servers[0].URL, "B": servers[1].URL}
+	for i, id := range []string{"A", "B"} {
+		s := NewServer(&ServerConfig{
+			DocumentRoot:      "./resources",
+			PlayerRemoveDelay: time.Minute,
+			LoginTtl:          time.Hour,
+			CompThinkTime:     time.Second,
+			InstanceId:        id,
+			Peers:             peers,
+			PlayerStoreDir:    storeDir,
+		})
+		handlers[i] = s.createHandler()
+		instances[i] = s
+	}
+	return servers[0].URL, servers[1].URL, instances
+}
+
+func TestClusterRouting(t *testing.T) {
+	urlA, urlB, _ := startTestCluster(t)
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	// Log in on A.
+	resp, err := client.PostForm(urlA+"/hexz/login", url.Values{"name": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("Login failed: %s", resp.Status)
+	}
+	// Start a game on A.
+	resp, err = client.PostForm(urlA+"/hexz/new", url.Values{"type": {"Flagz"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc := resp.Header.Get("Location")
+	if !strings.HasPrefix(loc, "/hexz/A-") {
+		t.Fatalf("Game was not created on instance A: %q", loc)
+	}
+	// B must know the player (shared store) and forward the game page to A.
+	resp, err = client.Get(urlB + loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "<canvas") {
+		t.Errorf("Game page not served via B: %s", resp.Status)
+	}
+	// B's lobby lists A's game.
+	resp, err = client.Get(urlB + "/hexz/gamez")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), strings.TrimPrefix(loc, "/hexz/")) {
+		t.Errorf("Game %s not listed in B's lobby: %s", loc, body)
+	}
+}
+
+func TestClusterLobbyPaging(t *testing.T) {
+	urlA, _, instances := startTestCluster(t)
+	// 240 games, alternating between A and B, so pages past the lobby's
+	// maximum limit need more than maxLobbyLimit games from each peer.
+	start := time.Now()
+	var want []string // Most recent first.
+	for i := 239; i >= 0; i-- {
+		s := instances[i%2]
+		g := &GameHandle{
+			id:       fmt.Sprintf("%s-G%03d", s.config.InstanceId, i),
+			host:     "alice",
+			gameType: gameTypeFlagz,
+			started:  start.Add(time.Duration(i) * time.Second),
+		}
+		s.ongoingGames[g.id] = g
+		want = append(want, g.id)
+	}
+	var got []string
+	for offset := 0; offset < len(want); offset += 20 {
+		resp, err := http.Get(fmt.Sprintf("%s/hexz/gamez?offset=%d&limit=20", urlA, offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page GameListResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != len(want) {
+			t.Errorf("Offset %d: want total %d, got %d", offset, len(want), page.Total)
+		}
+		for _, g := range page.Games {
+			got = append(got, g.Id)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Pages do not contain all games exactly once:\nwant %v\ngot  %v", want, got)
+	}
+}
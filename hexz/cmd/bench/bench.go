@@ -21,6 +21,23 @@ var uctFactor = flag.Float64("uctfactor", 1.0, "weight of the exploration compon
 var thinkTime = flag.Duration("thinktime", time.Duration(2)*time.Second, "Think time per player and move")
 var oppThinkTime = flag.Duration("oppthinktime", time.Duration(2)*time.Second, "Think time per player and move")
 var flagsFirst = flag.Bool("flagsfirst", false, "If true, flags will be played first")
+var rollout = flag.String("rollout", "uniform", "Rollout policy of the bench player (uniform, greedy, epsgreedy:<eps>, weighted:<weights>)")
+var oppRollout = flag.String("opprollout", "uniform", "Rollout policy of the opponent")
+var endgameMoves = flag.Int("endgamemoves", 0, "Bench player solves positions with at most this many legal moves exactly")
+var endgameFreeCells = flag.Int("endgamefreecells", 0, "Bench player solves positions with at most this many free cells exactly")
+var gameType = flag.String("gametype", "Flagz", "Type of the games to play. Must support single player mode")
+var listGameTypes = flag.Bool("listgametypes", false, "List the game types the benchmark can play and exit")
+
+// Returns the descriptors of all game types the computer can play.
+func benchGameTypes() []*hexz.GameTypeDescriptor {
+	var result []*hexz.GameTypeDescriptor
+	for _, d := range hexz.GameTypes() {
+		if d.SinglePlayer {
+			result = append(result, d)
+		}
+	}
+	return result
+}
 
 // Compute the think time we'll give to the player.
 // If the player was 98% confident to win with any move on the last move,
@@ -40,6 +57,29 @@ func getThinkTime(stats []*hexz.MCTSStats, isBenchPlayer bool) time.Duration {
 
 func main() {
 	flag.Parse()
+	if *listGameTypes {
+		for _, d := range benchGameTypes() {
+			fmt.Printf("%s\t%s\n", d.Type, d.DisplayText)
+		}
+		return
+	}
+	var benchType *hexz.GameTypeDescriptor
+	for _, d := range benchGameTypes() {
+		if string(d.Type) == *gameType {
+			benchType = d
+		}
+	}
+	if benchType == nil {
+		log.Fatalf("Invalid -gametype %q. Use -listgametypes to see all valid types", *gameType)
+	}
+	benchRollout, err := hexz.ParseRolloutPolicy(*rollout)
+	if err != nil {
+		log.Fatal("Invalid -rollout: ", err)
+	}
+	oppRolloutPolicy, err := hexz.ParseRolloutPolicy(*oppRollout)
+	if err != nil {
+		log.Fatal("Invalid -opprollout: ", err)
+	}
 	// Optional profiling
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
@@ -70,12 +110,15 @@ func main() {
 		draws  int
 	}
 	var wstats [2]wstat
+	// Search performance over all games and both players.
+	var totalIterations int
+	var totalElapsed time.Duration
 	nRuns := 0
 	cancelled := false
 	src := rand.NewSource(time.Now().UnixNano())
 	for time.Since(started) < *maxRuntime && !cancelled {
 		nMoves := 0
-		ge := hexz.NewGameEngineFlagz(src)
+		ge := benchType.NewEngine(2, src).(hexz.SinglePlayerGameEngine)
 
 		var moveStats [2][]*hexz.MCTSStats
 		mcts := []*hexz.MCTS{
@@ -87,6 +130,10 @@ func main() {
 		mcts[benchPlayer-1].MaxFlagPositions = *maxFlagPositions
 		mcts[benchPlayer-1].UctFactor = *uctFactor
 		mcts[benchPlayer-1].FlagsFirst = *flagsFirst
+		mcts[benchPlayer-1].Rollout = benchRollout
+		mcts[benchPlayer-1].EndgameMoves = *endgameMoves
+		mcts[benchPlayer-1].EndgameFreeCells = *endgameFreeCells
+		mcts[2-benchPlayer].Rollout = oppRolloutPolicy
 
 	Gameloop:
 		for !ge.IsDone() && time.Since(started) < *maxRuntime {
@@ -124,6 +171,8 @@ func main() {
 				s := moveStats[i][j]
 				agg[i].Iterations += s.Iterations
 				agg[i].Elapsed += s.Elapsed
+				totalIterations += s.Iterations
+				totalElapsed += s.Elapsed
 				if agg[i].MaxDepth < s.MaxDepth {
 					agg[i].MaxDepth = s.MaxDepth
 				}
@@ -145,4 +194,7 @@ func main() {
 	})
 	fmt.Printf("Flags:%s\n", sb.String())
 	fmt.Printf("=== Final results:\n  As P1: %+v\n  As P2: %+v\n", wstats[0], wstats[1])
+	if totalElapsed > 0 {
+		fmt.Printf("iterations_per_sec: %.1f\n", float64(totalIterations)/totalElapsed.Seconds())
+	}
 }
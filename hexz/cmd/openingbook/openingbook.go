@@ -0,0 +1,180 @@
+package main
+
+// Builds a Flagz opening book by analysing opening positions with a deep MCTS search.
+//
+// Positions are either taken from a self-play file (see cmd/selfplay) or
+// generated by playing the main line of seeded random layouts.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/dnswlt/hackz/hexz"
+)
+
+var output = flag.String("output", "openingbook.json", "File to write the opening book to. Existing entries in the file are kept")
+var selfPlayFile = flag.String("selfplay", "", "Self-play file to take opening positions from. If empty, positions are generated from -layouts")
+var numLayouts = flag.Int("layouts", 10, "Number of random layouts to generate positions from (if -selfplay is not set)")
+var seed = flag.Int64("seed", 1, "Base seed of the random layouts. Layout i uses seed+i")
+var plies = flag.Int("plies", 4, "Number of opening moves per game to add to the book")
+var thinkTime = flag.Duration("thinktime", time.Duration(10)*time.Second, "Think time per position")
+var maxIterations = flag.Int("iterations", 0, "Maximum number of MCTS iterations per position. Overrides -thinktime if > 0")
+var parallelism = flag.Int("parallelism", runtime.NumCPU(), "Number of positions to analyse in parallel")
+var uctFactor = flag.Float64("uctfactor", 1.0, "Weight of the exploration component in the UCT")
+var rollout = flag.String("rollout", "uniform", "Rollout policy (uniform, greedy, epsgreedy:<eps>, weighted:<weights>)")
+
+type analysis struct {
+	ge    *hexz.GameEngineFlagz
+	move  hexz.GameEngineMove
+	stats *hexz.MCTSStats
+}
+
+func newMCTS(src rand.Source, policy hexz.RolloutPolicy) *hexz.MCTS {
+	mcts := hexz.NewMCTSFromSource(src)
+	mcts.UctFactor = *uctFactor
+	mcts.MaxIterations = *maxIterations
+	mcts.Rollout = policy
+	return mcts
+}
+
+func searchTime() time.Duration {
+	if *maxIterations > 0 {
+		// The iteration budget should limit the search, not the clock.
+		return time.Duration(24) * time.Hour
+	}
+	return *thinkTime
+}
+
+// Reads all positions of the first plies moves of each game in the self-play file.
+func readSelfPlayPositions(filename string) ([]*hexz.GameEngineFlagz, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := hexz.NewSelfPlayReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var positions []*hexz.GameEngineFlagz
+	for {
+		g, err := r.ReadGame()
+		if errors.Is(err, io.EOF) {
+			return positions, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for i, p := range g.Positions {
+			if i >= *plies {
+				break
+			}
+			positions = append(positions, hexz.NewGameEngineFlagzFromBoard(p.Board, rand.NewSource(int64(i))))
+		}
+	}
+}
+
+// Analyses positions in parallel and adds the best moves to the book.
+func analyseAll(book *hexz.OpeningBook, positions []*hexz.GameEngineFlagz, policy hexz.RolloutPolicy) {
+	work := make(chan *hexz.GameEngineFlagz)
+	results := make(chan analysis)
+	for i := 0; i < *parallelism; i++ {
+		go func(workerSeed int64) {
+			mcts := newMCTS(rand.NewSource(workerSeed), policy)
+			for ge := range work {
+				m, stats := mcts.SuggestMove(ge, searchTime())
+				results <- analysis{ge: ge, move: m, stats: stats}
+			}
+		}(*seed + int64(i))
+	}
+	go func() {
+		for _, ge := range positions {
+			work <- ge
+		}
+		close(work)
+	}()
+	for i := range positions {
+		a := <-results
+		book.Add(a.ge, a.move, a.stats)
+		fmt.Printf("Analysed position %d/%d: %d iterations, win rate %.3f\n",
+			i+1, len(positions), a.stats.Iterations, a.stats.MaxQ())
+	}
+}
+
+// Plays the main line of each seeded layout, analysing every position along the way.
+// Layouts are processed in parallel, plies within a layout sequentially.
+func analyseLayouts(book *hexz.OpeningBook, policy hexz.RolloutPolicy) {
+	games := make([]*hexz.GameEngineFlagz, *numLayouts)
+	for i := range games {
+		games[i] = hexz.NewGameEngineFlagz(rand.NewSource(*seed + int64(i)))
+	}
+	for ply := 0; ply < *plies; ply++ {
+		var positions []*hexz.GameEngineFlagz
+		for _, g := range games {
+			if !g.IsDone() && !book.Has(g.Board()) {
+				positions = append(positions, g)
+			}
+		}
+		fmt.Printf("Ply %d: analysing %d positions\n", ply+1, len(positions))
+		analyseAll(book, positions, policy)
+		for _, g := range games {
+			if g.IsDone() {
+				continue
+			}
+			m, _, ok := book.Lookup(g)
+			if !ok {
+				// Book move was not accepted (should not happen). Fall back to a fresh search.
+				m, _ = newMCTS(rand.NewSource(*seed), policy).SuggestMove(g, searchTime())
+			}
+			if !g.MakeMove(m) {
+				log.Fatalf("Cannot make move %s", m.String())
+			}
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *plies <= 0 || *parallelism <= 0 {
+		log.Fatal("-plies and -parallelism must be positive")
+	}
+	policy, err := hexz.ParseRolloutPolicy(*rollout)
+	if err != nil {
+		log.Fatal("Invalid -rollout: ", err)
+	}
+	book := hexz.NewOpeningBook()
+	if _, err := os.Stat(*output); err == nil {
+		book, err = hexz.LoadOpeningBook(*output)
+		if err != nil {
+			log.Fatal("Cannot read existing opening book: ", err)
+		}
+		fmt.Printf("Extending opening book with %d positions\n", book.Len())
+	}
+	started := time.Now()
+	if *selfPlayFile != "" {
+		positions, err := readSelfPlayPositions(*selfPlayFile)
+		if err != nil {
+			log.Fatal("Cannot read self-play file: ", err)
+		}
+		var todo []*hexz.GameEngineFlagz
+		for _, ge := range positions {
+			if !ge.IsDone() && !book.Has(ge.Board()) {
+				todo = append(todo, ge)
+			}
+		}
+		analyseAll(book, todo, policy)
+	} else {
+		analyseLayouts(book, policy)
+	}
+	if err := book.Save(*output); err != nil {
+		log.Fatal("Cannot write opening book: ", err)
+	}
+	fmt.Printf("Wrote opening book with %d positions to %s after %.1fs\n",
+		book.Len(), *output, time.Since(started).Seconds())
+}
@@ -0,0 +1,138 @@
+package main
+
+// Renders the history of a game stored in a game event log to a sequence of
+// images or an animated GIF. See eventlog.go in package hexz for the log format.
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"log"
+	"os"
+	"path"
+
+	"github.com/dnswlt/hackz/hexz"
+)
+
+var eventLog = flag.String("eventlog", "", "Game event log file to read the game from")
+var gameId = flag.String("game", "", "ID of the game to render")
+var levelDir = flag.String("leveldir", "", "Directory with the levels used by games started from a level")
+var outputDir = flag.String("outputdir", "", "Directory to write one image per move to")
+var format = flag.String("format", "png", "Format of the images written to -outputdir (png, svg)")
+var gifFile = flag.String("gif", "", "File to write an animated GIF of the game to")
+var width = flag.Int("width", 600, "Width of the images in pixels")
+var delay = flag.Int("delay", 50, "Delay between GIF frames, in 100ths of a second")
+
+func writeImages(boards []*hexz.Board) error {
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return err
+	}
+	for i, b := range boards {
+		f, err := os.Create(path.Join(*outputDir, fmt.Sprintf("move-%04d.%s", i, *format)))
+		if err != nil {
+			return err
+		}
+		if *format == "svg" {
+			err = hexz.RenderBoardSVG(f, b.ViewFor(0), *width)
+		} else {
+			err = hexz.RenderBoardPNG(f, b.ViewFor(0), *width)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the distinct colors of all frames if they fit into a GIF palette,
+// and a standard palette otherwise.
+func gifPalette(frames []*image.RGBA) color.Palette {
+	seen := make(map[color.RGBA]bool)
+	var p color.Palette
+	for _, img := range frames {
+		for i := 0; i < len(img.Pix); i += 4 {
+			c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+			if !seen[c] {
+				if len(p) == 256 {
+					return palette.Plan9
+				}
+				seen[c] = true
+				p = append(p, c)
+			}
+		}
+	}
+	return p
+}
+
+func writeGif(boards []*hexz.Board) error {
+	frames := make([]*image.RGBA, len(boards))
+	for i, b := range boards {
+		frames[i] = hexz.RenderBoardImage(b.ViewFor(0), *width)
+	}
+	p := gifPalette(frames)
+	anim := &gif.GIF{}
+	for _, img := range frames {
+		pimg := image.NewPaletted(img.Bounds(), p)
+		draw.Draw(pimg, img.Bounds(), img, image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, pimg)
+		anim.Delay = append(anim.Delay, *delay)
+	}
+	// Linger on the final board.
+	anim.Delay[len(anim.Delay)-1] = 4 * *delay
+	f, err := os.Create(*gifFile)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(f, anim); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	flag.Parse()
+	if *eventLog == "" || *gameId == "" {
+		log.Fatal("-eventlog and -game are required")
+	}
+	if *outputDir == "" && *gifFile == "" {
+		log.Fatal("At least one of -outputdir and -gif is required")
+	}
+	if *format != "png" && *format != "svg" {
+		log.Fatalf("Invalid -format %q", *format)
+	}
+	events, err := hexz.ReadGameEvents(*eventLog)
+	if err != nil {
+		log.Fatal("Cannot read event log: ", err)
+	}
+	var levels []*hexz.Level
+	if *levelDir != "" {
+		levels, err = hexz.LoadLevels(*levelDir)
+		if err != nil {
+			log.Fatal("Cannot load levels: ", err)
+		}
+	}
+	boards, err := hexz.ReplayGame(events, *gameId, levels)
+	if err != nil {
+		log.Fatal("Cannot replay game: ", err)
+	}
+	if *outputDir != "" {
+		if err := writeImages(boards); err != nil {
+			log.Fatal("Cannot write images: ", err)
+		}
+		log.Printf("Wrote %d images to %s", len(boards), *outputDir)
+	}
+	if *gifFile != "" {
+		if err := writeGif(boards); err != nil {
+			log.Fatal("Cannot write GIF: ", err)
+		}
+		log.Printf("Wrote %d frames to %s", len(boards), *gifFile)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+// Generates training data by letting MCTS play Flagz against itself.
+// See selfplay.go in package hexz for a description of the output format.
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/dnswlt/hackz/hexz"
+)
+
+var numGames = flag.Int("games", 10, "Number of games to play")
+var output = flag.String("output", "selfplay.bin", "File to write the training data to")
+var thinkTime = flag.Duration("thinktime", time.Duration(1)*time.Second, "Think time per move")
+var maxIterations = flag.Int("iterations", 0, "Maximum number of MCTS iterations per move. If > 0, games are fully reproducible given the seed")
+var seed = flag.Int64("seed", 0, "Seed for all random number generators. Uses the current time if 0")
+var parallelism = flag.Int("parallelism", runtime.NumCPU(), "Number of games to play in parallel")
+var uctFactor = flag.Float64("uctfactor", 1.0, "Weight of the exploration component in the UCT")
+var rollout = flag.String("rollout", "uniform", "Rollout policy (uniform, greedy, epsgreedy:<eps>, weighted:<weights>)")
+
+type result struct {
+	index int
+	game  *hexz.SelfPlayGame
+	err   error
+}
+
+// Plays the game with the given index. Each game gets its own seed derived
+// from the base seed, so results do not depend on the order in which games are played.
+func playGame(index int, baseSeed int64, policy hexz.RolloutPolicy) result {
+	rnd := rand.New(rand.NewSource(baseSeed + int64(index)))
+	ge := hexz.NewGameEngineFlagz(rand.NewSource(rnd.Int63()))
+	var players [2]*hexz.MCTS
+	for i := range players {
+		players[i] = hexz.NewMCTSFromSource(rand.NewSource(rnd.Int63()))
+		players[i].UctFactor = *uctFactor
+		players[i].MaxIterations = *maxIterations
+		players[i].Rollout = policy
+	}
+	think := *thinkTime
+	if *maxIterations > 0 {
+		// The iteration budget should limit the search, not the clock.
+		think = time.Duration(24) * time.Hour
+	}
+	g, err := hexz.PlaySelfPlayGame(ge, players, think)
+	return result{index: index, game: g, err: err}
+}
+
+func main() {
+	flag.Parse()
+	if *numGames <= 0 || *parallelism <= 0 {
+		log.Fatal("-games and -parallelism must be positive")
+	}
+	policy, err := hexz.ParseRolloutPolicy(*rollout)
+	if err != nil {
+		log.Fatal("Invalid -rollout: ", err)
+	}
+	baseSeed := *seed
+	if baseSeed == 0 {
+		baseSeed = time.Now().UnixNano()
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal("Cannot create output file: ", err)
+	}
+	defer f.Close()
+	w, err := hexz.NewSelfPlayWriter(f)
+	if err != nil {
+		log.Fatal("Cannot write header: ", err)
+	}
+
+	started := time.Now()
+	fmt.Printf("Playing %d games with seed %d\n", *numGames, baseSeed)
+	indices := make(chan int)
+	results := make(chan result)
+	for i := 0; i < *parallelism; i++ {
+		go func() {
+			for idx := range indices {
+				results <- playGame(idx, baseSeed, policy)
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < *numGames; i++ {
+			indices <- i
+		}
+		close(indices)
+	}()
+	// Write games in index order to make the output reproducible.
+	pending := make(map[int]*hexz.SelfPlayGame)
+	next := 0
+	numPositions := 0
+	var wins [3]int
+	for i := 0; i < *numGames; i++ {
+		r := <-results
+		if r.err != nil {
+			log.Fatalf("Game %d failed: %s", r.index, r.err)
+		}
+		pending[r.index] = r.game
+		for g, ok := pending[next]; ok; g, ok = pending[next] {
+			if err := w.WriteGame(g); err != nil {
+				log.Fatal("Cannot write game: ", err)
+			}
+			delete(pending, next)
+			numPositions += len(g.Positions)
+			wins[g.Winner]++
+			next++
+		}
+		fmt.Printf("Finished game %d/%d (%d positions) after %.1fs\n",
+			i+1, *numGames, len(r.game.Positions), time.Since(started).Seconds())
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal("Cannot write output: ", err)
+	}
+	fmt.Printf("Wrote %d games with %d positions to %s. Wins P1: %d, P2: %d, draws: %d\n",
+		*numGames, numPositions, *output, wins[1], wins[2], wins[0])
+}
@@ -1,42 +1,130 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log"
 	"os"
-	"regexp"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/dnswlt/hackz/hexz"
 )
 
-var ()
+// Maximum time to wait for active requests when shutting down.
+// Open SSE connections are only closed when it expires.
+const shutdownTimeout = time.Duration(5) * time.Second
 
-func main() {
-	cfg := &hexz.ServerConfig{}
-
-	flag.StringVar(&cfg.ServerAddress, "address", "", "Address on which to listen")
-	flag.IntVar(&cfg.ServerPort, "port", 8084, "Port on which to listen")
-	flag.StringVar(&cfg.DocumentRoot, "resources-dir", "./resources",
-		"Root directory from which to serve files")
-	flag.DurationVar(&cfg.PlayerRemoveDelay, "remove-delay", time.Duration(60)*time.Second,
+// Defines all command-line flags of the server on fs. Flags are stored in cfg,
+// except for the peers spec and the config file name.
+func defineFlags(fs *flag.FlagSet, cfg *hexz.ServerConfig, peers *string, configFile *string) {
+	fs.StringVar(configFile, "config", "",
+		"Config file (JSON, or YAML if it ends in .yaml or .yml). Command-line flags override its settings")
+	fs.StringVar(&cfg.ServerAddress, "address", "", "Address on which to listen")
+	fs.IntVar(&cfg.ServerPort, "port", 8084, "Port on which to listen")
+	fs.StringVar(&cfg.DocumentRoot, "resources-dir", "",
+		"Directory with resource files that override the embedded ones (for development)")
+	fs.DurationVar(&cfg.PlayerRemoveDelay, "remove-delay", time.Duration(60)*time.Second,
 		"Time to wait before removing a disconnected player from a game")
-	flag.DurationVar(&cfg.LoginTtl, "login-ttl", time.Duration(24)*time.Hour,
+	fs.DurationVar(&cfg.LoginTtl, "login-ttl", time.Duration(24)*time.Hour,
 		"Time to wait logging a player out after inactivity")
-	flag.DurationVar(&cfg.CompThinkTime, "comp-think-time", time.Duration(5)*time.Second,
+	fs.DurationVar(&cfg.CompThinkTime, "comp-think-time", time.Duration(5)*time.Second,
 		"Time the computer has to think about a move")
-	flag.BoolVar(&cfg.DebugMode, "debug", false,
+	fs.IntVar(&cfg.CpuMaxIterations, "cpu-max-iterations", 0,
+		"Maximum number of MCTS iterations per CPU move. If > 0, -comp-think-time is ignored and CPU play is reproducible from the game's seeds")
+	fs.IntVar(&cfg.CpuEndgameFreeCells, "cpu-endgame-free-cells", 12,
+		"The CPU player solves positions with at most this many free cells exactly")
+	fs.IntVar(&cfg.CpuEndgameMoves, "cpu-endgame-moves", 6,
+		"The CPU player solves positions with at most this many legal moves exactly")
+	fs.BoolVar(&cfg.DebugMode, "debug", false,
 		"Run server in debug mode. Only set to true during development.")
-	flag.StringVar(&cfg.AuthTokenSha256, "auth-token", "", "SHA256 token for access to restricted paths (http authentication)")
-	flag.StringVar(&cfg.TlsCertChain, "tls-cert", "", "Path to chain.pem for TLS")
-	flag.StringVar(&cfg.TlsPrivKey, "tls-key", "", "Path to privkey.pem for TLS")
-	flag.Parse()
+	fs.StringVar(&cfg.AuthTokenSha256, "auth-token", "", "SHA256 token for access to restricted paths (http authentication)")
+	fs.StringVar(&cfg.TlsCertChain, "tls-cert", "", "Path to chain.pem for TLS")
+	fs.StringVar(&cfg.TlsPrivKey, "tls-key", "", "Path to privkey.pem for TLS")
+	fs.StringVar(&cfg.EventLogDir, "event-log-dir", "", "Directory to write game event logs (JSON lines) to. Disabled if empty.")
+	fs.Int64Var(&cfg.EventLogMaxBytes, "event-log-max-bytes", 64<<20, "Maximum size of a single game event log file")
+	fs.StringVar(&cfg.InstanceId, "instance-id", "", "ID of this instance when running multiple instances (e.g. A, B)")
+	fs.StringVar(peers, "peers", "", "Comma-separated list of peer instances, e.g. A=http://localhost:8084,B=http://localhost:8085")
+	fs.StringVar(&cfg.PlayerStoreDir, "player-store-dir", "", "Directory shared by all instances to store logged in players")
+	fs.StringVar(&cfg.CpuRolloutPolicy, "cpu-rollout", "uniform",
+		"Rollout policy of the CPU player (uniform, greedy, epsgreedy:<eps>, weighted:<weights>)")
+	fs.StringVar(&cfg.OpeningBookFile, "opening-book", "", "Flagz opening book file used by the CPU player (see cmd/openingbook)")
+	fs.StringVar(&cfg.LevelDir, "level-dir", "", "Directory with Flagz level files (see the Freeform level editor)")
+	fs.StringVar(&cfg.UserDatabaseFile, "user-db", "_users.json", "File to persist logged in players to (if -player-store-dir is not set)")
+}
 
-	if cfg.AuthTokenSha256 != "" {
-		if len(cfg.AuthTokenSha256) != 64 || !regexp.MustCompile("[a-fA-F0-9]+").MatchString(cfg.AuthTokenSha256) {
-			fmt.Fprint(os.Stderr, "-auth-token must be a SHA256 hex digest")
-			os.Exit(1)
+// Reads the server config from the command-line args and the config file given
+// in the -config flag, if any. Flags that are set explicitly override the config file.
+func loadConfig(args []string) (*hexz.ServerConfig, error) {
+	cfg := &hexz.ServerConfig{}
+	var peers, configFile string
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	defineFlags(fs, cfg, &peers, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if configFile != "" {
+		if err := hexz.LoadServerConfigFile(configFile, cfg); err != nil {
+			return nil, err
+		}
+		// Parse again to let explicitly set flags override the config file.
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+	if peers != "" || cfg.Peers == nil {
+		p, err := hexz.ParsePeers(peers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -peers: %w", err)
 		}
+		cfg.Peers = p
 	}
-	hexz.NewServer(cfg).Serve()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func main() {
+	cfg, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %s\n", err)
+		os.Exit(1)
+	}
+	s := hexz.NewServer(cfg)
+	// Reload the config file on SIGHUP.
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			newCfg, err := loadConfig(os.Args[1:])
+			if err == nil {
+				err = s.ReloadConfig(newCfg)
+			}
+			if err != nil {
+				log.Printf("Cannot reload config, keeping the current one: %s", err)
+			}
+		}
+	}()
+	// Close the game event log on SIGINT and SIGTERM, so no events are lost.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		<-stop
+		log.Print("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Printf("Error during shutdown: %s", err)
+		}
+		close(stopped)
+	}()
+	s.Serve()
+	<-stopped
 }
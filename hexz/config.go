@@ -0,0 +1,226 @@
+package hexz
+
+// Server configuration files and live reloading of settings.
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// Regexp used to validate auth tokens.
+	sha256HexRegexp = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+)
+
+// A time.Duration that is written as a string like "5s" or "1h30m" in config files.
+type configDuration time.Duration
+
+func (d *configDuration) set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = configDuration(v)
+	return nil
+}
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"5s\": %w", err)
+	}
+	return d.set(s)
+}
+
+func (d *configDuration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	return d.set(s)
+}
+
+// Contents of a server config file. Only the fields present in the file are set.
+type serverConfigFile struct {
+	ServerAddress       *string            `json:"serverAddress" yaml:"serverAddress"`
+	ServerPort          *int               `json:"serverPort" yaml:"serverPort"`
+	DocumentRoot        *string            `json:"documentRoot" yaml:"documentRoot"`
+	PlayerRemoveDelay   *configDuration    `json:"playerRemoveDelay" yaml:"playerRemoveDelay"`
+	LoginTtl            *configDuration    `json:"loginTtl" yaml:"loginTtl"`
+	CompThinkTime       *configDuration    `json:"compThinkTime" yaml:"compThinkTime"`
+	CpuMaxIterations    *int               `json:"cpuMaxIterations" yaml:"cpuMaxIterations"`
+	CpuEndgameFreeCells *int               `json:"cpuEndgameFreeCells" yaml:"cpuEndgameFreeCells"`
+	CpuEndgameMoves     *int               `json:"cpuEndgameMoves" yaml:"cpuEndgameMoves"`
+	AuthTokenSha256     *string            `json:"authTokenSha256" yaml:"authTokenSha256"`
+	TlsCertChain        *string            `json:"tlsCertChain" yaml:"tlsCertChain"`
+	TlsPrivKey          *string            `json:"tlsPrivKey" yaml:"tlsPrivKey"`
+	DebugMode           *bool              `json:"debugMode" yaml:"debugMode"`
+	EventLogDir         *string            `json:"eventLogDir" yaml:"eventLogDir"`
+	EventLogMaxBytes    *int64             `json:"eventLogMaxBytes" yaml:"eventLogMaxBytes"`
+	InstanceId          *string            `json:"instanceId" yaml:"instanceId"`
+	Peers               *map[string]string `json:"peers" yaml:"peers"`
+	PlayerStoreDir      *string            `json:"playerStoreDir" yaml:"playerStoreDir"`
+	UserDatabaseFile    *string            `json:"userDatabaseFile" yaml:"userDatabaseFile"`
+	CpuRolloutPolicy    *string            `json:"cpuRolloutPolicy" yaml:"cpuRolloutPolicy"`
+	OpeningBookFile     *string            `json:"openingBookFile" yaml:"openingBookFile"`
+	LevelDir            *string            `json:"levelDir" yaml:"levelDir"`
+}
+
+func setIfPresent[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setDurationIfPresent(dst *time.Duration, src *configDuration) {
+	if src != nil {
+		*dst = time.Duration(*src)
+	}
+}
+
+// Reads the config file and overwrites the fields of cfg that are set in it.
+// Files ending in .yaml or .yml are parsed as YAML, all others as JSON.
+// Unknown keys are an error. The resulting config is not validated.
+func LoadServerConfigFile(filename string, cfg *ServerConfig) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var f serverConfigFile
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", filename, err)
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", filename, err)
+		}
+	}
+	setIfPresent(&cfg.ServerAddress, f.ServerAddress)
+	setIfPresent(&cfg.ServerPort, f.ServerPort)
+	setIfPresent(&cfg.DocumentRoot, f.DocumentRoot)
+	setDurationIfPresent(&cfg.PlayerRemoveDelay, f.PlayerRemoveDelay)
+	setDurationIfPresent(&cfg.LoginTtl, f.LoginTtl)
+	setDurationIfPresent(&cfg.CompThinkTime, f.CompThinkTime)
+	setIfPresent(&cfg.CpuMaxIterations, f.CpuMaxIterations)
+	setIfPresent(&cfg.CpuEndgameFreeCells, f.CpuEndgameFreeCells)
+	setIfPresent(&cfg.CpuEndgameMoves, f.CpuEndgameMoves)
+	setIfPresent(&cfg.AuthTokenSha256, f.AuthTokenSha256)
+	setIfPresent(&cfg.TlsCertChain, f.TlsCertChain)
+	setIfPresent(&cfg.TlsPrivKey, f.TlsPrivKey)
+	setIfPresent(&cfg.DebugMode, f.DebugMode)
+	setIfPresent(&cfg.EventLogDir, f.EventLogDir)
+	setIfPresent(&cfg.EventLogMaxBytes, f.EventLogMaxBytes)
+	setIfPresent(&cfg.InstanceId, f.InstanceId)
+	setIfPresent(&cfg.Peers, f.Peers)
+	setIfPresent(&cfg.PlayerStoreDir, f.PlayerStoreDir)
+	setIfPresent(&cfg.UserDatabaseFile, f.UserDatabaseFile)
+	setIfPresent(&cfg.CpuRolloutPolicy, f.CpuRolloutPolicy)
+	setIfPresent(&cfg.OpeningBookFile, f.OpeningBookFile)
+	setIfPresent(&cfg.LevelDir, f.LevelDir)
+	return nil
+}
+
+// Checks that cfg can be used to run a server.
+func (cfg *ServerConfig) Validate() error {
+	if cfg.ServerPort < 0 || cfg.ServerPort > 65535 {
+		return fmt.Errorf("invalid port %d", cfg.ServerPort)
+	}
+	if cfg.PlayerRemoveDelay < 0 || cfg.LoginTtl < 0 || cfg.CompThinkTime < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	if cfg.AuthTokenSha256 != "" && !sha256HexRegexp.MatchString(cfg.AuthTokenSha256) {
+		return fmt.Errorf("auth token must be a SHA256 hex digest")
+	}
+	if (cfg.TlsCertChain == "") != (cfg.TlsPrivKey == "") {
+		return fmt.Errorf("TLS needs both a certificate chain and a private key")
+	}
+	if _, err := ParseRolloutPolicy(cfg.CpuRolloutPolicy); err != nil {
+		return fmt.Errorf("invalid CPU rollout policy: %w", err)
+	}
+	if err := ValidateClusterConfig(cfg); err != nil {
+		return fmt.Errorf("invalid cluster configuration: %w", err)
+	}
+	return nil
+}
+
+// Settings that can be changed while the server is running. See ReloadConfig.
+type liveConfig struct {
+	compThinkTime     time.Duration
+	playerRemoveDelay time.Duration
+	loginTtl          time.Duration
+	authTokenSha256   string
+}
+
+func newLiveConfig(cfg *ServerConfig) *liveConfig {
+	return &liveConfig{
+		compThinkTime:     cfg.CompThinkTime,
+		playerRemoveDelay: cfg.PlayerRemoveDelay,
+		loginTtl:          cfg.LoginTtl,
+		authTokenSha256:   cfg.AuthTokenSha256,
+	}
+}
+
+// Returns the current values of all settings that can be reloaded.
+func (s *Server) live() *liveConfig {
+	return s.liveCfg.Load()
+}
+
+// Loads the TLS certificate and key configured in cfg for serving.
+func (s *Server) loadTlsCert(cfg *ServerConfig) error {
+	cert, err := tls.LoadX509KeyPair(cfg.TlsCertChain, cfg.TlsPrivKey)
+	if err != nil {
+		return err
+	}
+	s.tlsCert.Store(&cert)
+	return nil
+}
+
+// Applies the settings of cfg that can be changed without a restart: think time
+// of the CPU player, player removal delay, login TTL, debug mode, auth token,
+// and the TLS certificate and key. Running games are not disturbed: CPU players
+// keep the think time they were started with. Changes to all other settings
+// are logged and ignored. Nothing is changed if cfg is invalid.
+func (s *Server) ReloadConfig(cfg *ServerConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if s.tlsCert.Load() != nil {
+		if cfg.TlsCertChain == "" {
+			return fmt.Errorf("cannot disable TLS without a restart")
+		}
+		if err := s.loadTlsCert(cfg); err != nil {
+			return fmt.Errorf("cannot load TLS certificate: %w", err)
+		}
+	} else if cfg.TlsCertChain != "" {
+		log.Printf("Ignoring TLS settings: enabling TLS requires a restart")
+	}
+	s.liveCfg.Store(newLiveConfig(cfg))
+	s.debugMode.Store(cfg.DebugMode)
+	old := s.config
+	if cfg.ServerAddress != old.ServerAddress || cfg.ServerPort != old.ServerPort ||
+		cfg.DocumentRoot != old.DocumentRoot || cfg.InstanceId != old.InstanceId ||
+		cfg.PlayerStoreDir != old.PlayerStoreDir || cfg.EventLogDir != old.EventLogDir ||
+		cfg.LevelDir != old.LevelDir || cfg.OpeningBookFile != old.OpeningBookFile ||
+		cfg.CpuRolloutPolicy != old.CpuRolloutPolicy {
+		log.Printf("Some changed settings require a restart and were ignored")
+	}
+	s.IncCounter("/config/reloaded")
+	log.Printf("Reloaded config: comp-think-time=%s remove-delay=%s login-ttl=%s debug=%t",
+		cfg.CompThinkTime, cfg.PlayerRemoveDelay, cfg.LoginTtl, cfg.DebugMode)
+	return nil
+}
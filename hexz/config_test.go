@@ -0,0 +1,118 @@
+package hexz
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestLoadServerConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"hexz.json": `{"serverPort": 9000, "compThinkTime": "2s", "debugMode": true, "peers": {"A": "http://a"}}`,
+		"hexz.yaml": "serverPort: 9000\ncompThinkTime: 2s\ndebugMode: true\npeers:\n  A: http://a\n",
+	}
+	for name, contents := range files {
+		t.Run(name, func(t *testing.T) {
+			fn := path.Join(dir, name)
+			if err := os.WriteFile(fn, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := &ServerConfig{ServerPort: 8084, LoginTtl: time.Hour}
+			if err := LoadServerConfigFile(fn, cfg); err != nil {
+				t.Fatal("Cannot load config: ", err)
+			}
+			if cfg.ServerPort != 9000 || cfg.CompThinkTime != 2*time.Second || !cfg.DebugMode || cfg.Peers["A"] != "http://a" {
+				t.Errorf("Config file settings not applied: %+v", cfg)
+			}
+			if cfg.LoginTtl != time.Hour {
+				t.Errorf("Settings missing from the file must be kept, got LoginTtl %s", cfg.LoginTtl)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"unknown.json":  `{"serverPrt": 9000}`,
+		"unknown.yaml":  "serverPrt: 9000\n",
+		"duration.json": `{"loginTtl": 3600}`,
+		"duration.yaml": "loginTtl: forever\n",
+	}
+	for name, contents := range files {
+		fn := path.Join(dir, name)
+		if err := os.WriteFile(fn, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadServerConfigFile(fn, &ServerConfig{}); err == nil {
+			t.Errorf("%s: want error, got none", name)
+		}
+	}
+}
+
+func TestServerConfigValidate(t *testing.T) {
+	valid := ServerConfig{ServerPort: 8084, AuthTokenSha256: sha256HexDigest("secret")}
+	if err := valid.Validate(); err != nil {
+		t.Fatal("Want valid config, got: ", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(cfg *ServerConfig)
+	}{
+		{"port", func(cfg *ServerConfig) { cfg.ServerPort = 70000 }},
+		{"auth token", func(cfg *ServerConfig) { cfg.AuthTokenSha256 = "secret" }},
+		{"auth token suffix", func(cfg *ServerConfig) { cfg.AuthTokenSha256 += "x" }},
+		{"negative duration", func(cfg *ServerConfig) { cfg.LoginTtl = -time.Second }},
+		{"tls key missing", func(cfg *ServerConfig) { cfg.TlsCertChain = "chain.pem" }},
+		{"rollout", func(cfg *ServerConfig) { cfg.CpuRolloutPolicy = "nope" }},
+		{"peers", func(cfg *ServerConfig) { cfg.Peers = map[string]string{"A": "http://a"} }},
+	}
+	for _, test := range tests {
+		cfg := valid
+		test.modify(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: want error, got none", test.name)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	cfg := &ServerConfig{
+		CompThinkTime:     time.Second,
+		PlayerRemoveDelay: time.Minute,
+		LoginTtl:          time.Hour,
+		LevelDir:          "levels",
+	}
+	s := NewServer(cfg)
+	reloaded := *cfg
+	reloaded.CompThinkTime = 3 * time.Second
+	reloaded.LoginTtl = 2 * time.Hour
+	reloaded.DebugMode = true
+	reloaded.AuthTokenSha256 = sha256HexDigest("secret")
+	reloaded.LevelDir = "other" // Requires a restart.
+	if err := s.ReloadConfig(&reloaded); err != nil {
+		t.Fatal("Cannot reload config: ", err)
+	}
+	l := s.live()
+	if l.compThinkTime != 3*time.Second || l.loginTtl != 2*time.Hour || l.authTokenSha256 != reloaded.AuthTokenSha256 {
+		t.Errorf("Settings not reloaded: %+v", l)
+	}
+	if !s.debugMode.Load() {
+		t.Error("Debug mode not reloaded")
+	}
+	if s.config.LevelDir != "levels" {
+		t.Errorf("Level dir must not change, got %q", s.config.LevelDir)
+	}
+	// Invalid configs are rejected as a whole.
+	invalid := reloaded
+	invalid.CompThinkTime = 10 * time.Second
+	invalid.AuthTokenSha256 = "secret"
+	if err := s.ReloadConfig(&invalid); err == nil {
+		t.Error("Want error for invalid config")
+	}
+	if s.live().compThinkTime != 3*time.Second {
+		t.Error("Invalid config was partially applied")
+	}
+}
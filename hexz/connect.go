@@ -0,0 +1,366 @@
+package hexz
+
+//
+// The Connect game: two players race to link opposite sides of a rhombus.
+//
+// Player 1 connects the top and bottom rows, player 2 the left and right sides.
+// Since the cells of a full board always connect one pair of sides (see cmd/hex42),
+// there are no draws. To balance the first player's advantage, the second player
+// may take over the first player's stone instead of making their first move (swap rule).
+//
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	connectSideLen = 11
+	// Number of columns needed to store the rhombus in offset coordinates,
+	// where every second row shifts the rhombus right by one cell.
+	connectNumCols = connectSideLen + (connectSideLen-1)/2
+	// Union-find nodes representing the four sides of the rhombus.
+	// Nodes 0 to connectSideLen^2-1 represent the cells.
+	connectTop    = connectSideLen * connectSideLen
+	connectBottom = connectTop + 1
+	connectLeft   = connectTop + 2
+	connectRight  = connectTop + 3
+	connectNodes  = connectTop + 4
+)
+
+// Disjoint sets of integers 0..n-1, used to track connected groups of stones.
+type unionFind struct {
+	parent []int16
+	rank   []uint8
+}
+
+func newUnionFind(n int) *unionFind {
+	u := &unionFind{
+		parent: make([]int16, n),
+		rank:   make([]uint8, n),
+	}
+	for i := range u.parent {
+		u.parent[i] = int16(i)
+	}
+	return u
+}
+
+func (u *unionFind) find(x int) int {
+	for int(u.parent[x]) != x {
+		// Path halving.
+		u.parent[x] = u.parent[u.parent[x]]
+		x = int(u.parent[x])
+	}
+	return x
+}
+
+func (u *unionFind) union(x, y int) {
+	x, y = u.find(x), u.find(y)
+	if x == y {
+		return
+	}
+	if u.rank[x] < u.rank[y] {
+		x, y = y, x
+	}
+	u.parent[y] = int16(x)
+	if u.rank[x] == u.rank[y] {
+		u.rank[x]++
+	}
+}
+
+func (u *unionFind) copy() *unionFind {
+	c := &unionFind{
+		parent: make([]int16, len(u.parent)),
+		rank:   make([]uint8, len(u.rank)),
+	}
+	copy(c.parent, u.parent)
+	copy(c.rank, u.rank)
+	return c
+}
+
+func init() {
+	registerGameType(&GameTypeDescriptor{
+		GameTypeInfo: GameTypeInfo{
+			Type:           gameTypeConnect,
+			DisplayText:    "\U0001F517 Connect",
+			MinPlayers:     2,
+			MaxPlayers:     2,
+			DefaultPlayers: 2,
+			SinglePlayer:   true,
+			Options:        []GameOption{difficultyOption()},
+		},
+		NewEngine: func(numPlayers int, src rand.Source) GameEngine {
+			return NewGameEngineConnect(src)
+		},
+	})
+}
+
+type GameEngineConnect struct {
+	B         *Board
+	rnd       *rand.Rand
+	uf        *unionFind
+	FreeCells int
+	winner    int
+}
+
+func (g *GameEngineConnect) GameType() GameType { return gameTypeConnect }
+func (g *GameEngineConnect) Board() *Board      { return g.B }
+func (g *GameEngineConnect) NumPlayers() int    { return 2 }
+
+func NewGameEngineConnect(src rand.Source) *GameEngineConnect {
+	g := &GameEngineConnect{rnd: rand.New(src)}
+	g.Reset()
+	return g
+}
+
+// Returns the union-find node of the cell at x, or false if x is not part of the rhombus.
+func connectNode(x idx) (int, bool) {
+	a := x.axial()
+	if a.q < 0 || a.q >= connectSideLen || a.r < 0 || a.r >= connectSideLen {
+		return 0, false
+	}
+	return a.r*connectSideLen + a.q, true
+}
+
+func (g *GameEngineConnect) Reset() {
+	flat := make([]Field, connectSideLen*connectNumCols)
+	fields := make([][]Field, connectSideLen)
+	for r := range fields {
+		fields[r] = flat[r*connectNumCols : (r+1)*connectNumCols]
+		for c := range fields[r] {
+			f := &fields[r][c]
+			if _, ok := connectNode(idx{r, c}); !ok {
+				// Cells outside of the rhombus are not part of the game.
+				f.Type = cellRock
+				continue
+			}
+			f.NextVal = [maxPlayers]int{1, 1}
+		}
+	}
+	var ps [cellTypeLen]int
+	ps[cellNormal] = -1 // unlimited
+	g.B = &Board{
+		Turn:       1, // Player 1 begins
+		FlatFields: flat,
+		Fields:     fields,
+		Score:      []int{0, 0},
+		Resources:  []ResourceInfo{{NumPieces: ps}, {NumPieces: ps}},
+		State:      Running,
+	}
+	g.uf = newUnionFind(connectNodes)
+	g.FreeCells = connectSideLen * connectSideLen
+	g.winner = 0
+}
+
+// Occupies the free cell x for player playerNum and joins it with the player's adjacent stones and sides.
+func (g *GameEngineConnect) occupy(x idx, playerNum int) {
+	b := g.B
+	f := &b.Fields[x.r][x.c]
+	f.Owner = playerNum
+	f.NextVal = [maxPlayers]int{}
+	b.Score[playerNum-1]++
+	g.FreeCells--
+	node, _ := connectNode(x)
+	a := x.axial()
+	if playerNum == 1 {
+		if a.r == 0 {
+			g.uf.union(node, connectTop)
+		}
+		if a.r == connectSideLen-1 {
+			g.uf.union(node, connectBottom)
+		}
+	} else {
+		if a.q == 0 {
+			g.uf.union(node, connectLeft)
+		}
+		if a.q == connectSideLen-1 {
+			g.uf.union(node, connectRight)
+		}
+	}
+	var ns [6]idx
+	n := b.neighbors(x, ns[:])
+	for _, nb := range ns[:n] {
+		if b.Fields[nb.r][nb.c].Owner == playerNum {
+			nbNode, _ := connectNode(nb)
+			g.uf.union(node, nbNode)
+		}
+	}
+}
+
+// Replaces the first player's only stone by one of the second player,
+// mirrored along the rhombus' diagonal so that it serves the second player's
+// direction in the same way.
+func (g *GameEngineConnect) swap(x idx) {
+	b := g.B
+	a := x.axial()
+	f := &b.Fields[x.r][x.c]
+	f.Owner = 0
+	f.NextVal = [maxPlayers]int{1, 1}
+	b.Score[0]--
+	g.FreeCells++
+	g.uf = newUnionFind(connectNodes)
+	g.occupy(axial{q: a.r, r: a.q}.idx(), 2)
+}
+
+func (g *GameEngineConnect) MakeMove(m GameEngineMove) bool {
+	b := g.B
+	if b.State != Running || m.playerNum != b.Turn || m.move != b.Move || m.cellType != cellNormal {
+		return false
+	}
+	x := idx{m.row, m.col}
+	if _, ok := connectNode(x); !ok {
+		return false
+	}
+	f := &b.Fields[x.r][x.c]
+	switch {
+	case f.Owner == 0:
+		g.occupy(x, b.Turn)
+	case b.Move == 1 && f.Owner == 1:
+		// Swap rule: the second player takes over the first stone.
+		g.swap(x)
+	default:
+		return false
+	}
+	b.Move++
+	if g.uf.find(connectTop) == g.uf.find(connectBottom) {
+		g.winner = 1
+	} else if g.uf.find(connectLeft) == g.uf.find(connectRight) {
+		g.winner = 2
+	}
+	if g.winner > 0 || g.FreeCells == 0 {
+		b.State = Finished
+		return true
+	}
+	b.Turn = 3 - b.Turn
+	return true
+}
+
+// Returns the player whose stones connect their sides, computed from scratch.
+func connectedPlayer(b *Board) int {
+	for p := 1; p <= 2; p++ {
+		comps := b.components(func(x idx) bool { return b.Fields[x.r][x.c].Owner == p })
+		for _, comp := range comps {
+			var lo, hi bool
+			for _, x := range comp {
+				a := x.axial()
+				v := a.r
+				if p == 2 {
+					v = a.q
+				}
+				lo = lo || v == 0
+				hi = hi || v == connectSideLen-1
+			}
+			if lo && hi {
+				return p
+			}
+		}
+	}
+	return 0
+}
+
+func (g *GameEngineConnect) Validate() error {
+	b := g.B
+	var v validationErrors
+	v.checkBoard(b, 2)
+	score := make([]int, 2)
+	freeCells := 0
+	var ns [6]idx
+	for r := range b.Fields {
+		for c := range b.Fields[r] {
+			x := idx{r, c}
+			f := &b.Fields[r][c]
+			node, inside := connectNode(x)
+			if !inside {
+				if f.Type != cellRock || f.Owner != 0 {
+					v.addf("cell %v outside of the rhombus is not a rock", x)
+				}
+				continue
+			}
+			if f.Type != cellNormal {
+				v.addf("cell %v has type %d", x, f.Type)
+			}
+			if f.Owner == 0 {
+				freeCells++
+				if f.NextVal != [maxPlayers]int{1, 1} {
+					v.addf("free cell %v has NextVal %v", x, f.NextVal)
+				}
+				continue
+			}
+			if f.Owner > 2 {
+				continue // Reported by checkBoard.
+			}
+			score[f.Owner-1]++
+			// Stones on the player's sides must be joined with the side's node.
+			a := x.axial()
+			lo, hi, pos := connectTop, connectBottom, a.r
+			if f.Owner == 2 {
+				lo, hi, pos = connectLeft, connectRight, a.q
+			}
+			if pos == 0 && g.uf.find(node) != g.uf.find(lo) || pos == connectSideLen-1 && g.uf.find(node) != g.uf.find(hi) {
+				v.addf("stone %v is not connected to its side", x)
+			}
+			// Adjacent stones of the same player must be in the same group.
+			n := b.neighbors(x, ns[:])
+			for _, nb := range ns[:n] {
+				if nbNode, ok := connectNode(nb); ok && b.Fields[nb.r][nb.c].Owner == f.Owner && g.uf.find(node) != g.uf.find(nbNode) {
+					v.addf("adjacent stones %v and %v are not connected", x, nb)
+				}
+			}
+		}
+	}
+	if freeCells != g.FreeCells {
+		v.addf("FreeCells is %d, want %d", g.FreeCells, freeCells)
+	}
+	for i := range score {
+		if i < len(b.Score) && b.Score[i] != score[i] {
+			v.addf("P%d has score %d, want %d", i+1, b.Score[i], score[i])
+		}
+	}
+	if want := connectedPlayer(b); g.winner != want {
+		v.addf("winner is %d, want %d", g.winner, want)
+	}
+	if done := g.winner > 0 || freeCells == 0; done != (b.State == Finished) {
+		v.addf("game is %s, but winner is %d with %d free cells", b.State, g.winner, freeCells)
+	}
+	return v.err()
+}
+
+func (g *GameEngineConnect) IsDone() bool { return g.B.State == Finished }
+
+func (g *GameEngineConnect) Winner() (playerNum int) {
+	if !g.IsDone() {
+		return 0
+	}
+	return g.winner
+}
+
+// Returns a random free cell. The swap rule is never used.
+func (g *GameEngineConnect) RandomMove() (GameEngineMove, error) {
+	b := g.B
+	if b.State != Running {
+		return GameEngineMove{}, fmt.Errorf("game is not running")
+	}
+	nth := g.rnd.Intn(g.FreeCells)
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			if b.Fields[r][c].occupied() {
+				continue
+			}
+			if nth == 0 {
+				return GameEngineMove{playerNum: b.Turn, move: b.Move, row: r, col: c, cellType: cellNormal}, nil
+			}
+			nth--
+		}
+	}
+	panic("no legal move found")
+}
+
+func (g *GameEngineConnect) Clone(s rand.Source) SinglePlayerGameEngine {
+	return &GameEngineConnect{
+		B:         g.B.copy(),
+		rnd:       rand.New(s),
+		uf:        g.uf.copy(),
+		FreeCells: g.FreeCells,
+		winner:    g.winner,
+	}
+}
@@ -0,0 +1,122 @@
+package hexz
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func connectMove(t *testing.T, g *GameEngineConnect, q, r int) {
+	t.Helper()
+	x := axial{q: q, r: r}.idx()
+	m := GameEngineMove{playerNum: g.B.Turn, move: g.B.Move, row: x.r, col: x.c, cellType: cellNormal}
+	if !g.MakeMove(m) {
+		t.Fatalf("Invalid move %s", m.String())
+	}
+}
+
+func TestConnectBoard(t *testing.T) {
+	g := NewGameEngineConnect(rand.NewSource(1))
+	free := 0
+	for _, f := range g.B.FlatFields {
+		if !f.occupied() {
+			free++
+		}
+	}
+	if free != connectSideLen*connectSideLen || g.FreeCells != free {
+		t.Errorf("Want %d free cells, got %d (FreeCells=%d)", connectSideLen*connectSideLen, free, g.FreeCells)
+	}
+	// Cells outside the rhombus cannot be played.
+	if g.MakeMove(GameEngineMove{playerNum: 1, move: 0, row: 0, col: connectNumCols - 1, cellType: cellNormal}) {
+		t.Error("Move outside of the rhombus was accepted")
+	}
+	if g.MakeMove(GameEngineMove{playerNum: 1, move: 0, row: 0, col: 0, cellType: cellFlag}) {
+		t.Error("Flag was accepted")
+	}
+}
+
+func TestConnectWinner(t *testing.T) {
+	g := NewGameEngineConnect(rand.NewSource(1))
+	for r := 0; r < connectSideLen; r++ {
+		connectMove(t, g, 0, r)
+		if g.IsDone() {
+			break
+		}
+		connectMove(t, g, connectSideLen-1, r)
+	}
+	if !g.IsDone() || g.Winner() != 1 {
+		t.Fatalf("Want player 1 to win, got done=%t winner=%d", g.IsDone(), g.Winner())
+	}
+	if _, err := g.RandomMove(); err == nil {
+		t.Error("Want no moves after the game is done")
+	}
+}
+
+func TestConnectSwap(t *testing.T) {
+	g := NewGameEngineConnect(rand.NewSource(1))
+	connectMove(t, g, 2, 5)
+	// Player 2 takes over the stone, mirrored to serve their direction.
+	connectMove(t, g, 2, 5)
+	if x := (axial{2, 5}).idx(); g.B.Fields[x.r][x.c].Owner != 0 {
+		t.Error("Swapped stone was not removed")
+	}
+	if x := (axial{5, 2}).idx(); g.B.Fields[x.r][x.c].Owner != 2 {
+		t.Error("Swapped stone was not mirrored")
+	}
+	if g.B.Score[0] != 0 || g.B.Score[1] != 1 || g.FreeCells != connectSideLen*connectSideLen-1 {
+		t.Errorf("Unexpected state after swap: score %v, %d free cells", g.B.Score, g.FreeCells)
+	}
+	// Swapping is only allowed as the second move.
+	connectMove(t, g, 0, 0)
+	x := (axial{0, 0}).idx()
+	if g.MakeMove(GameEngineMove{playerNum: 2, move: g.B.Move, row: x.r, col: x.c, cellType: cellNormal}) {
+		t.Error("Late swap was accepted")
+	}
+}
+
+func TestConnectRandomGames(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		g := NewGameEngineConnect(rand.NewSource(int64(i)))
+		for !g.IsDone() {
+			m, err := g.RandomMove()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !g.MakeMove(m) {
+				t.Fatalf("Invalid random move %s", m.String())
+			}
+			if want := connectedPlayer(g.B); want != g.Winner() {
+				t.Fatalf("Game %d, move %d: want winner %d, got %d", i, g.B.Move, want, g.Winner())
+			}
+		}
+		if g.Winner() == 0 {
+			t.Errorf("Game %d ended without a winner", i)
+		}
+	}
+}
+
+func TestConnectClone(t *testing.T) {
+	g := NewGameEngineConnect(rand.NewSource(1))
+	connectMove(t, g, 3, 3)
+	c := g.Clone(rand.NewSource(2))
+	for !c.IsDone() {
+		m, _ := c.RandomMove()
+		c.MakeMove(m)
+	}
+	if g.IsDone() || g.B.Move != 1 || g.FreeCells != connectSideLen*connectSideLen-1 {
+		t.Error("Playing the clone changed the original")
+	}
+}
+
+func TestConnectCpuPlayer(t *testing.T) {
+	g := NewGameEngineConnect(rand.NewSource(1))
+	mcts := NewMCTSFromSource(rand.NewSource(1))
+	mcts.MaxIterations = 500
+	m, stats := mcts.SuggestMove(g, time.Hour)
+	if !g.MakeMove(m) {
+		t.Fatalf("CPU suggested an invalid move %s", m.String())
+	}
+	if stats.Iterations == 0 {
+		t.Error("CPU did not search")
+	}
+}
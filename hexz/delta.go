@@ -0,0 +1,76 @@
+package hexz
+
+// Delta updates of boards sent to clients over SSE.
+//
+// Clients that opt in receive a full board as the first event of each SSE
+// connection and only the changed cells plus turn, score and resources after
+// that. Deltas are computed per connection from the boards the game master
+// sends, which are already filtered by ViewFor, so hidden fields stay hidden.
+
+// Tracks the last board sent over an SSE connection and replaces full boards by deltas.
+type deltaEncoder struct {
+	last    *BoardView // The last board sent to the client. nil if none was sent yet.
+	version int        // Version of the last board sent. Incremented with every board or delta.
+}
+
+// Returns true if f and g look the same to clients.
+func (f *Field) sameView(g *Field) bool {
+	return f.Type == g.Type && f.Owner == g.Owner && f.Hidden == g.Hidden &&
+		f.Value == g.Value && f.Blocked == g.Blocked
+}
+
+// Returns the cells that differ between old and new, or false if the boards
+// have different shapes or a delta would not be smaller than the full board.
+func boardDelta(old, new *BoardView) ([]FieldUpdate, bool) {
+	if len(old.Fields) != len(new.Fields) {
+		return nil, false
+	}
+	numFields := 0
+	var updates []FieldUpdate
+	for r := range new.Fields {
+		if len(old.Fields[r]) != len(new.Fields[r]) {
+			return nil, false
+		}
+		numFields += len(new.Fields[r])
+		for c := range new.Fields[r] {
+			if !old.Fields[r][c].sameView(&new.Fields[r][c]) {
+				updates = append(updates, FieldUpdate{Row: r, Col: c, Field: new.Fields[r][c]})
+			}
+		}
+	}
+	// Each update is several times larger than a cell of the full board.
+	if len(updates) > numFields/4 {
+		return nil, false
+	}
+	return updates, true
+}
+
+// Rewrites e to carry a delta instead of a full board, if possible.
+// A full board is sent (and marked as a resync) on the first event,
+// after resets, if e.resync is set, or if the delta would be too large.
+func (d *deltaEncoder) encode(e *ServerEvent) {
+	if e.Board == nil {
+		return
+	}
+	b := e.Board
+	d.version++
+	e.BoardVersion = d.version
+	if d.last != nil && !e.resync && b.Move >= d.last.Move {
+		if cells, ok := boardDelta(d.last, b); ok {
+			e.Board = nil
+			e.Delta = &BoardDelta{
+				BaseVersion: d.version - 1,
+				Turn:        b.Turn,
+				Move:        b.Move,
+				State:       b.State,
+				Score:       b.Score,
+				Resources:   b.Resources,
+				Fields:      cells,
+			}
+			d.last = b
+			return
+		}
+	}
+	e.Resync = true
+	d.last = b
+}
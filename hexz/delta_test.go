@@ -0,0 +1,107 @@
+package hexz
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Applies d to a copy of b, as clients do.
+func applyBoardDelta(b *BoardView, d *BoardDelta) *BoardView {
+	r := *b
+	r.Fields = make([][]Field, len(b.Fields))
+	for i := range b.Fields {
+		r.Fields[i] = make([]Field, len(b.Fields[i]))
+		copy(r.Fields[i], b.Fields[i])
+	}
+	r.Turn, r.Move, r.State, r.Score, r.Resources = d.Turn, d.Move, d.State, d.Score, d.Resources
+	for _, u := range d.Fields {
+		r.Fields[u.Row][u.Col] = u.Field
+	}
+	return &r
+}
+
+func sameBoardView(t *testing.T, want, got *BoardView) {
+	t.Helper()
+	if want.Turn != got.Turn || want.Move != got.Move || want.State != got.State {
+		t.Fatalf("Want turn/move/state %d/%d/%s, got %d/%d/%s",
+			want.Turn, want.Move, want.State, got.Turn, got.Move, got.State)
+	}
+	for r := range want.Fields {
+		for c := range want.Fields[r] {
+			if !want.Fields[r][c].sameView(&got.Fields[r][c]) {
+				t.Fatalf("Field (%d,%d): want %+v, got %+v", r, c, want.Fields[r][c], got.Fields[r][c])
+			}
+		}
+	}
+}
+
+func TestDeltaEncoder(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	var enc deltaEncoder
+	e := ServerEvent{Board: ge.B.ViewFor(1)}
+	enc.encode(&e)
+	if e.Board == nil || !e.Resync || e.Delta != nil {
+		t.Fatalf("First event must be a full board: %+v", e)
+	}
+	client := e.Board
+	version := e.BoardVersion
+	for i := 0; i < 20 && !ge.IsDone(); i++ {
+		m, _ := ge.RandomMove()
+		ge.MakeMove(m)
+		view := ge.B.ViewFor(1)
+		e := ServerEvent{Board: view}
+		enc.encode(&e)
+		if e.Delta == nil {
+			t.Fatalf("Move %d: want a delta, got a full board", i)
+		}
+		if e.Delta.BaseVersion != version || e.BoardVersion != version+1 {
+			t.Fatalf("Move %d: want versions %d->%d, got %d->%d",
+				i, version, version+1, e.Delta.BaseVersion, e.BoardVersion)
+		}
+		version = e.BoardVersion
+		client = applyBoardDelta(client, e.Delta)
+		sameBoardView(t, view, client)
+	}
+	// Events without a board are not touched.
+	ping := ServerEvent{DebugMessage: "ping"}
+	enc.encode(&ping)
+	if ping.BoardVersion != 0 || ping.Delta != nil || ping.Resync {
+		t.Errorf("Ping event was modified: %+v", ping)
+	}
+	// Explicit resyncs and resets send the full board.
+	e = ServerEvent{Board: ge.B.ViewFor(1), resync: true}
+	enc.encode(&e)
+	if e.Board == nil || !e.Resync {
+		t.Error("Want full board on resync")
+	}
+	ge.Reset()
+	e = ServerEvent{Board: ge.B.ViewFor(1)}
+	enc.encode(&e)
+	if e.Board == nil || !e.Resync {
+		t.Error("Want full board after reset")
+	}
+}
+
+func TestDeltaHonorsHiddenFields(t *testing.T) {
+	ge := &GameEngineClassic{}
+	ge.Init()
+	var enc deltaEncoder
+	e := ServerEvent{Board: ge.Board().ViewFor(2)}
+	enc.encode(&e)
+	if !ge.MakeMove(GameEngineMove{playerNum: 1, move: 0, row: 3, col: 3, cellType: cellNormal}) {
+		t.Fatal("Cannot make move")
+	}
+	if f := ge.Board().Fields[3][3]; !f.Hidden {
+		t.Fatalf("Want a hidden field, got %+v", f)
+	}
+	e = ServerEvent{Board: ge.Board().ViewFor(2)}
+	enc.encode(&e)
+	if e.Delta == nil {
+		t.Fatal("Want a delta")
+	}
+	for _, u := range e.Delta.Fields {
+		if u.Field.Owner == 1 {
+			t.Errorf("Delta for player 2 reveals player 1's hidden field: %+v", u)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package hexz
+
+// Difficulty levels of the CPU player.
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+type difficultyLevel struct {
+	Name          string
+	MaxIterations int     // MCTS iteration budget per move. Only CompThinkTime limits the search if 0.
+	UctFactor     float64 // Higher values spread the search more thinly.
+	Rollout       string  // Rollout policy spec. The server's CPU rollout policy is used if empty.
+	// Temperature used to pick a move from the root visit counts: each move is
+	// chosen with probability proportional to visits^(1/Temperature).
+	// 0 always plays the best move.
+	Temperature float64
+	BlunderRate float64 // Probability of playing a uniformly random move instead of the chosen one.
+	Exact       bool    // If true, the opening book and endgame solver are used.
+}
+
+const defaultDifficulty = "hard"
+
+// All difficulty levels, from weakest to strongest.
+var difficultyLevels = []*difficultyLevel{
+	{Name: "beginner", MaxIterations: 200, UctFactor: 1.5, Rollout: "uniform", Temperature: 1.0, BlunderRate: 0.15},
+	{Name: "easy", MaxIterations: 1000, UctFactor: 1.2, Rollout: "uniform", Temperature: 0.5, BlunderRate: 0.05},
+	{Name: "medium", MaxIterations: 5000, UctFactor: 1.0, Rollout: "epsgreedy:0.3", Temperature: 0.2},
+	{Name: "hard", UctFactor: 1.0, Exact: true},
+}
+
+// Returns the level's name, or "" for a nil level.
+func (l *difficultyLevel) String() string {
+	if l == nil {
+		return ""
+	}
+	return l.Name
+}
+
+func lookupDifficulty(name string) (*difficultyLevel, error) {
+	for _, l := range difficultyLevels {
+		if l.Name == name {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid difficulty %q", name)
+}
+
+// Configures mcts according to the difficulty level. defaultRollout is used if the level does not specify one.
+func (l *difficultyLevel) configure(mcts *MCTS, defaultRollout RolloutPolicy) error {
+	mcts.UctFactor = l.UctFactor
+	mcts.MaxIterations = l.MaxIterations
+	mcts.Rollout = defaultRollout
+	if l.Rollout != "" {
+		r, err := ParseRolloutPolicy(l.Rollout)
+		if err != nil {
+			return err
+		}
+		mcts.Rollout = r
+	}
+	if !l.Exact {
+		mcts.EndgameFreeCells = 0
+		mcts.EndgameMoves = 0
+	}
+	return nil
+}
+
+// Picks the move to play from the search results according to the level's
+// temperature and blunder rate. best is the move suggested by the search.
+func (l *difficultyLevel) selectMove(best GameEngineMove, stats *MCTSStats, rnd *rand.Rand) GameEngineMove {
+	if len(stats.Moves) < 2 {
+		return best
+	}
+	move := func(s *MCTSMoveStats) GameEngineMove {
+		return GameEngineMove{playerNum: best.playerNum, move: best.move, row: s.row, col: s.col, cellType: s.cellType}
+	}
+	if l.BlunderRate > 0 && rnd.Float64() < l.BlunderRate {
+		return move(&stats.Moves[rnd.Intn(len(stats.Moves))])
+	}
+	if l.Temperature <= 0 {
+		return best
+	}
+	weights := make([]float64, len(stats.Moves))
+	total := 0.0
+	for i, s := range stats.Moves {
+		weights[i] = math.Pow(float64(s.iterations), 1/l.Temperature)
+		total += weights[i]
+	}
+	if total == 0 || math.IsInf(total, 0) || math.IsNaN(total) {
+		return best
+	}
+	x := rnd.Float64() * total
+	for i := range stats.Moves {
+		x -= weights[i]
+		if x < 0 {
+			return move(&stats.Moves[i])
+		}
+	}
+	return best
+}
@@ -0,0 +1,58 @@
+package hexz
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestLookupDifficulty(t *testing.T) {
+	for _, l := range difficultyLevels {
+		got, err := lookupDifficulty(l.Name)
+		if err != nil || got != l {
+			t.Errorf("Cannot look up level %q: %v", l.Name, err)
+		}
+		mcts := NewMCTSFromSource(rand.NewSource(0))
+		if err := l.configure(mcts, UniformRolloutPolicy{}); err != nil {
+			t.Errorf("Cannot configure level %q: %s", l.Name, err)
+		}
+	}
+	if _, err := lookupDifficulty("impossible"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+	if _, err := lookupDifficulty(defaultDifficulty); err != nil {
+		t.Error("Default difficulty does not exist")
+	}
+}
+
+func TestDifficultySelectMove(t *testing.T) {
+	best := GameEngineMove{playerNum: 1, move: 7, row: 0, col: 0}
+	stats := &MCTSStats{
+		Moves: []MCTSMoveStats{
+			{row: 0, col: 0, iterations: 300},
+			{row: 1, col: 1, iterations: 100},
+		},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	strong := &difficultyLevel{Name: "strong"}
+	for i := 0; i < 100; i++ {
+		if m := strong.selectMove(best, stats, rnd); m != best {
+			t.Fatalf("Zero temperature level played %s", m.String())
+		}
+	}
+	// With temperature 1, moves are picked proportionally to their visits.
+	weak := &difficultyLevel{Name: "weak", Temperature: 1}
+	n := 10000
+	other := 0
+	for i := 0; i < n; i++ {
+		m := weak.selectMove(best, stats, rnd)
+		if m.playerNum != best.playerNum || m.move != best.move {
+			t.Fatalf("Selected move is not for the current position: %s", m.String())
+		}
+		if m.row == 1 {
+			other++
+		}
+	}
+	if f := float64(other) / float64(n); f < 0.2 || f > 0.3 {
+		t.Errorf("Want second move in ~25%% of cases, got %.3f", f)
+	}
+}
@@ -0,0 +1,265 @@
+package hexz
+
+// Exact endgame solver for Flagz.
+//
+// Once only a few free cells are left, the game tree is small enough to be
+// searched completely. The solver uses alpha-beta search over the three
+// possible outcomes (player 1 wins, draw, player 2 wins) and a transposition
+// table keyed by the board's hash.
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Values of solved positions, from player 1's point of view.
+const (
+	endgameP2Wins = -1
+	endgameDraw   = 0
+	endgameP1Wins = 1
+)
+
+const (
+	// The transposition table is cleared when it grows beyond this many entries.
+	endgameMaxTableSize = 1 << 20
+	// Default node budget for solving the root position, if none is configured.
+	// Visiting a node takes a few microseconds.
+	defaultEndgameMaxNodes = 200_000
+	// Positions inside the MCTS tree get a fraction of the root's budget, since
+	// there are many of them and a failed attempt is wasted time.
+	endgameInTreeBudgetDivisor = 100
+	// The solver checks its deadline every endgameTimeCheckNodes positions.
+	// Must be a power of two.
+	endgameTimeCheckNodes = 1024
+)
+
+var (
+	errEndgameBudget  = errors.New("endgame node budget exceeded")
+	errEndgameTimeout = errors.New("endgame deadline exceeded")
+)
+
+type ttBound int8
+
+const (
+	ttExact ttBound = iota
+	ttLower         // The position's value is at least the stored value.
+	ttUpper         // The position's value is at most the stored value.
+)
+
+type ttEntry struct {
+	value int8
+	bound ttBound
+}
+
+type endgameSolver struct {
+	maxNodes int       // Maximum number of positions to visit in the current call. Unlimited if 0.
+	deadline time.Time // End of the current call. Unlimited if zero.
+	nodes    int
+	tt       map[uint64]ttEntry
+}
+
+// A root move together with its proven outcome.
+type solvedMove struct {
+	move   GameEngineMove
+	winner int // 0 for a draw.
+}
+
+func newEndgameSolver() *endgameSolver {
+	return &endgameSolver{
+		tt: make(map[uint64]ttEntry),
+	}
+}
+
+func endgameValue(winner int) int {
+	switch winner {
+	case 1:
+		return endgameP1Wins
+	case 2:
+		return endgameP2Wins
+	}
+	return endgameDraw
+}
+
+func endgameWinner(value int) int {
+	switch value {
+	case endgameP1Wins:
+		return 1
+	case endgameP2Wins:
+		return 2
+	}
+	return 0
+}
+
+// Returns the number of legal moves of the player whose turn it is.
+func (g *GameEngineFlagz) numLegalMoves() int {
+	pIdx := g.B.Turn - 1
+	n := g.NormalMoves[pIdx]
+	if g.B.Resources[pIdx].NumPieces[cellFlag] > 0 {
+		n += g.FreeCells
+	}
+	return n
+}
+
+// Returns all legal moves of the player whose turn it is.
+// Normal moves come first, ordered by descending value, since they are usually stronger.
+func (g *GameEngineFlagz) legalMoves() []GameEngineMove {
+	b := g.B
+	pIdx := b.Turn - 1
+	hasFlag := b.Resources[pIdx].NumPieces[cellFlag] > 0
+	moves := make([]GameEngineMove, 0, g.numLegalMoves())
+	var flags []GameEngineMove
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			f := &b.Fields[r][c]
+			if f.occupied() {
+				continue
+			}
+			if f.isAvail(b.Turn) {
+				moves = append(moves, flagzMove(b, r, c, cellNormal))
+			}
+			if hasFlag {
+				flags = append(flags, flagzMove(b, r, c, cellFlag))
+			}
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		fi := &b.Fields[moves[i].row][moves[i].col]
+		fj := &b.Fields[moves[j].row][moves[j].col]
+		return fi.NextVal[pIdx] > fj.NextVal[pIdx]
+	})
+	return append(moves, flags...)
+}
+
+// Returns a copy of g that shares g's source of randomness.
+// Only used for search, which never calls RandomMove.
+func (g *GameEngineFlagz) searchCopy() *GameEngineFlagz {
+	return &GameEngineFlagz{
+		B:           g.B.copy(),
+		FreeCells:   g.FreeCells,
+		NormalMoves: g.NormalMoves,
+		numPlayers:  g.numPlayers,
+		level:       g.level,
+		rnd:         g.rnd,
+	}
+}
+
+func (s *endgameSolver) timedOut() bool {
+	return !s.deadline.IsZero() && time.Now().After(s.deadline)
+}
+
+func (s *endgameSolver) search(g *GameEngineFlagz, alpha, beta int) (int, error) {
+	if g.IsDone() {
+		return endgameValue(g.Winner()), nil
+	}
+	s.nodes++
+	if s.maxNodes > 0 && s.nodes > s.maxNodes {
+		return 0, errEndgameBudget
+	}
+	if s.nodes&(endgameTimeCheckNodes-1) == 0 && s.timedOut() {
+		return 0, errEndgameTimeout
+	}
+	key := g.B.symmetricHash(0)
+	if e, ok := s.tt[key]; ok {
+		v := int(e.value)
+		switch e.bound {
+		case ttExact:
+			return v, nil
+		case ttLower:
+			if v > alpha {
+				alpha = v
+			}
+		case ttUpper:
+			if v < beta {
+				beta = v
+			}
+		}
+		if alpha >= beta {
+			return v, nil
+		}
+	}
+	alpha0, beta0 := alpha, beta
+	maximizing := g.B.Turn == 1
+	best := endgameP1Wins
+	if maximizing {
+		best = endgameP2Wins
+	}
+	for _, m := range g.legalMoves() {
+		child := g.searchCopy()
+		if !child.MakeMove(m) {
+			panic("Invalid move in endgame search: " + m.String())
+		}
+		v, err := s.search(child, alpha, beta)
+		if err != nil {
+			return 0, err
+		}
+		if maximizing && v > best {
+			best = v
+			if best > alpha {
+				alpha = best
+			}
+		} else if !maximizing && v < best {
+			best = v
+			if best < beta {
+				beta = best
+			}
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	bound := ttExact
+	if best <= alpha0 {
+		bound = ttUpper
+	} else if best >= beta0 {
+		bound = ttLower
+	}
+	if len(s.tt) >= endgameMaxTableSize {
+		s.tt = make(map[uint64]ttEntry)
+	}
+	s.tt[key] = ttEntry{value: int8(best), bound: bound}
+	return best, nil
+}
+
+// Solves the position of g, visiting at most maxNodes positions (unlimited if 0)
+// and stopping at deadline (unlimited if zero).
+// Returns the winner under perfect play (0 for a draw), or false if the budget was exceeded.
+func (s *endgameSolver) solve(g *GameEngineFlagz, maxNodes int, deadline time.Time) (winner int, ok bool) {
+	s.nodes = 0
+	s.maxNodes = maxNodes
+	s.deadline = deadline
+	if s.timedOut() {
+		return 0, false
+	}
+	// The window is wider than the range of values, so the result is exact.
+	v, err := s.search(g, endgameP2Wins-1, endgameP1Wins+1)
+	if err != nil {
+		return 0, false
+	}
+	return endgameWinner(v), true
+}
+
+// Solves each legal move of the position of g. Returns false if more than
+// maxNodes positions (unlimited if 0) would have to be visited for all moves together,
+// or if the moves are not solved by deadline (unlimited if zero).
+func (s *endgameSolver) solveMoves(g *GameEngineFlagz, maxNodes int, deadline time.Time) ([]solvedMove, bool) {
+	s.nodes = 0
+	s.maxNodes = maxNodes
+	s.deadline = deadline
+	if s.timedOut() {
+		return nil, false
+	}
+	var result []solvedMove
+	for _, m := range g.legalMoves() {
+		child := g.searchCopy()
+		if !child.MakeMove(m) {
+			panic("Invalid move in endgame search: " + m.String())
+		}
+		v, err := s.search(child, endgameP2Wins-1, endgameP1Wins+1)
+		if err != nil {
+			return nil, false
+		}
+		result = append(result, solvedMove{move: m, winner: endgameWinner(v)})
+	}
+	return result, true
+}
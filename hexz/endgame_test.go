@@ -0,0 +1,144 @@
+package hexz
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Returns a position of a random game in which all but freeCells free cells were turned into rocks.
+func flagzEndgamePosition(t *testing.T, seed int64, freeCells int) *GameEngineFlagz {
+	t.Helper()
+	ge := NewGameEngineFlagz(rand.NewSource(seed))
+	for i := 0; i < 20 && !ge.IsDone(); i++ {
+		m, _ := ge.RandomMove()
+		ge.MakeMove(m)
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	for _, k := range rnd.Perm(len(ge.B.FlatFields)) {
+		f := &ge.B.FlatFields[k]
+		if !f.occupied() {
+			if freeCells > 0 {
+				freeCells--
+			} else {
+				f.Type = cellRock
+			}
+		}
+	}
+	ge.recomputeDerivedState()
+	ge.recomputeState()
+	if ge.IsDone() {
+		t.Fatalf("Game with seed %d is already over", seed)
+	}
+	return ge
+}
+
+// Plain minimax without pruning. Results are memoized by board hash.
+func minimaxWinner(g *GameEngineFlagz, memo map[uint64]int) int {
+	if g.IsDone() {
+		return g.Winner()
+	}
+	key := g.B.symmetricHash(0)
+	if w, ok := memo[key]; ok {
+		return w
+	}
+	best := endgameP1Wins
+	if g.B.Turn == 1 {
+		best = endgameP2Wins
+	}
+	for _, m := range g.legalMoves() {
+		child := g.searchCopy()
+		child.MakeMove(m)
+		v := endgameValue(minimaxWinner(child, memo))
+		if g.B.Turn == 1 && v > best || g.B.Turn == 2 && v < best {
+			best = v
+		}
+	}
+	memo[key] = endgameWinner(best)
+	return memo[key]
+}
+
+func TestEndgameSolverMatchesMinimax(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		ge := flagzEndgamePosition(t, seed, 6)
+		want := minimaxWinner(ge, make(map[uint64]int))
+		got, ok := newEndgameSolver().solve(ge, 0, time.Time{})
+		if !ok {
+			t.Fatalf("Seed %d: solver gave up without a budget", seed)
+		}
+		if got != want {
+			t.Errorf("Seed %d: want winner %d, got %d", seed, want, got)
+		}
+	}
+}
+
+func TestEndgameSolverBudget(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	if _, ok := newEndgameSolver().solve(ge, 100, time.Time{}); ok {
+		t.Error("Solved the initial position with a budget of 100 nodes")
+	}
+}
+
+func TestEndgameSolverDeadline(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	if _, ok := newEndgameSolver().solve(ge, 0, time.Now()); ok {
+		t.Error("Solved the initial position after the deadline")
+	}
+}
+
+func TestMCTSStopsEndgameSolverAtDeadline(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	mcts := NewMCTSFromSource(rand.NewSource(1))
+	// Try to solve the initial position, which cannot be done in time.
+	mcts.EndgameFreeCells = numBoardFields
+	mcts.EndgameMaxNodes = 1 << 40
+	started := time.Now()
+	m, stats := mcts.SuggestMove(ge, 50*time.Millisecond)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("SuggestMove took %v, want about 50ms", elapsed)
+	}
+	if stats.Proven {
+		t.Error("Initial position should not have been solved")
+	}
+	if !ge.MakeMove(m) {
+		t.Errorf("Cannot make move %s", m.String())
+	}
+}
+
+func TestMCTSSuggestsProvenMove(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		ge := flagzEndgamePosition(t, seed, 6)
+		want := minimaxWinner(ge, make(map[uint64]int))
+		mcts := NewMCTSFromSource(rand.NewSource(seed))
+		mcts.EndgameFreeCells = 6
+		m, stats := mcts.SuggestMove(ge, time.Hour)
+		if !stats.Proven {
+			t.Fatalf("Seed %d: move not proven", seed)
+		}
+		if stats.ProvenWinner != want {
+			t.Errorf("Seed %d: want proven winner %d, got %d", seed, want, stats.ProvenWinner)
+		}
+		// The suggested move must preserve the proven result.
+		if !ge.MakeMove(m) {
+			t.Fatalf("Seed %d: cannot make move %s", seed, m.String())
+		}
+		if got := minimaxWinner(ge, make(map[uint64]int)); got != want {
+			t.Errorf("Seed %d: suggested move %s leads to winner %d, want %d", seed, m.String(), got, want)
+		}
+	}
+}
+
+func TestMCTSTreatsProvenNodesAsTerminal(t *testing.T) {
+	ge := flagzEndgamePosition(t, 3, 10)
+	mcts := NewMCTSFromSource(rand.NewSource(3))
+	mcts.MaxIterations = 1000
+	mcts.EndgameFreeCells = 8
+	_, stats := mcts.SuggestMove(ge, time.Hour)
+	if stats.Proven {
+		t.Fatal("Root should not have been solved")
+	}
+	// Proven nodes are never expanded, so the whole tree gets explored quickly.
+	if !stats.FullyExplored {
+		t.Errorf("Tree not fully explored after %d iterations", stats.Iterations)
+	}
+}
@@ -3,20 +3,24 @@ package hexz
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 )
 
 const (
 	numFieldsFirstRow = 10
 	numBoardRows      = 11
+	// Number of cells of a standard board. Odd rows have one cell less than even rows.
+	numBoardFields = numFieldsFirstRow*((numBoardRows+1)/2) + (numFieldsFirstRow-1)*(numBoardRows/2)
+	maxPlayers     = 4 // Maximum number of players any game type supports.
 )
 
 type Board struct {
 	Turn         int
 	Move         int
 	LastRevealed int       // Move at which fields were last revealed
-	FlatFields   []Field   // The 1-d array backing the "2d" Fields.
+	FlatFields   []Field   `json:"-"` // The 1-d array backing the "2d" Fields.
 	Fields       [][]Field // The board's fields. Subslices of FlatFields.
-	Score        []int     // Depending on the number of players, 1 or 2 elements.
+	Score        []int     // One element per player.
 	Resources    []ResourceInfo
 	State        GameState
 }
@@ -29,6 +33,10 @@ type GameEngine interface {
 	IsDone() bool
 	Winner() (playerNum int) // Results are only meaningful if IsDone() is true. 0 for draw.
 	GameType() GameType
+	// Recomputes all state the engine maintains incrementally from scratch and
+	// returns an error describing every discrepancy, or nil if there is none.
+	// Expensive, so only meant for debugging and tests.
+	Validate() error
 }
 
 type SinglePlayerGameEngine interface {
@@ -48,19 +56,15 @@ const (
 	gameTypeClassic  GameType = "Classic"
 	gameTypeFlagz    GameType = "Flagz"
 	gameTypeFreeform GameType = "Freeform"
+	gameTypeConnect  GameType = "Connect"
 )
 
-func validGameType(gameType string) bool {
-	allGameTypes := map[GameType]bool{
-		gameTypeClassic:  true,
-		gameTypeFlagz:    true,
-		gameTypeFreeform: true,
-	}
-	return allGameTypes[GameType(gameType)]
-}
-
-func supportsSinglePlayer(t GameType) bool {
-	return t == gameTypeFlagz
+// Colors of the players' cells, in player order.
+var playerColorPalette = [maxPlayers]PlayerColors{
+	{Cell: "#255ab4", Hidden: "#92acd9", Icon: "#1e1e1e"}, // Blue
+	{Cell: "#f8d748", Hidden: "#fbeba3", Icon: "#7a6505"}, // Yellow
+	{Cell: "#c8433a", Hidden: "#e3a19c", Icon: "#1e1e1e"}, // Red
+	{Cell: "#3a9a5b", Hidden: "#9cccad", Icon: "#1e1e1e"}, // Green
 }
 
 // Each player has a different view of the board. In particular, player A
@@ -87,13 +91,19 @@ func (b *Board) ViewFor(playerNum int) *BoardView {
 			}
 		}
 	}
+	// Single player boards still use two colors, one for each turn.
+	numColors := len(b.Score)
+	if numColors < 2 {
+		numColors = 2
+	}
 	return &BoardView{
-		Turn:      b.Turn,
-		Move:      b.Move,
-		Score:     score,
-		Resources: resources,
-		State:     b.State,
-		Fields:    fields,
+		Turn:         b.Turn,
+		Move:         b.Move,
+		Score:        score,
+		Resources:    resources,
+		State:        b.State,
+		Fields:       fields,
+		PlayerColors: playerColorPalette[:numColors],
 	}
 }
 
@@ -131,35 +141,66 @@ type GameEngineMove struct {
 	cellType  CellType
 }
 
+// Collects the discrepancies found by an engine's Validate method.
+type validationErrors []string
+
+func (v *validationErrors) addf(format string, args ...any) {
+	*v = append(*v, fmt.Sprintf(format, args...))
+}
+
+func (v validationErrors) err() error {
+	const maxErrors = 10
+	if len(v) == 0 {
+		return nil
+	}
+	if len(v) > maxErrors {
+		v = append(v[:maxErrors:maxErrors], fmt.Sprintf("and %d more", len(v)-maxErrors))
+	}
+	return fmt.Errorf("invalid engine state: %s", strings.Join(v, "; "))
+}
+
+// Checks the fields of b that are the same for all engines: turn, score and resources.
+func (v *validationErrors) checkBoard(b *Board, numPlayers int) {
+	if b.Turn < 1 || b.Turn > numPlayers {
+		v.addf("turn %d out of range", b.Turn)
+	}
+	if len(b.Score) != numPlayers || len(b.Resources) != numPlayers {
+		v.addf("want score and resources for %d players, got %d and %d", numPlayers, len(b.Score), len(b.Resources))
+	}
+	for i, r := range b.Resources {
+		for ct, n := range r.NumPieces {
+			if n < -1 {
+				v.addf("P%d has %d pieces of type %d", i+1, n, ct)
+			}
+		}
+	}
+	for i, f := range b.FlatFields {
+		if !f.Type.valid() || f.Owner < 0 || f.Owner > numPlayers {
+			v.addf("field %d has invalid type %d or owner %d", i, f.Type, f.Owner)
+		}
+	}
+}
+
 func (m *GameEngineMove) String() string {
 	return fmt.Sprintf("P%d@%d (%d,%d/%d)", m.playerNum, m.move, m.row, m.col, m.cellType)
 }
 
-// Dispatches on the gameType to create a corresponding GameEngine.
-// The returned GameEngine is initialized and ready to play.
-func NewGameEngine(gameType GameType, src rand.Source) GameEngine {
-	var ge GameEngine
-	switch gameType {
-	case gameTypeClassic:
-		gec := &GameEngineClassic{}
-		gec.Init()
-		ge = gec
-	case gameTypeFlagz:
-		ge = NewGameEngineFlagz(src)
-	case gameTypeFreeform:
-		gef := &GameEngineFreeform{}
-		gef.Init()
-		ge = gef
-	default:
+// Creates an initialized GameEngine of the given game type for numPlayers players.
+// numPlayers must be within the game type's playerCountRange, or 0 to use the game type's default.
+func NewGameEngine(gameType GameType, numPlayers int, src rand.Source) GameEngine {
+	d := lookupGameType(gameType)
+	if d == nil {
 		panic("Unconsidered game type: " + gameType)
 	}
-	return ge
+	if numPlayers == 0 {
+		numPlayers = d.DefaultPlayers
+	}
+	return d.NewEngine(numPlayers, src)
 }
 
 // Creates a new, empty 2d field array.
 func makeFields() ([]Field, [][]Field) {
-	const numFields = numFieldsFirstRow*((numBoardRows+1)/2) + (numFieldsFirstRow-1)*(numBoardRows/2)
-	flat := make([]Field, numFields)
+	flat := make([]Field, numBoardFields)
 	fields := make([][]Field, numBoardRows)
 	start := 0
 	for i := 0; i < len(fields); i++ {
@@ -205,38 +246,6 @@ func (b *Board) valid(x idx) bool {
 	return x.r >= 0 && x.r < len(b.Fields) && x.c >= 0 && x.c < len(b.Fields[x.r])
 }
 
-// Populates ns with valid indices of all neighbor cells. Returns the number of neighbor cells.
-// ns must have enough capacity to hold all neighbors. You should pass in a [6]idx slice.
-func (b *Board) neighbors(x idx, ns []idx) int {
-	shift := x.r & 1 // Depending on the row, neighbors below and above are shifted.
-	k := 0
-	ns[k] = idx{x.r, x.c + 1}
-	if b.valid(ns[k]) {
-		k++
-	}
-	ns[k] = idx{x.r - 1, x.c + shift}
-	if b.valid(ns[k]) {
-		k++
-	}
-	ns[k] = idx{x.r - 1, x.c - 1 + shift}
-	if b.valid(ns[k]) {
-		k++
-	}
-	ns[k] = idx{x.r, x.c - 1}
-	if b.valid(ns[k]) {
-		k++
-	}
-	ns[k] = idx{x.r + 1, x.c - 1 + shift}
-	if b.valid(ns[k]) {
-		k++
-	}
-	ns[k] = idx{x.r + 1, x.c + shift}
-	if b.valid(ns[k]) {
-		k++
-	}
-	return k
-}
-
 func scoreBasedSingleWinner(score []int) (playerNum int) {
 	maxIdx := -1
 	maxScore := -1
@@ -0,0 +1,235 @@
+package hexz
+
+// Structured logging of game lifecycle events for offline analysis.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+type GameEventType string
+
+const (
+	gameEventCreated      GameEventType = "created"
+	gameEventPlayerJoined GameEventType = "player_joined"
+	gameEventPlayerLeft   GameEventType = "player_left"
+	gameEventMove         GameEventType = "move"
+	gameEventReset        GameEventType = "reset"
+	gameEventResult       GameEventType = "result"
+)
+
+// A single record in the game event log. Each record is written as one line of JSON.
+// Fields that are not relevant for a given event type are omitted.
+type GameEvent struct {
+	Timestamp  time.Time     `json:"timestamp"`
+	GameId     string        `json:"gameId"`
+	GameType   GameType      `json:"gameType"`
+	Type       GameEventType `json:"type"`
+	PlayerNum  int           `json:"playerNum,omitempty"`
+	PlayerName string        `json:"playerName,omitempty"`
+	Host       string        `json:"host,omitempty"`
+	NumPlayers int           `json:"numPlayers,omitempty"` // Only set for created events.
+	// Only set for games against the computer.
+	SinglePlayer bool             `json:"singlePlayer,omitempty"`
+	Seeds        *GameSeeds       `json:"seeds,omitempty"`      // Only set for created events.
+	Difficulty   string           `json:"difficulty,omitempty"` // CPU difficulty of single player games.
+	Level        string           `json:"level,omitempty"`      // Level of Flagz games started from one. Only set for created events.
+	Move         *GameEventMove   `json:"move,omitempty"`       // Only set for move events.
+	Result       *GameEventResult `json:"result,omitempty"`     // Only set for result events.
+}
+
+type GameEventMove struct {
+	Move       int      `json:"move"`
+	Row        int      `json:"row"`
+	Col        int      `json:"col"`
+	CellType   CellType `json:"cellType"`
+	MoveTimeMs int64    `json:"moveTimeMs"`           // Time since the previous move (or game start).
+	Confidence float64  `json:"confidence,omitempty"` // CPU player's confidence in winning.
+	Iterations int      `json:"iterations,omitempty"` // Number of MCTS iterations used by the CPU player.
+}
+
+type GameEventResult struct {
+	Winner int   `json:"winner"` // 0 for a draw.
+	Score  []int `json:"score"`
+}
+
+// Receives game events. Implementations must be safe for concurrent use,
+// since every game master goroutine writes to the same sink.
+type GameEventSink interface {
+	Write(e *GameEvent) error
+	Close() error
+}
+
+// Sink that discards all events. Used if no event log is configured.
+type nopGameEventSink struct{}
+
+func (nopGameEventSink) Write(e *GameEvent) error { return nil }
+func (nopGameEventSink) Close() error             { return nil }
+
+// Writes game events as JSON lines to files in a directory.
+// A new file is started whenever the current one would exceed maxBytes
+// or when the day changes, so old files can be archived or deleted safely.
+type RotatingFileSink struct {
+	dir      string
+	maxBytes int64
+
+	mut     sync.Mutex
+	f       *os.File
+	size    int64
+	day     string
+	closed  bool
+	nowFunc func() time.Time // Replaceable for tests.
+}
+
+var errSinkClosed = errors.New("game event sink is closed")
+
+func NewRotatingFileSink(dir string, maxBytes int64) (*RotatingFileSink, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("maxBytes must be positive")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create event log directory: %w", err)
+	}
+	return &RotatingFileSink{
+		dir:      dir,
+		maxBytes: maxBytes,
+		nowFunc:  time.Now,
+	}, nil
+}
+
+func (s *RotatingFileSink) rotate(now time.Time) error {
+	if s.f != nil {
+		if err := s.f.Close(); err != nil {
+			return err
+		}
+		s.f = nil
+	}
+	// Nanoseconds make file names unique even if we rotate several times per second.
+	name := path.Join(s.dir, fmt.Sprintf("events-%s-%09d.jsonl", now.Format("20060102-150405"), now.Nanosecond()))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	s.size = 0
+	s.day = now.Format("20060102")
+	return nil
+}
+
+func (s *RotatingFileSink) Write(e *GameEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.closed {
+		return errSinkClosed
+	}
+	now := s.nowFunc()
+	if s.f == nil || s.day != now.Format("20060102") ||
+		(s.size > 0 && s.size+int64(len(data)) > s.maxBytes) {
+		if err := s.rotate(now); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+// Flushes the current file to disk and closes it. Later writes fail.
+func (s *RotatingFileSink) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.closed = true
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	return err
+}
+
+// Reads all events from a file written by RotatingFileSink.
+func ReadGameEvents(filename string) ([]*GameEvent, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	var events []*GameEvent
+	for dec.More() {
+		e := &GameEvent{}
+		if err := dec.Decode(e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Replays the events of the given game and returns the board after each move,
+// starting with the initial board. Games started from a level need it in levels,
+// looked up by name. Returns an error if the game's created event is missing or
+// a logged move is rejected by the game engine.
+func ReplayGame(events []*GameEvent, gameId string, levels []*Level) ([]*Board, error) {
+	var ge GameEngine
+	var boards []*Board
+	for _, e := range events {
+		if e.GameId != gameId {
+			continue
+		}
+		switch e.Type {
+		case gameEventCreated:
+			if e.Seeds == nil {
+				return nil, fmt.Errorf("game %s was created without seeds", gameId)
+			}
+			ge = NewGameEngine(e.GameType, e.NumPlayers, rand.NewSource(e.Seeds.Engine))
+			if e.Level != "" {
+				var level *Level
+				for _, l := range levels {
+					if l.Name == e.Level {
+						level = l
+						break
+					}
+				}
+				flagz, ok := ge.(*GameEngineFlagz)
+				if level == nil || !ok {
+					return nil, fmt.Errorf("game %s uses unknown level %q", gameId, e.Level)
+				}
+				flagz.SetLevel(level)
+			}
+			boards = append(boards, ge.Board().copy())
+		case gameEventMove:
+			if ge == nil {
+				return nil, fmt.Errorf("game %s has moves before it was created", gameId)
+			}
+			m := e.Move
+			if m == nil || !ge.MakeMove(GameEngineMove{playerNum: e.PlayerNum, move: m.Move, row: m.Row, col: m.Col, cellType: m.CellType}) {
+				return nil, fmt.Errorf("game %s: invalid move by P%d at %s", gameId, e.PlayerNum, e.Timestamp.Format(time.RFC3339))
+			}
+			boards = append(boards, ge.Board().copy())
+		case gameEventReset:
+			if ge != nil {
+				ge.Reset()
+				boards = append(boards, ge.Board().copy())
+			}
+		}
+	}
+	if ge == nil {
+		return nil, fmt.Errorf("no created event for game %s", gameId)
+	}
+	return boards, nil
+}
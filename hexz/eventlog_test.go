@@ -0,0 +1,102 @@
+package hexz
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRotatingFileSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewRotatingFileSink(dir, 200)
+	if err != nil {
+		t.Fatalf("Cannot create sink: %s", err)
+	}
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	sink.nowFunc = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	const numEvents = 10
+	for i := 0; i < numEvents; i++ {
+		e := &GameEvent{GameId: "ABCDEF", Type: gameEventMove, Move: &GameEventMove{Move: i}}
+		if err := sink.Write(e); err != nil {
+			t.Fatalf("Cannot write event: %s", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Cannot close sink: %s", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 2 {
+		t.Errorf("Expected at least two files, got %d", len(entries))
+	}
+	// All events must be readable again, in order.
+	var moves []int
+	for _, e := range entries {
+		events, err := ReadGameEvents(path.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatalf("Cannot read events: %s", err)
+		}
+		for _, ev := range events {
+			moves = append(moves, ev.Move.Move)
+		}
+	}
+	want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if !cmp.Equal(moves, want) {
+		t.Errorf("want %v, got %v", want, moves)
+	}
+}
+
+func TestRotatingFileSinkRotatesDaily(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewRotatingFileSink(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("Cannot create sink: %s", err)
+	}
+	now := time.Date(2023, 5, 1, 23, 59, 59, 0, time.UTC)
+	sink.nowFunc = func() time.Time { return now }
+	sink.Write(&GameEvent{Type: gameEventCreated})
+	now = now.Add(2 * time.Second)
+	sink.Write(&GameEvent{Type: gameEventCreated})
+	sink.Close()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Expected two files, got %d", len(entries))
+	}
+}
+
+func TestServerCloseClosesEventLog(t *testing.T) {
+	dir := t.TempDir()
+	s := NewServer(&ServerConfig{EventLogDir: dir, EventLogMaxBytes: 1 << 20})
+	game := &GameHandle{id: "ABCDEF", gameType: gameTypeFlagz}
+	s.logGameEvent(game, &GameEvent{Type: gameEventCreated})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Cannot close server: %s", err)
+	}
+	// Events after closing are counted as errors, not written to a new file.
+	s.logGameEvent(game, &GameEvent{Type: gameEventPlayerLeft})
+	if n := s.Counter("/eventlog/errors").Value(); n != 1 {
+		t.Errorf("Want 1 event log error, got %d", n)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Want 1 event log file, got %d", len(entries))
+	}
+	events, err := ReadGameEvents(path.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != gameEventCreated {
+		t.Errorf("Want only the created event, got %d events", len(events))
+	}
+}
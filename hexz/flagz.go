@@ -7,11 +7,31 @@ import (
 	"math/rand"
 )
 
+func init() {
+	registerGameType(&GameTypeDescriptor{
+		GameTypeInfo: GameTypeInfo{
+			Type:           gameTypeFlagz,
+			DisplayText:    "\U0001F1F8\U0001F1E8 Flagz",
+			MinPlayers:     2,
+			MaxPlayers:     maxPlayers,
+			DefaultPlayers: 2,
+			SinglePlayer:   true,
+			Options:        []GameOption{difficultyOption()},
+		},
+		NewEngine: func(numPlayers int, src rand.Source) GameEngine {
+			return NewGameEngineFlagzN(numPlayers, src)
+		},
+		Levels: true,
+	})
+}
+
 type GameEngineFlagz struct {
 	B *Board
 	// Used to efficiently process moves and determine game state for flagz.
-	FreeCells   int    // Number of unoccupied cells
-	NormalMoves [2]int // Number of normal cell moves the players can make
+	FreeCells   int             // Number of unoccupied cells
+	NormalMoves [maxPlayers]int // Number of normal cell moves the players can make
+	numPlayers  int
+	level       *Level // Initial layout of rock and grass cells. Chosen randomly if nil.
 	// Source of random numbers. Useful to make games repeatable.
 	rnd *rand.Rand
 }
@@ -22,17 +42,51 @@ const (
 	flagzNumRockCells  = 15 // Odd number, so we have an even number of free cells.
 	flagzNumGrassCells = 5
 	flagzMaxValue      = 5 // Maximum value a cell can take.
+	flagzNumFlags      = 3 // Number of flags each player gets.
 )
 
+// Creates a new two-player Flagz game.
 func NewGameEngineFlagz(src rand.Source) *GameEngineFlagz {
+	return NewGameEngineFlagzN(2, src)
+}
+
+// Creates a new Flagz game for numPlayers players. Panics if numPlayers is not in [2, maxPlayers].
+func NewGameEngineFlagzN(numPlayers int, src rand.Source) *GameEngineFlagz {
+	if numPlayers < 2 || numPlayers > maxPlayers {
+		panic(fmt.Sprintf("Invalid number of Flagz players: %d", numPlayers))
+	}
 	g := &GameEngineFlagz{
-		rnd: rand.New(src),
+		numPlayers: numPlayers,
+		rnd:        rand.New(src),
 	}
 	g.Reset()
 	return g
 }
 
+// Starts the game over using the rock and grass cells of level l.
+func (g *GameEngineFlagz) SetLevel(l *Level) {
+	g.level = l
+	g.Reset()
+}
+
 func (g *GameEngineFlagz) PopulateInitialCells() {
+	if g.level != nil {
+		g.level.apply(g.B)
+	} else {
+		g.populateRandomCells()
+	}
+	// Reset freeCells and normalMoves.
+	g.FreeCells = 0
+	for i := 0; i < len(g.B.FlatFields); i++ {
+		if !g.B.FlatFields[i].occupied() {
+			g.FreeCells++
+		}
+	}
+	g.NormalMoves = [maxPlayers]int{}
+}
+
+// Places rock and grass cells at random positions.
+func (g *GameEngineFlagz) populateRandomCells() {
 	i := 0
 	n := len(g.B.FlatFields)
 	// j is only a safeguard for invalid calls to this method on a non-empty board.
@@ -57,53 +111,164 @@ func (g *GameEngineFlagz) PopulateInitialCells() {
 			f.Value = v
 		}
 	}
-	// Reset freeCells and normalMoves.
+}
+
+// Creates a game engine from the given board. Only the visible state (cell
+// types, owners, values, turn, score, resources) of b is used; all derived
+// state is recomputed from scratch. The board is used as is, not copied.
+// The number of players is taken from the length of b.Resources.
+func NewGameEngineFlagzFromBoard(b *Board, src rand.Source) *GameEngineFlagz {
+	g := &GameEngineFlagz{
+		B:          b,
+		numPlayers: len(b.Resources),
+		rnd:        rand.New(src),
+	}
+	g.recomputeDerivedState()
+	return g
+}
+
+// Recomputes FreeCells, NormalMoves and the Blocked and NextVal state of all
+// cells from the cell types, owners and values on the board.
+func (g *GameEngineFlagz) recomputeDerivedState() {
+	b := g.B
+	var ns [6]idx
 	g.FreeCells = 0
-	for i := 0; i < len(g.B.FlatFields); i++ {
-		if !g.B.FlatFields[i].occupied() {
+	g.NormalMoves = [maxPlayers]int{}
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			f := &b.Fields[r][c]
+			f.Blocked = [maxPlayers]bool{}
+			f.NextVal = [maxPlayers]int{}
+			if f.occupied() {
+				continue
+			}
 			g.FreeCells++
+			n := b.neighbors(idx{r, c}, ns[:])
+			for i := 0; i < n; i++ {
+				nb := &b.Fields[ns[i].r][ns[i].c]
+				if nb.Owner == 0 || (nb.Type != cellNormal && nb.Type != cellFlag) {
+					continue
+				}
+				pIdx := nb.Owner - 1
+				if nb.Value == flagzMaxValue {
+					f.Blocked[pIdx] = true
+					f.NextVal[pIdx] = -1
+				} else if !f.Blocked[pIdx] && (f.NextVal[pIdx] == 0 || f.NextVal[pIdx] > nb.Value+1) {
+					f.NextVal[pIdx] = nb.Value + 1
+				}
+			}
+			for p := 0; p < g.numPlayers; p++ {
+				if f.NextVal[p] > 0 {
+					g.NormalMoves[p]++
+				}
+			}
+		}
+	}
+}
+
+// Checks that the resources and cells of b follow the rules of Flagz: players have
+// unlimited normal pieces and at most flagzNumFlags flags, and each cell has a
+// Flagz cell type with an owner, value and lifetime that fit its type.
+// Does not check that the position can be reached in a game.
+func checkFlagzPosition(b *Board) error {
+	for i, r := range b.Resources {
+		for ct, n := range r.NumPieces {
+			var ok bool
+			switch CellType(ct) {
+			case cellNormal:
+				ok = n == -1
+			case cellFlag:
+				ok = n >= 0 && n <= flagzNumFlags
+			default:
+				ok = n == 0
+			}
+			if !ok {
+				return fmt.Errorf("P%d has %d pieces of type %d", i+1, n, ct)
+			}
 		}
 	}
-	g.NormalMoves = [2]int{0, 0}
+	for r := range b.Fields {
+		for c := range b.Fields[r] {
+			f := &b.Fields[r][c]
+			var ok bool
+			switch f.Type {
+			case cellNormal:
+				if f.Owner == 0 {
+					ok = f.Value == 0
+				} else {
+					ok = f.Value >= 1 && f.Value <= flagzMaxValue
+				}
+			case cellFlag:
+				ok = f.Owner > 0 && f.Value == 0
+			case cellRock:
+				ok = f.Owner == 0 && f.Value == 0
+			case cellGrass:
+				ok = f.Owner == 0 && f.Value >= 1 && f.Value <= flagzMaxValue
+			}
+			if !ok {
+				return fmt.Errorf("cell (%d,%d) of type %d has invalid owner %d or value %d", r, c, f.Type, f.Owner, f.Value)
+			}
+			// Occupied cells are never cleared.
+			lifetime := 0
+			if f.occupied() {
+				lifetime = -1
+			}
+			if f.Lifetime != lifetime {
+				return fmt.Errorf("cell (%d,%d) has lifetime %d, want %d", r, c, f.Lifetime, lifetime)
+			}
+		}
+	}
+	return nil
 }
 
 func (g *GameEngineFlagz) InitializeResources() {
-	g.B.Resources = make([]ResourceInfo, 2)
+	g.B.Resources = make([]ResourceInfo, g.numPlayers)
 	var ps [cellTypeLen]int
 	ps[cellNormal] = -1
-	ps[cellFlag] = 3
+	ps[cellFlag] = flagzNumFlags
 	for i := 0; i < len(g.B.Resources); i++ {
 		g.B.Resources[i].NumPieces = ps
 	}
 }
 
-func (g *GameEngineFlagz) NumPlayers() int { return 2 }
+func (g *GameEngineFlagz) NumPlayers() int { return g.numPlayers }
 
 func (g *GameEngineFlagz) Reset() {
 	g.B = NewBoard()
-	g.B.Score = make([]int, 2)
+	g.B.Score = make([]int, g.numPlayers)
 	g.InitializeResources()
 	g.PopulateInitialCells()
 	g.B.State = Running
 }
 
+// Returns true if the given player has any valid move left.
+func (g *GameEngineFlagz) canMove(playerNum int) bool {
+	pIdx := playerNum - 1
+	return g.NormalMoves[pIdx] > 0 || (g.FreeCells > 0 && g.B.Resources[pIdx].NumPieces[cellFlag] > 0)
+}
+
 func (g *GameEngineFlagz) recomputeState() {
 	b := g.B
-	canMove1 := g.NormalMoves[0] > 0 || (g.FreeCells > 0 && b.Resources[0].NumPieces[cellFlag] > 0)
-	canMove2 := g.NormalMoves[1] > 0 || (g.FreeCells > 0 && b.Resources[1].NumPieces[cellFlag] > 0)
-	// If only one player has valid moves left, it's their turn.
-	if !canMove1 && canMove2 {
-		b.Turn = 2
-	} else if canMove1 && !canMove2 {
-		b.Turn = 1
+	numMovers := 0
+	mover := 0
+	for p := 1; p <= g.numPlayers; p++ {
+		if g.canMove(p) {
+			numMovers++
+			mover = p
+		}
+	}
+	// Players without valid moves are skipped.
+	if numMovers > 0 {
+		for !g.canMove(b.Turn) {
+			b.Turn = b.Turn%g.numPlayers + 1
+		}
 	}
 	// Check if the game is over:
 	// * No open cells left
 	// * None of the players can move
-	// * One player cannot move, the other one has a higher score
-	s := b.Score
-	if g.FreeCells == 0 || !(canMove1 || canMove2) ||
-		(s[0] > s[1] && !canMove2) || (s[1] > s[0] && !canMove1) {
+	// * Only one player can move, and they already have the highest score
+	if g.FreeCells == 0 || numMovers == 0 ||
+		(numMovers == 1 && scoreBasedSingleWinner(b.Score) == mover) {
 		b.State = Finished
 	}
 }
@@ -170,7 +335,7 @@ func (g *GameEngineFlagz) MakeMove(m GameEngineMove) bool {
 	if f.occupied() {
 		return false
 	}
-	if b.Resources[pIdx].NumPieces[m.cellType] == 0 {
+	if !m.cellType.valid() || b.Resources[pIdx].NumPieces[m.cellType] == 0 {
 		// No pieces left of requested type
 		return false
 	}
@@ -186,10 +351,7 @@ func (g *GameEngineFlagz) MakeMove(m GameEngineMove) bool {
 		f.Value = val
 		b.Score[pIdx] += val
 		g.FreeCells--
-		g.NormalMoves[pIdx]--
-		if f.NextVal[1-pIdx] > 0 {
-			g.NormalMoves[1-pIdx]--
-		}
+		g.removeNormalMoves(f)
 		g.updateNeighborCells(m.row, m.col)
 	} else if m.cellType == cellFlag {
 		// A flag can be placed on any free cell. It does not add to the score.
@@ -200,24 +362,28 @@ func (g *GameEngineFlagz) MakeMove(m GameEngineMove) bool {
 		f.Value = 0
 		b.Resources[turn-1].NumPieces[cellFlag]--
 		g.FreeCells--
-		// Adjust available normal moves for both players if f was available to them.
-		if f.NextVal[pIdx] > 0 {
-			g.NormalMoves[pIdx]--
-		}
-		if f.NextVal[1-pIdx] > 0 {
-			g.NormalMoves[1-pIdx]--
-		}
+		g.removeNormalMoves(f)
 		g.updateNeighborCells(m.row, m.col)
 	} else {
 		// Invalid piece. Should be caught by resource check already, so never reached.
 		return false
 	}
-	b.Turn = 3 - b.Turn // Usually it's the other player's turn. If not, recomputeState will fix that.
+	// Usually it's the next player's turn. If not, recomputeState will fix that.
+	b.Turn = b.Turn%g.numPlayers + 1
 	b.Move++
 	g.recomputeState()
 	return true
 }
 
+// Adjusts the available normal moves of all players for whom the now occupied cell f was available.
+func (g *GameEngineFlagz) removeNormalMoves(f *Field) {
+	for p := 0; p < g.numPlayers; p++ {
+		if f.NextVal[p] > 0 {
+			g.NormalMoves[p]--
+		}
+	}
+}
+
 func (g *GameEngineFlagz) Board() *Board { return g.B }
 func (g *GameEngineFlagz) Clone(s rand.Source) SinglePlayerGameEngine {
 	return &GameEngineFlagz{
@@ -225,7 +391,53 @@ func (g *GameEngineFlagz) Clone(s rand.Source) SinglePlayerGameEngine {
 		rnd:         rand.New(s),
 		FreeCells:   g.FreeCells,
 		NormalMoves: g.NormalMoves,
+		numPlayers:  g.numPlayers,
+		level:       g.level,
+	}
+}
+
+func (g *GameEngineFlagz) Validate() error {
+	b := g.B
+	var v validationErrors
+	v.checkBoard(b, g.numPlayers)
+	// Recompute the derived state on a copy and compare.
+	want := &GameEngineFlagz{B: b.copy(), numPlayers: g.numPlayers}
+	want.recomputeDerivedState()
+	if g.FreeCells != want.FreeCells {
+		v.addf("FreeCells is %d, want %d", g.FreeCells, want.FreeCells)
+	}
+	if g.NormalMoves != want.NormalMoves {
+		v.addf("NormalMoves is %v, want %v", g.NormalMoves, want.NormalMoves)
+	}
+	score := make([]int, g.numPlayers)
+	for i, f := range b.FlatFields {
+		if f.Owner > 0 && f.Owner <= g.numPlayers && f.Type == cellNormal {
+			score[f.Owner-1] += f.Value
+		}
+		// Blocked and NextVal are only maintained for free cells.
+		if f.occupied() {
+			continue
+		}
+		wf := &want.B.FlatFields[i]
+		if f.Blocked != wf.Blocked {
+			v.addf("field %d is blocked for %v, want %v", i, f.Blocked, wf.Blocked)
+		}
+		if f.NextVal != wf.NextVal {
+			v.addf("field %d has NextVal %v, want %v", i, f.NextVal, wf.NextVal)
+		}
+	}
+	for i := range score {
+		if i < len(b.Score) && b.Score[i] != score[i] {
+			v.addf("P%d has score %d, want %d", i+1, b.Score[i], score[i])
+		}
+	}
+	if err := checkFlagzPosition(b); err != nil {
+		v.addf("%s", err)
+	}
+	if b.State == Running && b.Turn >= 1 && b.Turn <= g.numPlayers && !want.canMove(b.Turn) {
+		v.addf("P%d has the turn, but cannot move", b.Turn)
 	}
+	return v.err()
 }
 
 func (g *GameEngineFlagz) IsDone() bool {
@@ -25,3 +25,83 @@ func BenchmarkPlayFlagzGame(b *testing.B) {
 	}
 	b.Logf("winCounts: %v", winCounts)
 }
+
+func TestFlagzRecomputeDerivedState(t *testing.T) {
+	src := rand.NewSource(42)
+	ge := NewGameEngineFlagz(src)
+	for !ge.IsDone() {
+		m, err := ge.RandomMove()
+		if err != nil {
+			t.Fatal("Could not suggest a move:", err.Error())
+		}
+		if !ge.MakeMove(m) {
+			t.Fatal("Could not make a move")
+		}
+		g2 := NewGameEngineFlagzFromBoard(ge.B.copy(), src)
+		if g2.FreeCells != ge.FreeCells {
+			t.Errorf("Move %d: want FreeCells %d, got %d", ge.B.Move, ge.FreeCells, g2.FreeCells)
+		}
+		if g2.NormalMoves != ge.NormalMoves {
+			t.Errorf("Move %d: want NormalMoves %v, got %v", ge.B.Move, ge.NormalMoves, g2.NormalMoves)
+		}
+		for i := range ge.B.FlatFields {
+			f1, f2 := &ge.B.FlatFields[i], &g2.B.FlatFields[i]
+			if f1.occupied() {
+				continue // Derived state is only relevant for free cells.
+			}
+			if f1.NextVal != f2.NextVal || f1.Blocked != f2.Blocked {
+				t.Fatalf("Move %d: field %d differs: want %+v, got %+v", ge.B.Move, i, *f1, *f2)
+			}
+		}
+	}
+}
+
+func TestFlagzNPlayersRandomGames(t *testing.T) {
+	for numPlayers := 2; numPlayers <= maxPlayers; numPlayers++ {
+		src := rand.NewSource(int64(numPlayers))
+		for i := 0; i < 20; i++ {
+			ge := NewGameEngineFlagzN(numPlayers, src)
+			if len(ge.B.Score) != numPlayers || len(ge.B.Resources) != numPlayers {
+				t.Fatalf("%d players: want %d scores and resources, got %d and %d",
+					numPlayers, numPlayers, len(ge.B.Score), len(ge.B.Resources))
+			}
+			for !ge.IsDone() {
+				turn := ge.B.Turn
+				if turn < 1 || turn > numPlayers || !ge.canMove(turn) {
+					t.Fatalf("%d players: invalid turn %d at move %d", numPlayers, turn, ge.B.Move)
+				}
+				m, err := ge.RandomMove()
+				if err != nil {
+					t.Fatal("Could not suggest a move:", err.Error())
+				}
+				if !ge.MakeMove(m) {
+					t.Fatalf("%d players: could not make move %s", numPlayers, m.String())
+				}
+				g2 := NewGameEngineFlagzFromBoard(ge.B.copy(), src)
+				if g2.NormalMoves != ge.NormalMoves {
+					t.Fatalf("%d players: want NormalMoves %v, got %v", numPlayers, ge.NormalMoves, g2.NormalMoves)
+				}
+			}
+			if w := ge.Winner(); w != scoreBasedSingleWinner(ge.B.Score) {
+				t.Errorf("%d players: want winner %d for score %v, got %d",
+					numPlayers, scoreBasedSingleWinner(ge.B.Score), ge.B.Score, w)
+			}
+		}
+	}
+}
+
+func TestFlagzSkipsPlayersWithoutMoves(t *testing.T) {
+	ge := NewGameEngineFlagzN(3, rand.NewSource(1))
+	// Player 2 has no flags and no cells yet, so they cannot move.
+	ge.B.Resources[1].NumPieces[cellFlag] = 0
+	m, err := ge.RandomMove()
+	if err != nil {
+		t.Fatal("Could not suggest a move:", err.Error())
+	}
+	if !ge.MakeMove(m) {
+		t.Fatalf("Could not make move %s", m.String())
+	}
+	if ge.B.Turn != 3 {
+		t.Errorf("Want turn 3, got %d", ge.B.Turn)
+	}
+}
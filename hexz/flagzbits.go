@@ -0,0 +1,405 @@
+package hexz
+
+// Compact representation of Flagz games for search.
+//
+// MCTS copies the game for every iteration and plays it out with random moves.
+// flagzBits keeps the whole game state in fixed-size arrays, so copying it is a
+// plain memory copy without allocations. Free cells and the cells available for
+// normal moves are kept in bitsets, so random moves can be picked without scanning
+// the board. Only boards with the standard layout (see NewBoard) are supported.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// A set of cells of a standard board, identified by their index in Board.FlatFields.
+type cellSet [(numBoardFields + 63) / 64]uint64
+
+func (s *cellSet) add(i int)      { s[i>>6] |= 1 << (i & 63) }
+func (s *cellSet) remove(i int)   { s[i>>6] &^= 1 << (i & 63) }
+func (s *cellSet) has(i int) bool { return s[i>>6]&(1<<(i&63)) != 0 }
+func (s *cellSet) empty() bool    { return *s == cellSet{} }
+
+func (s *cellSet) count() int {
+	n := 0
+	for _, w := range s {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Returns the n-th smallest cell in s. n must be less than s.count().
+func (s *cellSet) nth(n int) int {
+	for i, w := range s {
+		k := bits.OnesCount64(w)
+		if n >= k {
+			n -= k
+			continue
+		}
+		for ; n > 0; n-- {
+			w &= w - 1 // Clear the lowest bit.
+		}
+		return i*64 + bits.TrailingZeros64(w)
+	}
+	panic("cellSet.nth: n out of range")
+}
+
+// Positions and neighbors of the cells of a standard board, by flat index.
+var (
+	flatIdx          [numBoardFields]idx
+	flatRowStart     [numBoardRows]int
+	flatNeighbors    [numBoardFields][6]uint8
+	flatNumNeighbors [numBoardFields]uint8
+)
+
+func init() {
+	b := NewBoard()
+	i := 0
+	for r := range b.Fields {
+		flatRowStart[r] = i
+		for c := range b.Fields[r] {
+			flatIdx[i] = idx{r, c}
+			i++
+		}
+	}
+	var ns [6]idx
+	for i, x := range flatIdx {
+		n := b.neighbors(x, ns[:])
+		for k, nb := range ns[:n] {
+			flatNeighbors[i][k] = uint8(flatRowStart[nb.r] + nb.c)
+		}
+		flatNumNeighbors[i] = uint8(n)
+	}
+}
+
+// Returns the flat index of cell (r, c), or false if (r, c) is not on a standard board.
+func flatIndex(r, c int) (int, bool) {
+	if r < 0 || r >= numBoardRows || c < 0 || c >= numFieldsFirstRow-r%2 {
+		return 0, false
+	}
+	return flatRowStart[r] + c, true
+}
+
+type flagzBits struct {
+	free  cellSet             // Unoccupied cells.
+	avail [maxPlayers]cellSet // Free cells on which the player can make a normal move.
+	// Type, owner, and value of occupied cells.
+	cellType [numBoardFields]int8
+	owner    [numBoardFields]int8
+	value    [numBoardFields]int8
+	// Value the player's cell would get on a free cell, or -1 if the cell is blocked
+	// for the player. Like Field.NextVal, but always 0 on occupied cells.
+	nextVal    [maxPlayers][numBoardFields]int8
+	score      [maxPlayers]int
+	flags      [maxPlayers]int // Number of flags the players have left.
+	numPlayers int
+	turn       int
+	move       int
+	state      GameState
+}
+
+var errFlagzBitsLayout = errors.New("board does not have the standard layout")
+
+// Converts the visible state of b (cell types, owners, values, turn, score,
+// resources) to the bitboard representation. As for NewGameEngineFlagzFromBoard,
+// the number of players is taken from the length of b.Resources.
+// Only unlimited normal pieces are supported, as in all Flagz games.
+func newFlagzBits(b *Board) (*flagzBits, error) {
+	numPlayers := len(b.Resources)
+	if numPlayers < 2 || numPlayers > maxPlayers || len(b.Score) != numPlayers {
+		return nil, fmt.Errorf("invalid number of players: %d", numPlayers)
+	}
+	if len(b.Fields) != numBoardRows {
+		return nil, errFlagzBitsLayout
+	}
+	for r := range b.Fields {
+		if len(b.Fields[r]) != numFieldsFirstRow-r%2 {
+			return nil, errFlagzBitsLayout
+		}
+	}
+	s := &flagzBits{
+		numPlayers: numPlayers,
+		turn:       b.Turn,
+		move:       b.Move,
+		state:      b.State,
+	}
+	for p := 0; p < numPlayers; p++ {
+		if n := b.Resources[p].NumPieces[cellNormal]; n != -1 {
+			return nil, fmt.Errorf("P%d has %d normal pieces, want unlimited", p+1, n)
+		}
+		s.score[p] = b.Score[p]
+		s.flags[p] = b.Resources[p].NumPieces[cellFlag]
+	}
+	for i, x := range flatIdx {
+		f := &b.Fields[x.r][x.c]
+		if !f.occupied() {
+			s.free.add(i)
+			continue
+		}
+		if f.Value < 0 || f.Value > math.MaxInt8 || f.Owner < 0 || f.Owner > numPlayers {
+			return nil, fmt.Errorf("invalid cell %v: owner %d, value %d", x, f.Owner, f.Value)
+		}
+		s.cellType[i] = int8(f.Type)
+		s.owner[i] = int8(f.Owner)
+		s.value[i] = int8(f.Value)
+	}
+	// Derive the available cells in the same way as recomputeDerivedState.
+	for i := 0; i < numBoardFields; i++ {
+		if !s.free.has(i) {
+			continue
+		}
+		for _, j := range flatNeighbors[i][:flatNumNeighbors[i]] {
+			ct := CellType(s.cellType[j])
+			if s.owner[j] == 0 || (ct != cellNormal && ct != cellFlag) {
+				continue
+			}
+			p := s.owner[j] - 1
+			nv := &s.nextVal[p][i]
+			if s.value[j] == flagzMaxValue {
+				*nv = -1
+			} else if *nv >= 0 && (*nv == 0 || *nv > s.value[j]+1) {
+				*nv = s.value[j] + 1
+			}
+		}
+		for p := 0; p < numPlayers; p++ {
+			if s.nextVal[p][i] > 0 {
+				s.avail[p].add(i)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Returns the board of the position. Blocked and NextVal are only set on free cells.
+func (s *flagzBits) board() *Board {
+	b := NewBoard()
+	b.Turn = s.turn
+	b.Move = s.move
+	b.State = s.state
+	b.Score = make([]int, s.numPlayers)
+	copy(b.Score, s.score[:s.numPlayers])
+	b.Resources = make([]ResourceInfo, s.numPlayers)
+	for p := range b.Resources {
+		b.Resources[p].NumPieces[cellNormal] = -1
+		b.Resources[p].NumPieces[cellFlag] = s.flags[p]
+	}
+	for i := range b.FlatFields {
+		f := &b.FlatFields[i]
+		if s.free.has(i) {
+			for p := 0; p < s.numPlayers; p++ {
+				f.NextVal[p] = int(s.nextVal[p][i])
+				f.Blocked[p] = s.nextVal[p][i] < 0
+			}
+			continue
+		}
+		f.Type = CellType(s.cellType[i])
+		f.Owner = int(s.owner[i])
+		f.Value = int(s.value[i])
+		f.Lifetime = -1
+	}
+	return b
+}
+
+func (s *flagzBits) canMove(playerNum int) bool {
+	pIdx := playerNum - 1
+	return !s.avail[pIdx].empty() || (s.flags[pIdx] > 0 && !s.free.empty())
+}
+
+// Returns the number of legal moves of the player whose turn it is.
+func (s *flagzBits) numLegalMoves() int {
+	pIdx := s.turn - 1
+	n := s.avail[pIdx].count()
+	if s.flags[pIdx] > 0 {
+		n += s.free.count()
+	}
+	return n
+}
+
+// Plays a cell of type ct on the free cell i for the player whose turn it is.
+// Follows the rules of GameEngineFlagz.MakeMove.
+func (s *flagzBits) makeMove(i int, ct CellType) bool {
+	pIdx := s.turn - 1
+	if s.state != Running || !s.free.has(i) {
+		return false
+	}
+	switch ct {
+	case cellNormal:
+		val := s.nextVal[pIdx][i]
+		if val <= 0 {
+			return false
+		}
+		s.occupy(i, cellNormal, val)
+		s.score[pIdx] += int(val)
+	case cellFlag:
+		if s.flags[pIdx] == 0 {
+			return false
+		}
+		s.flags[pIdx]--
+		s.occupy(i, cellFlag, 0)
+	default:
+		return false
+	}
+	s.turn = s.turn%s.numPlayers + 1
+	s.move++
+	s.recomputeState()
+	return true
+}
+
+func (s *flagzBits) occupy(i int, ct CellType, val int8) {
+	s.free.remove(i)
+	for p := 0; p < s.numPlayers; p++ {
+		s.avail[p].remove(i)
+		s.nextVal[p][i] = 0
+	}
+	s.cellType[i] = int8(ct)
+	s.owner[i] = int8(s.turn)
+	s.value[i] = val
+	s.updateNeighbors(i)
+}
+
+// Like GameEngineFlagz.updateNeighborCells: updates the available cells
+// around the occupied cell i and captures adjacent grass cells.
+func (s *flagzBits) updateNeighbors(i int) {
+	pIdx := s.owner[i] - 1
+	val := s.value[i]
+	for _, j8 := range flatNeighbors[i][:flatNumNeighbors[i]] {
+		j := int(j8)
+		if s.free.has(j) {
+			nv := &s.nextVal[pIdx][j]
+			if val == flagzMaxValue {
+				// New 5 => neighbors get blocked for normal moves.
+				s.avail[pIdx].remove(j)
+				*nv = -1
+			} else if *nv == 0 {
+				s.avail[pIdx].add(j)
+				*nv = val + 1
+			} else if *nv > val+1 {
+				*nv = val + 1
+			}
+		} else if CellType(s.cellType[j]) == cellGrass && s.value[j] <= val {
+			s.cellType[j] = int8(cellNormal)
+			s.owner[j] = s.owner[i]
+			s.score[pIdx] += int(s.value[j])
+			s.updateNeighbors(j)
+		}
+	}
+}
+
+// Skips players without moves and detects the end of the game, like GameEngineFlagz.recomputeState.
+func (s *flagzBits) recomputeState() {
+	numMovers := 0
+	mover := 0
+	for p := 1; p <= s.numPlayers; p++ {
+		if s.canMove(p) {
+			numMovers++
+			mover = p
+		}
+	}
+	if numMovers > 0 {
+		for !s.canMove(s.turn) {
+			s.turn = s.turn%s.numPlayers + 1
+		}
+	}
+	if s.free.empty() || numMovers == 0 ||
+		(numMovers == 1 && scoreBasedSingleWinner(s.score[:s.numPlayers]) == mover) {
+		s.state = Finished
+	}
+}
+
+// Picks a random move for the player whose turn it is. Moves are chosen with the
+// same probabilities and the same draws from rnd as in GameEngineFlagz.RandomMove.
+func (s *flagzBits) randomMove(rnd *rand.Rand) (int, CellType) {
+	pIdx := s.turn - 1
+	nMoves := s.avail[pIdx].count()
+	if s.flags[pIdx] > 0 && !s.free.empty() && (nMoves == 0 || rnd.Float64() <= float64(1)/float64(nMoves+1)) {
+		return s.free.nth(rnd.Intn(s.free.count())), cellFlag
+	}
+	return s.avail[pIdx].nth(rnd.Intn(nMoves)), cellNormal
+}
+
+// A Flagz game engine backed by flagzBits. MCTS uses it for uniform rollouts.
+// Board builds a new board on every call, so it should only be called at the API boundary.
+type flagzSearchEngine struct {
+	flagzBits
+	rnd *rand.Rand
+}
+
+// Creates a search engine for the current position of g that uses rnd for its random moves.
+func newFlagzSearchEngine(g *GameEngineFlagz, rnd *rand.Rand) (*flagzSearchEngine, error) {
+	s, err := newFlagzBits(g.B)
+	if err != nil {
+		return nil, err
+	}
+	return &flagzSearchEngine{flagzBits: *s, rnd: rnd}, nil
+}
+
+// Returns a GameEngineFlagz for the current position, e.g. for the endgame solver.
+func (e *flagzSearchEngine) flagzEngine() *GameEngineFlagz {
+	return NewGameEngineFlagzFromBoard(e.board(), e.rnd)
+}
+
+func (e *flagzSearchEngine) GameType() GameType { return gameTypeFlagz }
+func (e *flagzSearchEngine) NumPlayers() int    { return e.numPlayers }
+func (e *flagzSearchEngine) Board() *Board      { return e.board() }
+func (e *flagzSearchEngine) IsDone() bool       { return e.state == Finished }
+
+// Starts a new game with random rock and grass cells.
+func (e *flagzSearchEngine) Reset() {
+	s, err := newFlagzBits(NewGameEngineFlagzN(e.numPlayers, e.rnd).B)
+	if err != nil {
+		panic(fmt.Sprintf("cannot convert new Flagz board: %s", err))
+	}
+	e.flagzBits = *s
+}
+
+func (e *flagzSearchEngine) MakeMove(m GameEngineMove) bool {
+	if m.playerNum != e.turn || m.move != e.move {
+		return false
+	}
+	i, ok := flatIndex(m.row, m.col)
+	if !ok {
+		return false
+	}
+	return e.makeMove(i, m.cellType)
+}
+
+func (e *flagzSearchEngine) Winner() (playerNum int) {
+	if !e.IsDone() {
+		return 0
+	}
+	return scoreBasedSingleWinner(e.score[:e.numPlayers])
+}
+
+func (e *flagzSearchEngine) RandomMove() (GameEngineMove, error) {
+	if e.state != Running {
+		return GameEngineMove{}, fmt.Errorf("game is not running")
+	}
+	i, ct := e.randomMove(e.rnd)
+	x := flatIdx[i]
+	return GameEngineMove{playerNum: e.turn, move: e.move, row: x.r, col: x.c, cellType: ct}, nil
+}
+
+func (e *flagzSearchEngine) Clone(src rand.Source) SinglePlayerGameEngine {
+	return &flagzSearchEngine{flagzBits: e.flagzBits, rnd: rand.New(src)}
+}
+
+// Validates the position with GameEngineFlagz.Validate and checks that converting
+// it to a board and back yields the same state.
+func (e *flagzSearchEngine) Validate() error {
+	b := e.board()
+	if err := NewGameEngineFlagzFromBoard(b, e.rnd).Validate(); err != nil {
+		return err
+	}
+	s, err := newFlagzBits(b)
+	if err != nil {
+		return fmt.Errorf("invalid engine state: %w", err)
+	}
+	if *s != e.flagzBits {
+		return errors.New("invalid engine state: bitboard differs from its board")
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package hexz
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Returns a description of the first difference between the visible and derived state of boards want and got.
+func flagzBoardDiff(want, got *Board) string {
+	if want.Turn != got.Turn || want.Move != got.Move || want.State != got.State {
+		return "turn, move, or state differ"
+	}
+	for p := range want.Score {
+		if want.Score[p] != got.Score[p] || want.Resources[p] != got.Resources[p] {
+			return "score or resources differ"
+		}
+	}
+	for i := range want.FlatFields {
+		f1, f2 := &want.FlatFields[i], &got.FlatFields[i]
+		if f1.Type != f2.Type || f1.Owner != f2.Owner || f1.Value != f2.Value {
+			return "fields differ"
+		}
+		if !f1.occupied() && (f1.NextVal != f2.NextVal || f1.Blocked != f2.Blocked) {
+			return "derived state of free fields differs"
+		}
+	}
+	return ""
+}
+
+func TestFlagzSearchEngineMatchesFlagz(t *testing.T) {
+	for numPlayers := 2; numPlayers <= maxPlayers; numPlayers++ {
+		for i := 0; i < 20; i++ {
+			ge := NewGameEngineFlagzN(numPlayers, rand.NewSource(int64(i)))
+			s, err := newFlagzSearchEngine(ge, rand.New(rand.NewSource(int64(i))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Same sources of randomness => same random moves.
+			ge.rnd = rand.New(rand.NewSource(int64(i)))
+			for !ge.IsDone() {
+				m, _ := ge.RandomMove()
+				sm, err := s.RandomMove()
+				if err != nil {
+					t.Fatalf("%d players, game %d: no random move: %s", numPlayers, i, err)
+				}
+				if sm != m {
+					t.Fatalf("%d players, game %d: want move %s, got %s", numPlayers, i, m.String(), sm.String())
+				}
+				if !ge.MakeMove(m) || !s.MakeMove(m) {
+					t.Fatalf("%d players, game %d: move %s failed", numPlayers, i, m.String())
+				}
+				if d := flagzBoardDiff(ge.B, s.Board()); d != "" {
+					t.Fatalf("%d players, game %d, move %d: %s", numPlayers, i, ge.B.Move, d)
+				}
+				if err := s.Validate(); err != nil {
+					t.Fatalf("%d players, game %d: %s", numPlayers, i, err)
+				}
+			}
+			if !s.IsDone() || s.Winner() != ge.Winner() {
+				t.Errorf("%d players, game %d: want winner %d, got %d (done: %t)", numPlayers, i, ge.Winner(), s.Winner(), s.IsDone())
+			}
+		}
+	}
+}
+
+func TestFlagzBitsRoundTrip(t *testing.T) {
+	ge := NewGameEngineFlagzN(3, rand.NewSource(1))
+	for !ge.IsDone() {
+		m, _ := ge.RandomMove()
+		ge.MakeMove(m)
+		s, err := newFlagzBits(ge.B)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := flagzBoardDiff(ge.B, s.board()); d != "" {
+			t.Fatalf("Move %d: %s", ge.B.Move, d)
+		}
+	}
+}
+
+func TestFlagzBitsRejectsOtherLayouts(t *testing.T) {
+	if _, err := newFlagzBits(NewGameEngineConnect(rand.NewSource(1)).B); err == nil {
+		t.Error("Want error for Connect board")
+	}
+	if _, err := newFlagzBits(NewGameEngine(gameTypeFreeform, 1, rand.NewSource(1)).Board()); err == nil {
+		t.Error("Want error for single player board")
+	}
+}
+
+func TestFlagzSearchEngineRejectsInvalidMoves(t *testing.T) {
+	s, _ := newFlagzSearchEngine(NewGameEngineFlagz(rand.NewSource(1)), rand.New(rand.NewSource(1)))
+	for _, m := range []GameEngineMove{
+		{playerNum: 2, move: 0, row: 0, col: 0, cellType: cellFlag},
+		{playerNum: 1, move: 1, row: 0, col: 0, cellType: cellFlag},
+		{playerNum: 1, move: 0, row: 1, col: numFieldsFirstRow - 1, cellType: cellFlag},
+		{playerNum: 1, move: 0, row: 0, col: 0, cellType: cellRock},
+		{playerNum: 1, move: 0, row: 0, col: 0, cellType: -1},
+	} {
+		if s.MakeMove(m) {
+			t.Errorf("Invalid move %s was accepted", m.String())
+		}
+	}
+	if err := s.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFlagzSearchEngineCopyDoesNotAllocate(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	s, _ := newFlagzSearchEngine(ge, rand.New(rand.NewSource(1)))
+	scratch := &flagzSearchEngine{}
+	allocs := testing.AllocsPerRun(100, func() {
+		*scratch = *s
+		for !scratch.IsDone() {
+			i, ct := scratch.randomMove(scratch.rnd)
+			scratch.makeMove(i, ct)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Want no allocations, got %.1f per playout", allocs)
+	}
+}
+
+// Runs MCTS on the Board of a GameEngineFlagz, since the bitboard is only used for uniform rollouts.
+type boardUniformRolloutPolicy struct{ UniformRolloutPolicy }
+
+func TestMCTSSearchEngineMatchesBoard(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	for i := 0; i < 10 && !ge.IsDone(); i++ {
+		bits := NewMCTSFromSource(rand.NewSource(int64(i)))
+		bits.MaxIterations = 300
+		board := NewMCTSFromSource(rand.NewSource(int64(i)))
+		board.MaxIterations = 300
+		board.Rollout = boardUniformRolloutPolicy{}
+		m1, s1 := bits.SuggestMove(ge, time.Hour)
+		m2, s2 := board.SuggestMove(ge, time.Hour)
+		if m1 != m2 || s1.TreeSize != s2.TreeSize || s1.MaxQ() != s2.MaxQ() {
+			t.Fatalf("Move %d: searches differ: %s with tree size %d, %s with tree size %d",
+				i, m1.String(), s1.TreeSize, m2.String(), s2.TreeSize)
+		}
+		if !ge.MakeMove(m1) {
+			t.Fatalf("Cannot make move %s", m1.String())
+		}
+	}
+}
+
+func BenchmarkFlagzSearchEnginePlayout(b *testing.B) {
+	ge := NewGameEngineFlagz(rand.NewSource(123))
+	s, _ := newFlagzSearchEngine(ge, rand.New(rand.NewSource(123)))
+	scratch := &flagzSearchEngine{}
+	for i := 0; i < b.N; i++ {
+		*scratch = *s
+		for !scratch.IsDone() {
+			m, _ := scratch.RandomMove()
+			scratch.MakeMove(m)
+		}
+	}
+}
+
+func BenchmarkFlagzPlayout(b *testing.B) {
+	ge := NewGameEngineFlagz(rand.NewSource(123))
+	for i := 0; i < b.N; i++ {
+		g := ge.Clone(ge.rnd)
+		for !g.IsDone() {
+			m, _ := g.RandomMove()
+			g.MakeMove(m)
+		}
+	}
+}
+
+func TestFlagzBitsRejectsLimitedNormalPieces(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	m, _ := ge.RandomMove()
+	ge.MakeMove(m)
+	for _, n := range []int{-1, 0, 1} {
+		b := ge.B.copy()
+		b.Resources[b.Turn-1].NumPieces[cellNormal] = n
+		g := NewGameEngineFlagzFromBoard(b, rand.NewSource(1))
+		s, err := newFlagzBits(b)
+		if n != -1 {
+			// The search must fall back to GameEngineFlagz, since flagzBits would play different moves.
+			if err == nil {
+				t.Errorf("%d normal pieces: want error", n)
+			}
+			if _, err := newFlagzSearchEngine(g, rand.New(rand.NewSource(1))); err == nil {
+				t.Errorf("%d normal pieces: want no search engine", n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unlimited normal pieces: %s", err)
+		}
+		// Both engines accept the same normal moves.
+		for i, x := range flatIdx {
+			m := GameEngineMove{playerNum: b.Turn, move: b.Move, row: x.r, col: x.c, cellType: cellNormal}
+			gc := g.Clone(rand.NewSource(1)).(*GameEngineFlagz)
+			sc := *s
+			if want, got := gc.MakeMove(m), sc.makeMove(i, cellNormal); want != got {
+				t.Errorf("Move %s: GameEngineFlagz accepted: %t, flagzBits accepted: %t", m.String(), want, got)
+			}
+		}
+	}
+}
@@ -4,8 +4,28 @@ package hexz
 // The freeform single-player hexz game.
 //
 
+import "math/rand"
+
+func init() {
+	registerGameType(&GameTypeDescriptor{
+		GameTypeInfo: GameTypeInfo{
+			Type:           gameTypeFreeform,
+			DisplayText:    "\U0001F438 Freeform",
+			MinPlayers:     1,
+			MaxPlayers:     maxPlayers,
+			DefaultPlayers: 1,
+		},
+		NewEngine: func(numPlayers int, src rand.Source) GameEngine {
+			g := &GameEngineFreeform{numPlayers: numPlayers}
+			g.Init()
+			return g
+		},
+	})
+}
+
 type GameEngineFreeform struct {
-	board *Board
+	board      *Board
+	numPlayers int // Defaults to 1 if 0. A single player plays the moves of two colors.
 }
 
 func (g *GameEngineFreeform) GameType() GameType { return gameTypeFreeform }
@@ -31,7 +51,18 @@ func (g *GameEngineFreeform) Start() {
 	g.board.State = Running
 }
 func (g *GameEngineFreeform) NumPlayers() int {
-	return 1
+	if g.numPlayers == 0 {
+		return 1
+	}
+	return g.numPlayers
+}
+
+// Returns the number of colors that take turns.
+func (g *GameEngineFreeform) numColors() int {
+	if n := g.NumPlayers(); n > 2 {
+		return n
+	}
+	return 2
 }
 
 func (g *GameEngineFreeform) InitialResources() ResourceInfo {
@@ -41,6 +72,9 @@ func (g *GameEngineFreeform) InitialResources() ResourceInfo {
 	ps[cellFlag] = -1
 	ps[cellPest] = -1
 	ps[cellDeath] = -1
+	// Rock and grass cells are used to design Flagz levels.
+	ps[cellRock] = -1
+	ps[cellGrass] = -1
 	return ResourceInfo{
 		NumPieces: ps}
 }
@@ -51,18 +85,49 @@ func (g *GameEngineFreeform) Winner() (playerNum int) {
 	return 0 // No one ever wins here.
 }
 
+func (g *GameEngineFreeform) Validate() error {
+	b := g.board
+	var v validationErrors
+	// All colors take turns, even if a single player plays them.
+	if b.Turn < 1 || b.Turn > g.numColors() {
+		v.addf("turn %d out of range", b.Turn)
+	}
+	for i, f := range b.FlatFields {
+		if !f.Type.valid() || f.Owner < 0 || f.Owner > g.numColors() {
+			v.addf("field %d has invalid type %d or owner %d", i, f.Type, f.Owner)
+		}
+		if (f.Type == cellRock || f.Type == cellGrass) && f.Owner != 0 {
+			v.addf("rock or grass field %d is owned by P%d", i, f.Owner)
+		}
+	}
+	return v.err()
+}
+
 func (g *GameEngineFreeform) MakeMove(m GameEngineMove) bool {
 	board := g.board
-	if !board.valid(idx{m.row, m.col}) {
+	if !board.valid(idx{m.row, m.col}) || !m.cellType.valid() {
 		// Invalid move request.
 		return false
 	}
 	board.Move++
 	f := &board.Fields[m.row][m.col]
+	if m.cellType == cellRock || m.cellType == cellGrass {
+		// Non-player cells. Placing grass on grass increments its value.
+		if m.cellType == cellRock {
+			f.Value = 0
+		} else if f.Type == cellGrass {
+			f.Value = f.Value%flagzMaxValue + 1
+		} else {
+			f.Value = 1
+		}
+		f.Owner = 0
+		f.Type = m.cellType
+		return true
+	}
 	f.Owner = board.Turn
 	f.Type = m.cellType
 	board.Turn++
-	if board.Turn > 2 {
+	if board.Turn > g.numColors() {
 		board.Turn = 1
 	}
 	f.Value = 1
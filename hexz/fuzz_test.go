@@ -0,0 +1,122 @@
+package hexz
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Plays the moves encoded in data on a new engine of type d for numPlayers players
+// and validates the engine after every move. Each move takes three bytes:
+//
+//   - op: if the high bit is clear and the engine supports it, a random legal move
+//     is played and must be accepted. Otherwise, an arbitrary move is built from
+//     the next two bytes, which the engine may reject. Bits 0x40 and 0x20 make the
+//     move come from a random player or use the wrong move number. 0x7f resets the game.
+//   - row, col: position of arbitrary moves, which may be outside of the board.
+//     The cell type is derived from op and may be invalid.
+func playFuzzMoves(t *testing.T, d *GameTypeDescriptor, numPlayers int, seed int64, data []byte) {
+	ge := d.NewEngine(numPlayers, rand.NewSource(seed))
+	spge, _ := ge.(SinglePlayerGameEngine)
+	for i := 0; i+2 < len(data); i += 3 {
+		op, row, col := data[i], data[i+1], data[i+2]
+		b := ge.Board()
+		var m GameEngineMove
+		switch {
+		case op&0x7f == 0x7f:
+			ge.Reset()
+		case op&0x80 == 0 && spge != nil:
+			if ge.IsDone() {
+				continue
+			}
+			var err error
+			m, err = spge.RandomMove()
+			if err != nil {
+				t.Fatalf("%s: move %d: no random move: %s", d.Type, b.Move, err)
+			}
+			if !ge.MakeMove(m) {
+				t.Fatalf("%s: move %d: random move %s was rejected", d.Type, b.Move, m.String())
+			}
+		default:
+			m = GameEngineMove{
+				playerNum: b.Turn,
+				move:      b.Move,
+				row:       int(row)%(len(b.Fields)+2) - 1,
+				col:       int(col)%(len(b.Fields[0])+2) - 1,
+				cellType:  CellType(op&0x1f)%(cellTypeLen+2) - 1,
+			}
+			if op&0x40 != 0 {
+				m.playerNum = int(op>>2) % (numPlayers + 2)
+			}
+			if op&0x20 != 0 {
+				m.move++
+			}
+			ge.MakeMove(m)
+		}
+		if err := ge.Validate(); err != nil {
+			t.Fatalf("%s with %d players: after %s (op %#x): %s", d.Type, numPlayers, m.String(), op, err)
+		}
+	}
+}
+
+func FuzzGameEngines(f *testing.F) {
+	f.Add(int64(1), []byte{})
+	f.Add(int64(2), []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	f.Add(int64(3), []byte{0x81, 3, 4, 0x81, 3, 4, 0x82, 5, 5, 0x80, 0, 0, 0x7f, 0, 0, 0xc1, 1, 1})
+	f.Add(int64(4), []byte{0x9e, 0xff, 0xff, 0x80, 11, 10, 0xa0, 2, 2, 0x85, 6, 6, 0x83, 6, 7})
+	long := make([]byte, 300)
+	f.Add(int64(5), long)
+	f.Fuzz(func(t *testing.T, seed int64, data []byte) {
+		for _, d := range GameTypes() {
+			for n := d.MinPlayers; n <= d.MaxPlayers; n++ {
+				playFuzzMoves(t, d, n, seed, data)
+			}
+		}
+	})
+}
+
+func TestValidateDetectsCorruption(t *testing.T) {
+	tests := []struct {
+		gameType GameType
+		corrupt  func(ge GameEngine)
+	}{
+		{gameTypeFlagz, func(ge GameEngine) { ge.(*GameEngineFlagz).FreeCells++ }},
+		{gameTypeFlagz, func(ge GameEngine) { ge.(*GameEngineFlagz).NormalMoves[0]-- }},
+		{gameTypeFlagz, func(ge GameEngine) {
+			b := ge.Board()
+			for i := range b.FlatFields {
+				if !b.FlatFields[i].occupied() {
+					b.FlatFields[i].NextVal[1] = 3
+					return
+				}
+			}
+		}},
+		{gameTypeClassic, func(ge GameEngine) { ge.Board().Score[1] = 7 }},
+		{gameTypeConnect, func(ge GameEngine) { ge.(*GameEngineConnect).winner = 2 }},
+		{gameTypeConnect, func(ge GameEngine) {
+			// The corner cell is on a side of both players.
+			g := ge.(*GameEngineConnect)
+			g.occupy(axial{0, 0}.idx(), g.B.Turn)
+			g.uf = newUnionFind(connectNodes)
+		}},
+		{gameTypeFreeform, func(ge GameEngine) { ge.Board().FlatFields[0].Type = cellTypeLen }},
+	}
+	for i, test := range tests {
+		ge := NewGameEngine(test.gameType, 0, rand.NewSource(1))
+		if spge, ok := ge.(SinglePlayerGameEngine); ok {
+			for j := 0; j < 4 && !ge.IsDone(); j++ {
+				m, _ := spge.RandomMove()
+				ge.MakeMove(m)
+			}
+		} else {
+			ge.MakeMove(GameEngineMove{playerNum: 1, move: 0, row: 2, col: 2, cellType: cellNormal})
+			ge.MakeMove(GameEngineMove{playerNum: 2, move: 1, row: 2, col: 3, cellType: cellNormal})
+		}
+		if err := ge.Validate(); err != nil {
+			t.Fatalf("%d: %s: valid engine failed validation: %s", i, test.gameType, err)
+		}
+		test.corrupt(ge)
+		if err := ge.Validate(); err == nil {
+			t.Errorf("%d: %s: corruption was not detected", i, test.gameType)
+		}
+	}
+}
@@ -2,4 +2,7 @@ module github.com/dnswlt/hackz/hexz
 
 go 1.20
 
-require github.com/google/go-cmp v0.5.9
+require (
+	github.com/google/go-cmp v0.5.9
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,265 @@
+package hexz
+
+// Hex grid coordinates and geometry.
+//
+// Boards store cells in offset coordinates (idx): rows of cells, where odd rows
+// are shifted right by half a cell. Offset coordinates are convenient for storage
+// but awkward for geometry, so computations like distances, rings and lines are
+// done in axial or cube coordinates.
+// See https://www.redblobgames.com/grids/hexagons/ for background.
+
+import "math"
+
+// Axial coordinates of a hex cell. r is the row, q the column along a 60 degree axis.
+type axial struct {
+	q, r int
+}
+
+// Cube coordinates of a hex cell. x+y+z == 0 for all valid cube coordinates.
+type cube struct {
+	x, y, z int
+}
+
+// Unit vectors pointing to the six neighbors of a cell, starting east and
+// going counter-clockwise. Board.neighbors returns neighbors in this order.
+var axialDirections = [6]axial{
+	{1, 0}, {1, -1}, {0, -1}, {-1, 0}, {-1, 1}, {0, 1},
+}
+
+func (x idx) axial() axial {
+	// Odd rows are shifted right, so each pair of rows shifts the q axis by one.
+	return axial{q: x.c - (x.r-x.r&1)>>1, r: x.r}
+}
+
+func (x idx) cube() cube {
+	return x.axial().cube()
+}
+
+func (a axial) idx() idx {
+	return idx{r: a.r, c: a.q + (a.r-a.r&1)>>1}
+}
+
+func (a axial) cube() cube {
+	return cube{x: a.q, y: -a.q - a.r, z: a.r}
+}
+
+func (a axial) add(b axial) axial {
+	return axial{a.q + b.q, a.r + b.r}
+}
+
+func (a axial) scale(k int) axial {
+	return axial{a.q * k, a.r * k}
+}
+
+func (c cube) axial() axial {
+	return axial{q: c.x, r: c.z}
+}
+
+func (c cube) idx() idx {
+	return c.axial().idx()
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Returns the number of steps needed to get from a to b.
+func hexDistance(a, b idx) int {
+	ca, cb := a.cube(), b.cube()
+	d := abs(ca.x - cb.x)
+	if dy := abs(ca.y - cb.y); dy > d {
+		d = dy
+	}
+	if dz := abs(ca.z - cb.z); dz > d {
+		d = dz
+	}
+	return d
+}
+
+// Returns all cells at exactly the given distance from center, including
+// cells outside of any board. A ring of radius r > 0 has 6*r cells.
+func hexRing(center idx, radius int) []idx {
+	if radius == 0 {
+		return []idx{center}
+	}
+	result := make([]idx, 0, 6*radius)
+	a := center.axial().add(axialDirections[4].scale(radius))
+	for _, d := range axialDirections {
+		for j := 0; j < radius; j++ {
+			result = append(result, a.idx())
+			a = a.add(d)
+		}
+	}
+	return result
+}
+
+// Returns all cells at a distance of at most radius from center, ordered
+// by distance, i.e. the rings of radius 0 to radius.
+func hexSpiral(center idx, radius int) []idx {
+	result := make([]idx, 0, 1+3*radius*(radius+1))
+	for r := 0; r <= radius; r++ {
+		result = append(result, hexRing(center, r)...)
+	}
+	return result
+}
+
+// Rounds fractional cube coordinates to the nearest cell.
+func cubeRound(x, y, z float64) cube {
+	rx, ry, rz := math.Round(x), math.Round(y), math.Round(z)
+	dx, dy, dz := math.Abs(rx-x), math.Abs(ry-y), math.Abs(rz-z)
+	// Fix the coordinate with the largest rounding error so that x+y+z == 0.
+	if dx > dy && dx > dz {
+		rx = -ry - rz
+	} else if dy > dz {
+		ry = -rx - rz
+	} else {
+		rz = -rx - ry
+	}
+	return cube{int(rx), int(ry), int(rz)}
+}
+
+// Returns the cells on a straight line from a to b, including both.
+// Consecutive cells of the line are neighbors.
+func hexLine(a, b idx) []idx {
+	n := hexDistance(a, b)
+	ca, cb := a.cube(), b.cube()
+	result := make([]idx, 0, n+1)
+	// Nudge the line slightly so that it never runs exactly along cell edges.
+	const eps = 1e-6
+	for i := 0; i <= n; i++ {
+		t := 0.0
+		if n > 0 {
+			t = float64(i) / float64(n)
+		}
+		c := cubeRound(
+			float64(ca.x)+eps+(float64(cb.x-ca.x))*t,
+			float64(ca.y)+eps+(float64(cb.y-ca.y))*t,
+			float64(ca.z)-2*eps+(float64(cb.z-ca.z))*t,
+		)
+		result = append(result, c.idx())
+	}
+	return result
+}
+
+// Offsets of the neighbors of cells in even (index 0) and odd (index 1) rows,
+// in the order of axialDirections. Precomputed, since neighbors is performance critical.
+var neighborOffsets = func() (offsets [2][6]idx) {
+	for parity := range offsets {
+		x := idx{r: parity}
+		for i, d := range axialDirections {
+			nb := x.axial().add(d).idx()
+			offsets[parity][i] = idx{nb.r - x.r, nb.c - x.c}
+		}
+	}
+	return offsets
+}()
+
+// Populates ns with valid indices of all neighbor cells. Returns the number of neighbor cells.
+// ns must have enough capacity to hold all neighbors. You should pass in a [6]idx slice.
+func (b *Board) neighbors(x idx, ns []idx) int {
+	k := 0
+	for _, d := range &neighborOffsets[x.r&1] {
+		ns[k] = idx{x.r + d.r, x.c + d.c}
+		if b.valid(ns[k]) {
+			k++
+		}
+	}
+	return k
+}
+
+// Returns the cells of the board at exactly the given distance from center.
+func (b *Board) ring(center idx, radius int) []idx {
+	var result []idx
+	for _, x := range hexRing(center, radius) {
+		if b.valid(x) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// Returns the cells of the board at a distance of at most radius from center, ordered by distance.
+func (b *Board) spiral(center idx, radius int) []idx {
+	var result []idx
+	for _, x := range hexSpiral(center, radius) {
+		if b.valid(x) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// Calls cb for x and, as long as cb returns true, for the neighbors of every cell
+// for which cb returned true. cb is called again for cells it was already called for,
+// so it must mark the cells it has seen and return false for them.
+func (b *Board) floodFill(x idx, cb func(idx) bool) {
+	var ns [6]idx
+	stack := []idx{x}
+	for len(stack) > 0 {
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !cb(x) {
+			continue
+		}
+		n := b.neighbors(x, ns[:])
+		stack = append(stack, ns[:n]...)
+	}
+}
+
+// Returns all cells that can be reached from start in at most maxSteps steps,
+// moving only through cells for which passable returns true. start itself is always
+// included, and cells are ordered by their number of steps from start.
+// A negative maxSteps means there is no limit.
+func (b *Board) reachable(start idx, maxSteps int, passable func(idx) bool) []idx {
+	seen := map[idx]bool{start: true}
+	result := []idx{start}
+	var ns [6]idx
+	for i, steps, levelEnd := 0, 0, 1; i < len(result); i++ {
+		if i == levelEnd {
+			steps++
+			levelEnd = len(result)
+		}
+		if maxSteps >= 0 && steps >= maxSteps {
+			break
+		}
+		n := b.neighbors(result[i], ns[:])
+		for _, nb := range ns[:n] {
+			if !seen[nb] && passable(nb) {
+				seen[nb] = true
+				result = append(result, nb)
+			}
+		}
+	}
+	return result
+}
+
+// Returns the connected components of the cells for which member returns true.
+// Components are ordered by their first cell in row-major order.
+func (b *Board) components(member func(idx) bool) [][]idx {
+	seen := make([][]bool, len(b.Fields))
+	for r := range seen {
+		seen[r] = make([]bool, len(b.Fields[r]))
+	}
+	var result [][]idx
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			if seen[r][c] || !member(idx{r, c}) {
+				continue
+			}
+			var comp []idx
+			b.floodFill(idx{r, c}, func(x idx) bool {
+				if seen[x.r][x.c] || !member(x) {
+					return false
+				}
+				seen[x.r][x.c] = true
+				comp = append(comp, x)
+				return true
+			})
+			result = append(result, comp)
+		}
+	}
+	return result
+}
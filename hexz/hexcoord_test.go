@@ -0,0 +1,140 @@
+package hexz
+
+import (
+	"testing"
+)
+
+// Returns a board with the given number of rows and columns and no cells occupied.
+func newTestBoard(rows, cols int) *Board {
+	b := &Board{Fields: make([][]Field, rows)}
+	for r := range b.Fields {
+		b.Fields[r] = make([]Field, cols)
+	}
+	return b
+}
+
+func TestHexCoordConversions(t *testing.T) {
+	for r := -5; r <= 5; r++ {
+		for c := -5; c <= 5; c++ {
+			x := idx{r, c}
+			if got := x.axial().idx(); got != x {
+				t.Errorf("%v: axial round trip gives %v", x, got)
+			}
+			cb := x.cube()
+			if cb.x+cb.y+cb.z != 0 {
+				t.Errorf("%v: invalid cube coordinates %v", x, cb)
+			}
+			if got := cb.idx(); got != x {
+				t.Errorf("%v: cube round trip gives %v", x, got)
+			}
+		}
+	}
+}
+
+func TestHexNeighborsHaveDistanceOne(t *testing.T) {
+	b := newTestBoard(11, 10)
+	var ns [6]idx
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			x := idx{r, c}
+			n := b.neighbors(x, ns[:])
+			for _, nb := range ns[:n] {
+				if d := hexDistance(x, nb); d != 1 {
+					t.Errorf("Neighbor %v of %v has distance %d", nb, x, d)
+				}
+			}
+			if want := len(b.ring(x, 1)); n != want {
+				t.Errorf("%v: %d neighbors, but ring of radius 1 has %d cells", x, n, want)
+			}
+		}
+	}
+	// Inner cells have six neighbors, corners fewer.
+	if n := b.neighbors(idx{5, 5}, ns[:]); n != 6 {
+		t.Errorf("Want 6 neighbors of inner cell, got %d", n)
+	}
+	if n := b.neighbors(idx{0, 0}, ns[:]); n != 2 {
+		t.Errorf("Want 2 neighbors of top left corner, got %d", n)
+	}
+}
+
+func TestHexRingsAndSpirals(t *testing.T) {
+	center := idx{5, 4}
+	for radius := 0; radius <= 4; radius++ {
+		ring := hexRing(center, radius)
+		want := 6 * radius
+		if radius == 0 {
+			want = 1
+		}
+		if len(ring) != want {
+			t.Errorf("Ring of radius %d has %d cells, want %d", radius, len(ring), want)
+		}
+		seen := make(map[idx]bool)
+		for _, x := range ring {
+			if d := hexDistance(center, x); d != radius {
+				t.Errorf("Cell %v of ring %d has distance %d", x, radius, d)
+			}
+			if seen[x] {
+				t.Errorf("Cell %v appears twice in ring %d", x, radius)
+			}
+			seen[x] = true
+		}
+	}
+	if n := len(hexSpiral(center, 3)); n != 37 {
+		t.Errorf("Spiral of radius 3 has %d cells, want 37", n)
+	}
+	b := newTestBoard(3, 3)
+	if n := len(b.spiral(idx{0, 0}, 10)); n != 9 {
+		t.Errorf("Spiral on the board has %d cells, want 9", n)
+	}
+}
+
+func TestHexLine(t *testing.T) {
+	tests := []struct{ a, b idx }{
+		{idx{0, 0}, idx{0, 0}},
+		{idx{0, 0}, idx{0, 7}},
+		{idx{0, 0}, idx{10, 9}},
+		{idx{3, 2}, idx{8, 0}},
+		{idx{9, 1}, idx{1, 6}},
+	}
+	for _, test := range tests {
+		line := hexLine(test.a, test.b)
+		if want := hexDistance(test.a, test.b) + 1; len(line) != want {
+			t.Errorf("Line %v-%v has %d cells, want %d", test.a, test.b, len(line), want)
+			continue
+		}
+		if line[0] != test.a || line[len(line)-1] != test.b {
+			t.Errorf("Line %v-%v has wrong endpoints: %v", test.a, test.b, line)
+		}
+		for i := 1; i < len(line); i++ {
+			if hexDistance(line[i-1], line[i]) != 1 {
+				t.Errorf("Line %v-%v has a gap: %v", test.a, test.b, line)
+			}
+		}
+	}
+}
+
+func TestBoardReachableAndComponents(t *testing.T) {
+	b := newTestBoard(5, 5)
+	// A wall of rocks in column 2 splits the board.
+	for r := 0; r < 5; r++ {
+		b.Fields[r][2].Type = cellRock
+	}
+	free := func(x idx) bool { return !b.Fields[x.r][x.c].occupied() }
+	all := b.reachable(idx{0, 0}, -1, free)
+	for _, x := range all {
+		if x.c >= 2 {
+			t.Errorf("Cell %v is behind the wall", x)
+		}
+	}
+	if len(all) != 10 {
+		t.Errorf("Want 10 reachable cells, got %d", len(all))
+	}
+	near := b.reachable(idx{0, 0}, 1, free)
+	if len(near) != 3 || near[0] != (idx{0, 0}) {
+		t.Errorf("Want start and its two free neighbors, got %v", near)
+	}
+	comps := b.components(free)
+	if len(comps) != 2 || len(comps[0]) != 10 || len(comps[1]) != 10 {
+		t.Errorf("Want two components of 10 cells, got %v", comps)
+	}
+}
@@ -0,0 +1,73 @@
+package hexz
+
+// Per-route HTTP metrics.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// Bucket bounds (in seconds) of HTTP request latency distributions.
+	httpLatencyBounds = DistribRange(0.0001, 60, 1.2)
+	// Bucket bounds (in seconds) of the SSE connection duration distribution.
+	sseDurationBounds = DistribRange(1, 24*60*60, 1.2)
+)
+
+// A ResponseWriter that remembers the response status and whether the response
+// was streamed. It implements http.Flusher if the wrapped ResponseWriter does.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	status   int  // 0 if no header was written yet.
+	streamed bool // True if the handler flushed the response before returning.
+}
+
+func (w *metricsResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *metricsResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *metricsResponseWriter) Flush() {
+	w.streamed = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Lets http.ResponseController access the wrapped ResponseWriter.
+func (w *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Wraps h to record the latency of all requests to the given route in the
+// distribution /http/{route}/latency and to count their response status codes
+// in /http/{route}/status/{code}. Streamed responses (SSE) are not included in
+// the latency distribution; handleSse records their duration separately.
+func (s *Server) metricsHandler(route string, h http.HandlerFunc) http.HandlerFunc {
+	latencyDistrib := fmt.Sprintf("/http/%s/latency", route)
+	// Only fails if the distribution already exists, e.g. if createHandler is called twice.
+	s.AddDistribution(latencyDistrib, httpLatencyBounds)
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		mw := &metricsResponseWriter{ResponseWriter: w}
+		h(mw, r)
+		status := mw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.IncCounter(fmt.Sprintf("/http/%s/status/%d", route, status))
+		if !mw.streamed {
+			s.AddDistribValue(latencyDistrib, time.Since(started).Seconds())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package hexz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	s := NewServer(&ServerConfig{})
+	h := s.metricsHandler("test", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	for _, path := range []string{"/", "/", "/missing"} {
+		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if n := s.Counter("/http/test/status/200").Value(); n != 2 {
+		t.Errorf("Want 2 OK responses, got %d", n)
+	}
+	if n := s.Counter("/http/test/status/404").Value(); n != 1 {
+		t.Errorf("Want 1 Not Found response, got %d", n)
+	}
+	if d := s.distrib["/http/test/latency"].Copy(); d.totalCount != 3 {
+		t.Errorf("Want 3 latency values, got %d", d.totalCount)
+	}
+}
+
+func TestMetricsHandlerStreaming(t *testing.T) {
+	s := NewServer(&ServerConfig{})
+	h := s.metricsHandler("stream", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("Wrapped ResponseWriter is not a Flusher")
+		}
+		w.Write([]byte("data: {}\n\n"))
+		f.Flush()
+	})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !rec.Flushed {
+		t.Error("Response was not flushed")
+	}
+	if n := s.Counter("/http/stream/status/200").Value(); n != 1 {
+		t.Errorf("Want 1 OK response, got %d", n)
+	}
+	if d := s.distrib["/http/stream/latency"].Copy(); d.totalCount != 0 {
+		t.Errorf("Streamed responses should not be in the latency distribution, got %d values", d.totalCount)
+	}
+}
+
+func TestStatuszEncodesUnboundedBuckets(t *testing.T) {
+	s := NewServer(&ServerConfig{})
+	h := s.metricsHandler("test", func(w http.ResponseWriter, r *http.Request) {})
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	// A latency below the smallest bound ends up in the unbounded first bucket.
+	s.AddDistribValue("/http/test/latency", 0)
+	rec := httptest.NewRecorder()
+	s.handleStatusz(rec, httptest.NewRequest(http.MethodGet, "/statusz", nil))
+	var resp StatuszResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal("Cannot decode /statusz response: ", err)
+	}
+}
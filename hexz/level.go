@@ -0,0 +1,253 @@
+package hexz
+
+// Flagz levels: predefined starting layouts of rock and grass cells.
+//
+// Levels are designed in a Freeform game, which can place rock and grass cells,
+// and exported as JSON files. The server loads all levels from a directory and
+// new Flagz games can be started from any of them instead of a random layout.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const levelFileExt = ".json"
+
+var (
+	// Regexp used to validate level names. Level names are also used as file names.
+	levelNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,40}$`)
+)
+
+type Level struct {
+	Name  string      `json:"name"`
+	Cells []LevelCell `json:"cells"` // Rock and grass cells. All other cells are free.
+}
+
+type LevelCell struct {
+	Row   int      `json:"row"`
+	Col   int      `json:"col"`
+	Type  CellType `json:"type"`
+	Value int      `json:"v,omitempty"` // Only used for grass cells.
+}
+
+// Checks that the level is well-formed and can be played.
+// The number of cells that are not rocks must be even, as in random layouts,
+// so that the playable cells can be split evenly between two players.
+func (l *Level) Validate() error {
+	if !levelNameRegexp.MatchString(l.Name) {
+		return fmt.Errorf("invalid level name %q", l.Name)
+	}
+	b := NewBoard()
+	numRocks := 0
+	numGrass := 0
+	for _, c := range l.Cells {
+		if !b.valid(idx{c.Row, c.Col}) {
+			return fmt.Errorf("cell (%d,%d) is not on the board", c.Row, c.Col)
+		}
+		f := &b.Fields[c.Row][c.Col]
+		if f.Type != cellNormal {
+			return fmt.Errorf("duplicate cell (%d,%d)", c.Row, c.Col)
+		}
+		switch c.Type {
+		case cellRock:
+			if c.Value != 0 {
+				return fmt.Errorf("rock cell (%d,%d) must not have a value", c.Row, c.Col)
+			}
+			numRocks++
+		case cellGrass:
+			if c.Value < 1 || c.Value > flagzMaxValue {
+				return fmt.Errorf("grass cell (%d,%d) has invalid value %d", c.Row, c.Col, c.Value)
+			}
+			numGrass++
+		default:
+			return fmt.Errorf("cell (%d,%d) has invalid type %d", c.Row, c.Col, c.Type)
+		}
+		f.Type = c.Type
+	}
+	numPlayable := len(b.FlatFields) - numRocks
+	if numPlayable-numGrass == 0 {
+		return fmt.Errorf("level has no free cells")
+	}
+	if numPlayable%2 != 0 {
+		return fmt.Errorf("level has an odd number (%d) of cells that are not rocks", numPlayable)
+	}
+	return nil
+}
+
+// Returns the number of cells that are neither rock nor grass.
+func (l *Level) FreeCells() int {
+	return len(NewBoard().FlatFields) - len(l.Cells)
+}
+
+// Places the level's cells on the empty board b.
+func (l *Level) apply(b *Board) {
+	for _, c := range l.Cells {
+		f := &b.Fields[c.Row][c.Col]
+		f.Type = c.Type
+		f.Value = c.Value
+		f.Lifetime = -1
+	}
+}
+
+// Creates a level with the given name from the unowned rock and grass cells of b.
+// All other cells of b are ignored. The returned level is validated.
+func levelFromBoard(name string, b *Board) (*Level, error) {
+	l := &Level{Name: name}
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			f := &b.Fields[r][c]
+			if f.Owner != 0 || (f.Type != cellRock && f.Type != cellGrass) {
+				continue
+			}
+			cell := LevelCell{Row: r, Col: c, Type: f.Type}
+			if f.Type == cellGrass {
+				cell.Value = f.Value
+			}
+			l.Cells = append(l.Cells, cell)
+		}
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reads and validates the level stored in filename.
+// The level's name must match the file's base name.
+func LoadLevel(filename string) (*Level, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var l Level
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	if want := strings.TrimSuffix(filepath.Base(filename), levelFileExt); l.Name != want {
+		return nil, fmt.Errorf("level name %q does not match file name %q", l.Name, want)
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Loads all level files in dir. Invalid levels are logged and skipped.
+// Returns the valid levels sorted by name.
+func LoadLevels(dir string) ([]*Level, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*"+levelFileExt))
+	if err != nil {
+		return nil, err
+	}
+	var levels []*Level
+	for _, fn := range filenames {
+		l, err := LoadLevel(fn)
+		if err != nil {
+			log.Printf("Ignoring invalid level file %s: %s", fn, err)
+			continue
+		}
+		levels = append(levels, l)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Name < levels[j].Name
+	})
+	return levels, nil
+}
+
+// Result of exporting a game's board as a level, computed on the game master goroutine.
+type levelExport struct {
+	level *Level
+	err   error
+}
+
+// Creates a level from the board of a Freeform game.
+func exportLevel(gameEngine GameEngine, name string) levelExport {
+	if gameEngine.GameType() != gameTypeFreeform {
+		return levelExport{err: fmt.Errorf("levels can only be exported from Freeform games")}
+	}
+	l, err := levelFromBoard(name, gameEngine.Board())
+	return levelExport{level: l, err: err}
+}
+
+// Returns the level with the given name, or nil if there is none.
+func (s *Server) lookupLevel(name string) *Level {
+	for _, l := range s.levels {
+		if l.Name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleLevels(w http.ResponseWriter, r *http.Request) {
+	resp := LevelListResponse{Levels: make([]LevelInfo, len(s.levels))}
+	for i, l := range s.levels {
+		resp.Levels[i] = LevelInfo{Name: l.Name, FreeCells: l.FreeCells()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
+
+// Validates the level sent in the request body.
+func (s *Server) handleValidateLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	var l Level
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var resp ValidateLevelResponse
+	if err := l.Validate(); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Valid = true
+		resp.FreeCells = l.FreeCells()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
+
+// Sends the board of a Freeform game as a level file download.
+func (s *Server) handleExportLevel(w http.ResponseWriter, r *http.Request) {
+	p, err := s.lookupPlayerFromCookie(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	gameId := gameIdFromPath(r.URL.Path)
+	game := s.lookupGame(gameId)
+	if game == nil {
+		http.Error(w, fmt.Sprintf("No game with ID %q", gameId), http.StatusNotFound)
+		return
+	}
+	l, err := game.exportLevel(p.Id, r.URL.Query().Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+	s.IncCounter("/levels/exported")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", l.Name+levelFileExt))
+	w.Write(data)
+}
@@ -0,0 +1,111 @@
+package hexz
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLevelValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		level Level
+		valid bool
+	}{
+		{"empty", Level{Name: "empty"}, false}, // 105 playable cells
+		{"one rock", Level{Name: "rock", Cells: []LevelCell{{Row: 0, Col: 0, Type: cellRock}}}, true},
+		{"grass", Level{Name: "grass", Cells: []LevelCell{
+			{Row: 0, Col: 0, Type: cellRock},
+			{Row: 1, Col: 1, Type: cellGrass, Value: 3},
+		}}, true},
+		{"bad name", Level{Name: "../x", Cells: []LevelCell{{Row: 0, Col: 0, Type: cellRock}}}, false},
+		{"off board", Level{Name: "x", Cells: []LevelCell{{Row: 1, Col: 9, Type: cellRock}}}, false},
+		{"duplicate", Level{Name: "x", Cells: []LevelCell{
+			{Row: 0, Col: 0, Type: cellRock},
+			{Row: 0, Col: 1, Type: cellRock},
+			{Row: 0, Col: 1, Type: cellRock},
+		}}, false},
+		{"grass value", Level{Name: "x", Cells: []LevelCell{
+			{Row: 0, Col: 0, Type: cellRock},
+			{Row: 1, Col: 1, Type: cellGrass, Value: flagzMaxValue + 1},
+		}}, false},
+		{"flag", Level{Name: "x", Cells: []LevelCell{{Row: 0, Col: 0, Type: cellFlag}}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.level.Validate()
+			if test.valid && err != nil {
+				t.Errorf("Want valid level, got error: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("Want invalid level, got no error")
+			}
+		})
+	}
+}
+
+func TestLevelFromFreeformBoard(t *testing.T) {
+	ge := &GameEngineFreeform{}
+	ge.Init()
+	moves := []GameEngineMove{
+		{row: 0, col: 0, cellType: cellRock},
+		{row: 2, col: 3, cellType: cellGrass},
+		{row: 2, col: 3, cellType: cellGrass}, // Grass value 2.
+		{row: 4, col: 4, cellType: cellFlag},  // Player cells are ignored.
+	}
+	for _, m := range moves {
+		m.move = ge.Board().Move
+		if !ge.MakeMove(m) {
+			t.Fatalf("Cannot make move %s", m.String())
+		}
+	}
+	l, err := levelFromBoard("test", ge.Board())
+	if err != nil {
+		t.Fatal("Cannot create level: ", err)
+	}
+	if len(l.Cells) != 2 {
+		t.Fatalf("Want 2 cells, got %+v", l.Cells)
+	}
+	g := NewGameEngineFlagz(rand.NewSource(1))
+	g.SetLevel(l)
+	if f := g.B.Fields[0][0]; f.Type != cellRock {
+		t.Errorf("Want rock at (0,0), got %+v", f)
+	}
+	if f := g.B.Fields[2][3]; f.Type != cellGrass || f.Value != 2 {
+		t.Errorf("Want grass with value 2 at (2,3), got %+v", f)
+	}
+	if want := len(g.B.FlatFields) - 2; g.FreeCells != want {
+		t.Errorf("Want %d free cells, got %d", want, g.FreeCells)
+	}
+	// Resets keep the level.
+	g.Reset()
+	if f := g.B.Fields[0][0]; f.Type != cellRock {
+		t.Errorf("Want rock at (0,0) after reset, got %+v", f)
+	}
+}
+
+func TestLoadLevels(t *testing.T) {
+	dir := t.TempDir()
+	write := func(filename string, l Level) {
+		data, err := json.Marshal(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, filename), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rock := []LevelCell{{Row: 0, Col: 0, Type: cellRock}}
+	write("b.json", Level{Name: "b", Cells: rock})
+	write("a.json", Level{Name: "a", Cells: rock})
+	write("c.json", Level{Name: "other", Cells: rock}) // Name does not match file name.
+	write("d.json", Level{Name: "d"})                  // Odd number of playable cells.
+	levels, err := LoadLevels(dir)
+	if err != nil {
+		t.Fatal("Cannot load levels: ", err)
+	}
+	if len(levels) != 2 || levels[0].Name != "a" || levels[1].Name != "b" {
+		t.Errorf("Want levels a and b, got %+v", levels)
+	}
+}
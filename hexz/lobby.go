@@ -0,0 +1,178 @@
+package hexz
+
+// Private games, invitations and the game lobby.
+
+import (
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	privateGameIdLen    = 16
+	defaultLobbyLimit   = 10
+	maxLobbyLimit       = 100
+	inviteTokenUrlParam = "invite"
+)
+
+// Options chosen by the host when creating a new game.
+type gameOptions struct {
+	singlePlayer bool
+	numPlayers   int              // Number of players. The game type's default is used if 0.
+	private      bool             // Private games are not listed in the lobby and need an invite token to join.
+	reservedFor  string           // Name of the only player (besides the host) who may take a seat. Empty if unrestricted.
+	seeds        *GameSeeds       // Seeds to start the game with. Random seeds are used if nil.
+	difficulty   *difficultyLevel // Strength of the CPU player in single player games.
+	level        *Level           // Starting layout of Flagz games. Random if nil.
+}
+
+// Parses the seeds given in a new game request. Seeds that are empty are chosen randomly.
+func parseGameSeeds(engineSeed, cpuSeed string) (GameSeeds, error) {
+	seeds := generateGameSeeds()
+	if engineSeed != "" {
+		x, err := strconv.ParseInt(engineSeed, 10, 64)
+		if err != nil {
+			return seeds, fmt.Errorf("invalid value for 'engineSeed'")
+		}
+		seeds.Engine = x
+	}
+	if cpuSeed != "" {
+		x, err := strconv.ParseInt(cpuSeed, 10, 64)
+		if err != nil {
+			return seeds, fmt.Errorf("invalid value for 'cpuSeed'")
+		}
+		seeds.Cpu = x
+	}
+	return seeds, nil
+}
+
+// Generates a long random game ID for private games.
+// Unlike generateGameId, this uses a cryptographically secure source,
+// so IDs cannot be guessed.
+func generatePrivateGameId() string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	p := make([]byte, privateGameIdLen)
+	crand.Read(p)
+	var b strings.Builder
+	for _, x := range p {
+		// 256 is not divisible by 26, but the resulting bias is negligible for our purposes.
+		b.WriteByte(alphabet[int(x)%len(alphabet)])
+	}
+	return b.String()
+}
+
+// Generates a random 128-bit hex string used to invite players to private games.
+func generateInviteToken() string {
+	p := make([]byte, 16)
+	crand.Read(p)
+	return hex.EncodeToString(p)
+}
+
+// Returns true if player p may view the game (as a player or spectator).
+// inviteToken is the token the player presented, if any.
+func (g *GameHandle) canAccess(p Player, inviteToken string) bool {
+	if !g.private || p.Id == g.hostId {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(inviteToken), []byte(g.inviteToken)) == 1
+}
+
+// Returns true if player p may take one of the game's seats.
+// Players who may access the game but not take a seat join as spectators.
+func (g *GameHandle) canTakeSeat(p Player) bool {
+	return g.reservedFor == "" || p.Id == g.hostId || p.Name == g.reservedFor
+}
+
+// Returns the URL path (with invite token for private games) to share the game.
+func (g *GameHandle) inviteUrlPath() string {
+	if !g.private {
+		return fmt.Sprintf("/hexz/%s", g.id)
+	}
+	return fmt.Sprintf("/hexz/%s?%s=%s", g.id, inviteTokenUrlParam, url.QueryEscape(g.inviteToken))
+}
+
+// Criteria to select games shown in the lobby.
+type gameFilter struct {
+	gameType  GameType // Empty matches all types.
+	openSeats bool     // If true, only games with at least one open seat match.
+	host      string   // Empty matches all hosts.
+	offset    int
+	limit     int
+}
+
+// Parses the lobby's query parameters. The limit is capped at maxLimit, unless maxLimit is 0.
+func parseGameFilter(q url.Values, maxLimit int) (gameFilter, error) {
+	f := gameFilter{limit: defaultLobbyLimit}
+	if t := q.Get("type"); t != "" {
+		if !validGameType(t) {
+			return f, fmt.Errorf("invalid game type %q", t)
+		}
+		f.gameType = GameType(t)
+	}
+	if q.Has("open") {
+		open, err := strconv.ParseBool(q.Get("open"))
+		if err != nil {
+			return f, fmt.Errorf("invalid value for 'open'")
+		}
+		f.openSeats = open
+	}
+	f.host = q.Get("host")
+	if q.Has("offset") {
+		offset, err := strconv.Atoi(q.Get("offset"))
+		if err != nil || offset < 0 {
+			return f, fmt.Errorf("invalid value for 'offset'")
+		}
+		f.offset = offset
+	}
+	if q.Has("limit") {
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			return f, fmt.Errorf("invalid value for 'limit'")
+		}
+		if maxLimit > 0 && limit > maxLimit {
+			limit = maxLimit
+		}
+		f.limit = limit
+	}
+	return f, nil
+}
+
+func (f *gameFilter) matches(g *GameInfo) bool {
+	return (f.gameType == "" || f.gameType == g.GameType) &&
+		(!f.openSeats || g.OpenSeats > 0) &&
+		(f.host == "" || f.host == g.Host)
+}
+
+// Returns the public games matching the filter, most recent first,
+// together with the total number of matching games.
+func (s *Server) listGames(f gameFilter) ([]*GameInfo, int) {
+	s.ongoingGamesMut.Lock()
+	gameInfos := []*GameInfo{}
+	for _, g := range s.ongoingGames {
+		if g.private {
+			continue
+		}
+		info := g.info(s.debugMode.Load())
+		if f.matches(info) {
+			gameInfos = append(gameInfos, info)
+		}
+	}
+	s.ongoingGamesMut.Unlock()
+	sort.Slice(gameInfos, func(i, j int) bool {
+		return gameInfos[i].Started.After(gameInfos[j].Started)
+	})
+	total := len(gameInfos)
+	if f.offset >= total {
+		return []*GameInfo{}, total
+	}
+	end := f.offset + f.limit
+	if end > total {
+		end = total
+	}
+	return gameInfos[f.offset:end], total
+}
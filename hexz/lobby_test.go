@@ -0,0 +1,176 @@
+package hexz
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGeneratePrivateGameId(t *testing.T) {
+	re := regexp.MustCompile(fmt.Sprintf("^[A-Z]{%d}$", privateGameIdLen))
+	id := generatePrivateGameId()
+	if !re.MatchString(id) {
+		t.Errorf("Invalid private game ID: %q", id)
+	}
+	if id == generatePrivateGameId() {
+		t.Errorf("Generated the same ID twice: %q", id)
+	}
+}
+
+func TestGameAccess(t *testing.T) {
+	host := Player{Id: "h1", Name: "host"}
+	guest := Player{Id: "g1", Name: "guest"}
+	other := Player{Id: "o1", Name: "other"}
+	g := &GameHandle{
+		id:          "ABCDEF",
+		hostId:      host.Id,
+		private:     true,
+		inviteToken: "secret",
+		reservedFor: guest.Name,
+	}
+	if !g.canAccess(host, "") {
+		t.Error("Host should always have access")
+	}
+	if g.canAccess(guest, "") || g.canAccess(guest, "wrong") {
+		t.Error("Guest should need a valid invite token")
+	}
+	if !g.canAccess(guest, "secret") || !g.canAccess(other, "secret") {
+		t.Error("Valid invite token should grant access")
+	}
+	if !g.canTakeSeat(host) || !g.canTakeSeat(guest) {
+		t.Error("Host and guest should be able to take a seat")
+	}
+	if g.canTakeSeat(other) {
+		t.Error("Other players should not be able to take a reserved seat")
+	}
+	public := &GameHandle{id: "ABCDEF"}
+	if !public.canAccess(other, "") || !public.canTakeSeat(other) {
+		t.Error("Everyone should be able to join public games")
+	}
+}
+
+func TestParseGameSeeds(t *testing.T) {
+	seeds, err := parseGameSeeds("42", "-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seeds != (GameSeeds{Engine: 42, Cpu: -7}) {
+		t.Errorf("Unexpected seeds: %+v", seeds)
+	}
+	seeds, err = parseGameSeeds("42", "")
+	if err != nil || seeds.Engine != 42 {
+		t.Errorf("Want engine seed 42, got %+v (err: %v)", seeds, err)
+	}
+	if _, err := parseGameSeeds("x", ""); err == nil {
+		t.Error("Expected error for invalid engine seed")
+	}
+	if _, err := parseGameSeeds("", "1.5"); err == nil {
+		t.Error("Expected error for invalid CPU seed")
+	}
+}
+
+func TestParseGameFilter(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    gameFilter
+		wantErr bool
+	}{
+		{"", gameFilter{limit: defaultLobbyLimit}, false},
+		{"type=Flagz&open=true&host=bob", gameFilter{gameType: gameTypeFlagz, openSeats: true, host: "bob", limit: defaultLobbyLimit}, false},
+		{"offset=20&limit=1000", gameFilter{offset: 20, limit: maxLobbyLimit}, false},
+		{"type=Chess", gameFilter{}, true},
+		{"limit=0", gameFilter{}, true},
+		{"offset=-1", gameFilter{}, true},
+		{"open=maybe", gameFilter{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(test.query)
+			got, err := parseGameFilter(q, maxLobbyLimit)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("want %+v, got %+v", test.want, got)
+			}
+		})
+	}
+	// Peers may ask for more games than the lobby shows.
+	q, _ := url.ParseQuery("limit=1000")
+	if got, _ := parseGameFilter(q, 0); got.limit != 1000 {
+		t.Errorf("Want uncapped limit 1000, got %d", got.limit)
+	}
+}
+
+func TestListGames(t *testing.T) {
+	s := NewServer(&ServerConfig{})
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		g := &GameHandle{
+			id:       fmt.Sprintf("G%02d", i),
+			host:     "alice",
+			gameType: gameTypeFlagz,
+			started:  start.Add(time.Duration(i) * time.Second),
+			private:  i%5 == 0,
+		}
+		if i%2 == 0 {
+			g.host = "bob"
+			g.gameType = gameTypeClassic
+			g.openSeats.Store(1)
+		}
+		s.ongoingGames[g.id] = g
+	}
+	games, total := s.listGames(gameFilter{limit: 10})
+	if total != 20 {
+		t.Errorf("Want 20 public games, got %d", total)
+	}
+	if len(games) != 10 || games[0].Id != "G24" {
+		t.Errorf("Unexpected first page: %d games, first %s", len(games), games[0].Id)
+	}
+	games, _ = s.listGames(gameFilter{offset: 18, limit: 10})
+	if len(games) != 2 {
+		t.Errorf("Want 2 games on last page, got %d", len(games))
+	}
+	games, total = s.listGames(gameFilter{openSeats: true, limit: 100})
+	if total != 10 {
+		t.Errorf("Want 10 games with open seats, got %d", total)
+	}
+	for _, g := range games {
+		if g.Host != "bob" || g.GameType != gameTypeClassic || g.OpenSeats != 1 {
+			t.Errorf("Unexpected game: %+v", g)
+		}
+	}
+	if _, total := s.listGames(gameFilter{host: "alice", gameType: gameTypeFlagz, limit: 10}); total != 10 {
+		t.Errorf("Want 10 games hosted by alice, got %d", total)
+	}
+	// Seeds would make the CPU's moves predictable, so they are hidden while the game is running.
+	if games, _ := s.listGames(gameFilter{limit: 1}); games[0].Seeds != nil {
+		t.Errorf("Seeds of running game %s are visible", games[0].Id)
+	}
+	s.debugMode.Store(true)
+	if games, _ := s.listGames(gameFilter{limit: 1}); games[0].Seeds == nil {
+		t.Errorf("Want seeds of game %s in debug mode", games[0].Id)
+	}
+}
+
+func TestGameInfoSeeds(t *testing.T) {
+	g := &GameHandle{id: "G", seeds: GameSeeds{Engine: 1, Cpu: 2}, done: make(chan struct{})}
+	if g.info(false).Seeds != nil {
+		t.Error("Seeds of running game are visible")
+	}
+	if got := g.info(true).Seeds; got == nil || *got != g.seeds {
+		t.Errorf("Want seeds %+v, got %+v", g.seeds, got)
+	}
+	close(g.done)
+	if got := g.info(false).Seeds; got == nil || *got != g.seeds {
+		t.Errorf("Want seeds %+v of finished game, got %+v", g.seeds, got)
+	}
+}
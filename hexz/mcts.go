@@ -17,6 +17,7 @@ type mcNode struct {
 	count        float64
 	done         bool
 	turn         int
+	move         int // Move number of the node's move.
 	liveChildren int // Number of child nodes that are not done yet.
 }
 
@@ -57,14 +58,51 @@ type MCTS struct {
 	rnd              *rand.Rand
 	MaxFlagPositions int // maximum number of (random) positions to consider for placing a flag in a single move.
 	UctFactor        float64
-	FlagsFirst       bool // If true, flags will be played whenever possible.
+	FlagsFirst       bool          // If true, flags will be played whenever possible.
+	Rollout          RolloutPolicy // Policy to choose moves during random playouts.
+	MaxIterations    int           // If > 0, SuggestMove stops after this many iterations, even if time is left.
+	// Flagz positions with at most EndgameFreeCells free cells or at most EndgameMoves
+	// legal moves are solved exactly instead of sampled. Disabled if both are 0.
+	EndgameFreeCells int
+	EndgameMoves     int
+	EndgameMaxNodes  int // Node budget for solving the root position. Positions needing more are sampled.
+	endgame          *endgameSolver
+	deadline         time.Time // End of the current SuggestMove call. Endgame solving stops at this time.
+}
+
+// Returns the endgame solver to use for ge's current position, or nil if the position should be sampled.
+func (mcts *MCTS) endgameSolverFor(ge SinglePlayerGameEngine) (*endgameSolver, *GameEngineFlagz) {
+	g, ok := ge.(*GameEngineFlagz)
+	if s, isSearch := ge.(*flagzSearchEngine); isSearch && !s.IsDone() && s.numPlayers == 2 &&
+		(s.free.count() <= mcts.EndgameFreeCells || s.numLegalMoves() <= mcts.EndgameMoves) {
+		// Converting is expensive, so only do it for positions the solver will handle.
+		g, ok = s.flagzEngine(), true
+	}
+	if !ok || g.IsDone() || g.NumPlayers() != 2 {
+		// The solver only handles two-player games.
+		return nil, nil
+	}
+	if !(g.FreeCells <= mcts.EndgameFreeCells || g.numLegalMoves() <= mcts.EndgameMoves) {
+		return nil, nil
+	}
+	if mcts.endgame == nil {
+		// The solver is kept across searches, since positions in its table stay valid.
+		mcts.endgame = newEndgameSolver()
+	}
+	return mcts.endgame, g
+}
+
+func (mcts *MCTS) endgameMaxNodes() int {
+	if mcts.EndgameMaxNodes > 0 {
+		return mcts.EndgameMaxNodes
+	}
+	return defaultEndgameMaxNodes
 }
 
 func (mcts *MCTS) playRandomGame(ge SinglePlayerGameEngine, firstMove *mcNode) (winner int) {
-	b := ge.Board()
 	if !ge.MakeMove(GameEngineMove{
 		playerNum: firstMove.turn,
-		move:      b.Move,
+		move:      firstMove.move,
 		row:       firstMove.r,
 		col:       firstMove.c,
 		cellType:  firstMove.cellType,
@@ -72,7 +110,7 @@ func (mcts *MCTS) playRandomGame(ge SinglePlayerGameEngine, firstMove *mcNode) (
 		panic("Invalid move")
 	}
 	for !ge.IsDone() {
-		m, err := ge.RandomMove()
+		m, err := mcts.Rollout.NextMove(ge, mcts.rnd)
 		if err != nil {
 			log.Fatalf("Could not suggest a move: %s", err.Error())
 		}
@@ -100,58 +138,100 @@ func (mcts *MCTS) getNextByUtc(node *mcNode) *mcNode {
 	return next
 }
 
-func (mcts *MCTS) nextMoves(node *mcNode, b *Board) []*mcNode {
-	cs := make([]*mcNode, 0, 16)
-	hasFlag := b.Resources[b.Turn-1].NumPieces[cellFlag] > 0
-	maxFlags := mcts.MaxFlagPositions
-	var flagMoves []*mcNode
+// Collects the child nodes of a node whose move is made by player turn at move number move.
+type moveCollector struct {
+	mcts      *MCTS
+	turn      int
+	move      int
+	hasFlag   bool
+	cs        []*mcNode
+	flagMoves []*mcNode
+	nFlags    int
+}
+
+func (mcts *MCTS) newMoveCollector(turn, move int, hasFlag bool) *moveCollector {
+	mc := &moveCollector{
+		mcts:    mcts,
+		turn:    turn,
+		move:    move,
+		hasFlag: hasFlag,
+		cs:      make([]*mcNode, 0, 16),
+	}
 	if hasFlag {
-		flagMoves = make([]*mcNode, maxFlags)
+		mc.flagMoves = make([]*mcNode, mcts.MaxFlagPositions)
 	}
-	nFlags := 0
-	for r := 0; r < len(b.Fields); r++ {
-		for c := 0; c < len(b.Fields[r]); c++ {
-			f := &b.Fields[r][c]
-			if f.occupied() {
-				continue
-			}
-			if f.isAvail(b.Turn) {
-				cs = append(cs, &mcNode{
-					r: r, c: c, turn: b.Turn,
-				})
-			}
-			if hasFlag && (mcts.rnd.Float64() < float64(maxFlags)/(float64(nFlags)+1)) {
-				// reservoir sampling to pick maxFlags with equal probability among all possibilities.
-				k := nFlags
-				if k >= maxFlags {
-					k = mcts.rnd.Intn(maxFlags)
-				}
-				flagMoves[k] = &mcNode{
-					r: r, c: c, turn: b.Turn, cellType: cellFlag,
-				}
-				nFlags++
-			}
+	return mc
+}
+
+// Adds the moves on the free cell (r, c). avail is true if the player can make a normal move there.
+// Cells must be added in row-major order.
+func (mc *moveCollector) add(r, c int, avail bool) {
+	if avail {
+		mc.cs = append(mc.cs, &mcNode{
+			r: r, c: c, turn: mc.turn, move: mc.move,
+		})
+	}
+	maxFlags := mc.mcts.MaxFlagPositions
+	if mc.hasFlag && (mc.mcts.rnd.Float64() < float64(maxFlags)/(float64(mc.nFlags)+1)) {
+		// reservoir sampling to pick maxFlags with equal probability among all possibilities.
+		k := mc.nFlags
+		if k >= maxFlags {
+			k = mc.mcts.rnd.Intn(maxFlags)
+		}
+		mc.flagMoves[k] = &mcNode{
+			r: r, c: c, turn: mc.turn, move: mc.move, cellType: cellFlag,
 		}
+		mc.nFlags++
 	}
-	if nFlags > maxFlags {
-		nFlags = maxFlags
+}
+
+func (mc *moveCollector) moves() []*mcNode {
+	nFlags := mc.nFlags
+	if nFlags > mc.mcts.MaxFlagPositions {
+		nFlags = mc.mcts.MaxFlagPositions
 	}
-	if nFlags > 0 && mcts.FlagsFirst {
+	if nFlags > 0 && mc.mcts.FlagsFirst {
 		// Forced play of flags
-		return flagMoves[:nFlags]
+		return mc.flagMoves[:nFlags]
 	}
 	if nFlags == 0 {
-		return cs
+		return mc.cs
 	}
-	return append(cs, flagMoves[:nFlags]...)
+	return append(mc.cs, mc.flagMoves[:nFlags]...)
 }
 
-func (mcts *MCTS) backpropagate(path []*mcNode, winner int) {
+func (mcts *MCTS) nextMoves(node *mcNode, ge SinglePlayerGameEngine) []*mcNode {
+	if s, ok := ge.(*flagzSearchEngine); ok {
+		pIdx := s.turn - 1
+		mc := mcts.newMoveCollector(s.turn, s.move, s.flags[pIdx] > 0)
+		for i := 0; i < numBoardFields; i++ {
+			if s.free.has(i) {
+				mc.add(flatIdx[i].r, flatIdx[i].c, s.avail[pIdx].has(i))
+			}
+		}
+		return mc.moves()
+	}
+	b := ge.Board()
+	mc := mcts.newMoveCollector(b.Turn, b.Move, b.Resources[b.Turn-1].NumPieces[cellFlag] > 0)
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			f := &b.Fields[r][c]
+			if !f.occupied() {
+				mc.add(r, c, f.isAvail(b.Turn))
+			}
+		}
+	}
+	return mc.moves()
+}
+
+// Updates the statistics of all nodes on path. Each node's wins are counted for the
+// player who made the node's move. A draw counts as an equal share of a win for each player.
+func (mcts *MCTS) backpropagate(path []*mcNode, winner, numPlayers int) {
 	for i := len(path) - 1; i >= 0; i-- {
 		if path[i].turn == winner {
 			path[i].wins += 1
 		} else if winner == 0 {
-			path[i].wins += 0.5
+			path[i].wins += 1 / float64(numPlayers)
 		}
 		path[i].count += 1
 	}
@@ -159,11 +239,24 @@ func (mcts *MCTS) backpropagate(path []*mcNode, winner int) {
 
 func (mcts *MCTS) run(ge SinglePlayerGameEngine, path []*mcNode) (depth int) {
 	node := path[len(path)-1]
-	b := ge.Board()
 	if node.children == nil {
 		// Terminal node in our exploration graph, but not in the whole game:
 		// While traversing a path we play moves and detect when the game IsDone (below).
-		cs := mcts.nextMoves(node, b)
+		if len(path) > 1 {
+			if solver, g := mcts.endgameSolverFor(ge); solver != nil {
+				budget := mcts.endgameMaxNodes() / endgameInTreeBudgetDivisor
+				if budget == 0 {
+					budget = 1
+				}
+				if winner, ok := solver.solve(g, budget, mcts.deadline); ok {
+					// Proven nodes are treated like terminal nodes.
+					node.done = true
+					mcts.backpropagate(path, winner, ge.NumPlayers())
+					return len(path)
+				}
+			}
+		}
+		cs := mcts.nextMoves(node, ge)
 		if len(cs) == 0 {
 			panic(fmt.Sprintf("No next moves on allegedly non-final node: %s", node.String()))
 		}
@@ -173,7 +266,7 @@ func (mcts *MCTS) run(ge SinglePlayerGameEngine, path []*mcNode) (depth int) {
 		c := cs[mcts.rnd.Intn(len(cs))]
 		winner := mcts.playRandomGame(ge, c)
 		path = append(path, c)
-		mcts.backpropagate(path, winner)
+		mcts.backpropagate(path, winner, ge.NumPlayers())
 		return len(path)
 	}
 	// Node has children already, descend to the one with the highest UTC.
@@ -183,7 +276,7 @@ func (mcts *MCTS) run(ge SinglePlayerGameEngine, path []*mcNode) (depth int) {
 		panic(fmt.Sprintf("No children left for node: %s", node.String()))
 	}
 	move := GameEngineMove{
-		playerNum: c.turn, move: b.Move, row: c.r, col: c.c, cellType: c.cellType,
+		playerNum: c.turn, move: c.move, row: c.r, col: c.c, cellType: c.cellType,
 	}
 	if !ge.MakeMove(move) {
 		panic(fmt.Sprintf("Failed to make move %s", move.String()))
@@ -193,7 +286,7 @@ func (mcts *MCTS) run(ge SinglePlayerGameEngine, path []*mcNode) (depth int) {
 		// This was the last move. Propagate the result up.
 		c.done = true
 		winner := ge.Winner()
-		mcts.backpropagate(path, winner)
+		mcts.backpropagate(path, winner, ge.NumPlayers())
 		depth = len(path)
 	} else {
 		// Not done: descend to next level
@@ -224,6 +317,9 @@ type MCTSStats struct {
 	TreeSize      int
 	Elapsed       time.Duration
 	FullyExplored bool
+	BookHit       bool // True if the move was taken from an opening book without searching.
+	Proven        bool // True if the move was proven optimal by the endgame solver.
+	ProvenWinner  int  // Winner under perfect play if Proven is true. 0 for a draw.
 	Moves         []MCTSMoveStats
 }
 
@@ -249,6 +345,12 @@ func (s *MCTSStats) MaxQ() float64 {
 
 func (s *MCTSStats) String() string {
 	var sb strings.Builder
+	if s.BookHit {
+		sb.WriteString("book hit\n")
+	}
+	if s.Proven {
+		fmt.Fprintf(&sb, "proven: winner %d\n", s.ProvenWinner)
+	}
 	fmt.Fprintf(&sb, "N: %d\nmaxDepth:%d\nsize:%d\nelapsed:%.3f\nN/sec:%.1f\n",
 		s.Iterations, s.MaxDepth, s.TreeSize, s.Elapsed.Seconds(), float64(s.Iterations)/s.Elapsed.Seconds())
 	for _, m := range s.Moves {
@@ -262,24 +364,102 @@ func (s *MCTSStats) String() string {
 }
 
 func NewMCTS() *MCTS {
+	return NewMCTSFromSource(rand.NewSource(time.Now().UnixNano()))
+}
+
+// Creates a new MCTS that uses src for all of its random choices.
+// Searches are only reproducible if they are limited by MaxIterations, not by time.
+func NewMCTSFromSource(src rand.Source) *MCTS {
 	return &MCTS{
-		rnd:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		rnd:              rand.New(src),
 		MaxFlagPositions: 5,
 		UctFactor:        1.0,
 		FlagsFirst:       false,
+		Rollout:          UniformRolloutPolicy{},
 	}
 }
 
+// Solves the position of gameEngine exactly, if it is small enough.
+// Returns false if the position was not solved.
+func (mcts *MCTS) solveRoot(gameEngine SinglePlayerGameEngine) (GameEngineMove, *MCTSStats, bool) {
+	started := time.Now()
+	solver, g := mcts.endgameSolverFor(gameEngine)
+	if solver == nil {
+		return GameEngineMove{}, nil, false
+	}
+	moves, ok := solver.solveMoves(g, mcts.endgameMaxNodes(), mcts.deadline)
+	if !ok || len(moves) == 0 {
+		return GameEngineMove{}, nil, false
+	}
+	turn := g.B.Turn
+	// Win rate of each move for the player to move.
+	q := func(winner int) float64 {
+		switch winner {
+		case turn:
+			return 1
+		case 0:
+			return 0.5
+		}
+		return 0
+	}
+	stats := &MCTSStats{
+		FullyExplored: true,
+		Proven:        true,
+		Moves:         make([]MCTSMoveStats, len(moves)),
+	}
+	best := 0
+	for i, m := range moves {
+		if q(m.winner) > q(moves[best].winner) {
+			best = i
+		}
+		stats.Moves[i] = MCTSMoveStats{
+			row:      m.move.row,
+			col:      m.move.col,
+			cellType: m.move.cellType,
+			U:        q(m.winner),
+			Q:        q(m.winner),
+		}
+	}
+	stats.ProvenWinner = moves[best].winner
+	stats.Elapsed = time.Since(started)
+	return moves[best].move, stats, true
+}
+
 func (mcts *MCTS) SuggestMove(gameEngine SinglePlayerGameEngine, maxDuration time.Duration) (GameEngineMove, *MCTSStats) {
-	root := &mcNode{turn: gameEngine.Board().Turn}
 	started := time.Now()
+	// Solving counts against the think time, so the sampling below gets what is left.
+	mcts.deadline = started.Add(maxDuration)
+	if m, stats, ok := mcts.solveRoot(gameEngine); ok {
+		return m, stats
+	}
+	root := &mcNode{turn: gameEngine.Board().Turn}
+	// Uniform rollouts of Flagz games are played on the faster bitboard representation.
+	// Each iteration copies the root position into the same scratch engine.
+	// The other rollout policies need the board of a GameEngineFlagz.
+	var search, scratch *flagzSearchEngine
+	if _, ok := mcts.Rollout.(UniformRolloutPolicy); ok {
+		if g, ok := gameEngine.(*GameEngineFlagz); ok {
+			if s, err := newFlagzSearchEngine(g, mcts.rnd); err == nil {
+				search, scratch = s, &flagzSearchEngine{}
+			}
+		}
+	}
 	maxDepth := 0
 	for n := 0; ; n++ {
-		// Check every N rounds if we're done.
-		if n&63 == 0 && time.Since(started) >= maxDuration {
+		// Check every N rounds if we're done. The first round always runs, so there is a move to suggest.
+		if n > 0 && n&63 == 0 && time.Since(started) >= maxDuration {
+			break
+		}
+		if mcts.MaxIterations > 0 && n >= mcts.MaxIterations {
 			break
 		}
-		ge := gameEngine.Clone(mcts.rnd)
+		var ge SinglePlayerGameEngine
+		if search != nil {
+			*scratch = *search
+			ge = scratch
+		} else {
+			ge = gameEngine.Clone(mcts.rnd)
+		}
 		path := make([]*mcNode, 1, 100)
 		path[0] = root
 		depth := mcts.run(ge, path)
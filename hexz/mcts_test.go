@@ -57,6 +57,38 @@ func TestMCTSFull(t *testing.T) {
 	}
 }
 
+func TestMCTSDeterministicWithSeeds(t *testing.T) {
+	// Same seeds and a fixed iteration budget must yield the same game.
+	playGame := func() []GameEngineMove {
+		ge := NewGameEngineFlagz(rand.NewSource(11))
+		mcts := []*MCTS{
+			NewMCTSFromSource(rand.NewSource(12)),
+			NewMCTSFromSource(rand.NewSource(13)),
+		}
+		var moves []GameEngineMove
+		for i := 0; i < 10 && !ge.IsDone(); i++ {
+			m := mcts[ge.Board().Turn-1]
+			m.MaxIterations = 50
+			move, _ := m.SuggestMove(ge, time.Hour)
+			if !ge.MakeMove(move) {
+				t.Fatal("Cannot make move")
+			}
+			moves = append(moves, move)
+		}
+		return moves
+	}
+	want := playGame()
+	got := playGame()
+	if len(got) != len(want) {
+		t.Fatalf("Want %d moves, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Move %d: want %s, got %s", i, want[i].String(), got[i].String())
+		}
+	}
+}
+
 // Quick check that sqrt and log are just as fast on float32 as they are on
 // float64, despite the casting nuisances.
 
@@ -151,3 +183,21 @@ func BenchmarkLog(b *testing.B) {
 		}
 	}
 }
+
+func TestMCTSMultiPlayer(t *testing.T) {
+	ge := NewGameEngineFlagzN(3, rand.NewSource(1))
+	mcts := NewMCTSFromSource(rand.NewSource(2))
+	mcts.MaxIterations = 500
+	for i := 0; i < 6 && !ge.IsDone(); i++ {
+		m, stats := mcts.SuggestMove(ge, time.Hour)
+		if stats.Iterations != 500 {
+			t.Errorf("Want 500 iterations, got %d", stats.Iterations)
+		}
+		if q := stats.MaxQ(); q < 0 || q > 1 {
+			t.Errorf("Win rate out of range: %f", q)
+		}
+		if !ge.MakeMove(m) {
+			t.Fatalf("Could not make suggested move %s", m.String())
+		}
+	}
+}
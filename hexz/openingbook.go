@@ -0,0 +1,175 @@
+package hexz
+
+// Opening book for Flagz.
+//
+// Positions are keyed by a canonical hash that is invariant under the board's
+// symmetries (horizontal and vertical mirroring), so a single entry covers up
+// to four equivalent positions. Moves are stored in the coordinates of the
+// canonical orientation and mapped back when they are looked up.
+//
+// Since Flagz boards start with a random layout of rocks and grass, the book
+// only helps for layouts it has seen before, e.g. games started from recorded
+// seeds or fixed levels.
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+)
+
+const numBoardSymmetries = 4
+
+type BookEntry struct {
+	Hash     uint64   `json:"hash,string"`
+	Move     int      `json:"move"` // Move number of the position. Informational only.
+	Row      int      `json:"row"`  // Row in the canonical orientation.
+	Col      int      `json:"col"`  // Column in the canonical orientation.
+	CellType CellType `json:"cellType"`
+	WinRate  float64  `json:"winRate"` // Estimated win rate of the move for the player to move.
+	Visits   int      `json:"visits"`  // Number of MCTS iterations spent on the move during analysis.
+}
+
+type OpeningBook struct {
+	entries map[uint64]*BookEntry
+}
+
+func NewOpeningBook() *OpeningBook {
+	return &OpeningBook{entries: make(map[uint64]*BookEntry)}
+}
+
+// Applies symmetry sym to x. Bit 0 of sym mirrors horizontally, bit 1 vertically.
+// Every symmetry is its own inverse.
+func (b *Board) transformIdx(x idx, sym int) idx {
+	if sym&2 != 0 {
+		// Rows have the same parity after mirroring, since the number of rows is odd.
+		x.r = len(b.Fields) - 1 - x.r
+	}
+	if sym&1 != 0 {
+		x.c = len(b.Fields[x.r]) - 1 - x.c
+	}
+	return x
+}
+
+// Computes the hash of the board's visible state as seen after applying symmetry sym.
+func (b *Board) symmetricHash(sym int) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 0, 8+3*len(b.FlatFields))
+	buf = append(buf, byte(b.Turn))
+	for _, r := range b.Resources {
+		buf = append(buf, byte(r.NumPieces[cellFlag]))
+	}
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			src := b.transformIdx(idx{r, c}, sym)
+			f := &b.Fields[src.r][src.c]
+			buf = append(buf, byte(f.Type), byte(f.Owner), byte(f.Value))
+		}
+	}
+	h.Write(buf)
+	return h.Sum64()
+}
+
+// Returns the canonical hash of the board and the symmetry that maps the board to its canonical orientation.
+func (b *Board) canonicalHash() (hash uint64, sym int) {
+	hash = b.symmetricHash(0)
+	for s := 1; s < numBoardSymmetries; s++ {
+		if h := b.symmetricHash(s); h < hash {
+			hash, sym = h, s
+		}
+	}
+	return hash, sym
+}
+
+func (book *OpeningBook) Len() int {
+	return len(book.entries)
+}
+
+// Returns true if the book has an entry for board b or any of its symmetric equivalents.
+func (book *OpeningBook) Has(b *Board) bool {
+	hash, _ := b.canonicalHash()
+	_, ok := book.entries[hash]
+	return ok
+}
+
+// Adds move m, chosen for the current position of ge after an analysis with the given stats.
+// Existing entries are only replaced by entries based on more visits.
+func (book *OpeningBook) Add(ge *GameEngineFlagz, m GameEngineMove, stats *MCTSStats) {
+	b := ge.Board()
+	hash, sym := b.canonicalHash()
+	e := &BookEntry{Hash: hash, Move: b.Move, CellType: m.cellType}
+	canon := b.transformIdx(idx{m.row, m.col}, sym)
+	e.Row, e.Col = canon.r, canon.c
+	for _, s := range stats.Moves {
+		if s.row == m.row && s.col == m.col && s.cellType == m.cellType {
+			e.WinRate = s.Q
+			e.Visits = s.iterations
+		}
+	}
+	if old, ok := book.entries[hash]; ok && old.Visits >= e.Visits {
+		return
+	}
+	book.entries[hash] = e
+}
+
+// Looks up the book move for the current position of ge. Returns the move and
+// stats describing the book hit, or false if the book has no (valid) move.
+func (book *OpeningBook) Lookup(ge SinglePlayerGameEngine) (GameEngineMove, *MCTSStats, bool) {
+	g, ok := ge.(*GameEngineFlagz)
+	if !ok || g.B.State != Running {
+		return GameEngineMove{}, nil, false
+	}
+	b := g.B
+	hash, sym := b.canonicalHash()
+	e, ok := book.entries[hash]
+	if !ok {
+		return GameEngineMove{}, nil, false
+	}
+	x := b.transformIdx(idx{e.Row, e.Col}, sym)
+	if !b.valid(x) {
+		return GameEngineMove{}, nil, false
+	}
+	// Guard against hash collisions: the move must be legal in this position.
+	f := &b.Fields[x.r][x.c]
+	if f.occupied() || (e.CellType == cellNormal && !f.isAvail(b.Turn)) ||
+		(e.CellType == cellFlag && b.Resources[b.Turn-1].NumPieces[cellFlag] == 0) ||
+		(e.CellType != cellNormal && e.CellType != cellFlag) {
+		return GameEngineMove{}, nil, false
+	}
+	m := GameEngineMove{playerNum: b.Turn, move: b.Move, row: x.r, col: x.c, cellType: e.CellType}
+	stats := &MCTSStats{
+		BookHit: true,
+		Moves: []MCTSMoveStats{
+			{row: x.r, col: x.c, cellType: e.CellType, Q: e.WinRate, U: e.WinRate, iterations: e.Visits},
+		},
+	}
+	return m, stats, true
+}
+
+func (book *OpeningBook) Save(filename string) error {
+	entries := make([]*BookEntry, 0, len(book.entries))
+	for _, e := range book.entries {
+		entries = append(entries, e)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+func LoadOpeningBook(filename string) (*OpeningBook, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*BookEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("corrupted opening book: %w", err)
+	}
+	book := NewOpeningBook()
+	for _, e := range entries {
+		book.entries[e.Hash] = e
+	}
+	return book, nil
+}
@@ -0,0 +1,99 @@
+package hexz
+
+import (
+	"math/rand"
+	"path"
+	"testing"
+	"time"
+)
+
+// Returns a copy of g's board with symmetry sym applied.
+func transformedFlagz(g *GameEngineFlagz, sym int) *GameEngineFlagz {
+	b := g.B.copy()
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			src := g.B.transformIdx(idx{r, c}, sym)
+			b.Fields[r][c] = g.B.Fields[src.r][src.c]
+		}
+	}
+	return NewGameEngineFlagzFromBoard(b, rand.NewSource(0))
+}
+
+func TestCanonicalHashSymmetric(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(7))
+	for i := 0; i < 10; i++ {
+		m, _ := ge.RandomMove()
+		ge.MakeMove(m)
+	}
+	want, _ := ge.B.canonicalHash()
+	for sym := 1; sym < numBoardSymmetries; sym++ {
+		if got, _ := transformedFlagz(ge, sym).B.canonicalHash(); got != want {
+			t.Errorf("Symmetry %d: want hash %x, got %x", sym, want, got)
+		}
+	}
+	m, _ := ge.RandomMove()
+	ge.MakeMove(m)
+	if got, _ := ge.B.canonicalHash(); got == want {
+		t.Error("Hash did not change after a move")
+	}
+}
+
+func TestOpeningBookLookup(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(3))
+	mcts := NewMCTSFromSource(rand.NewSource(4))
+	mcts.MaxIterations = 100
+	m, stats := mcts.SuggestMove(ge, time.Hour)
+	book := NewOpeningBook()
+	book.Add(ge, m, stats)
+
+	for sym := 0; sym < numBoardSymmetries; sym++ {
+		g := transformedFlagz(ge, sym)
+		bm, bstats, ok := book.Lookup(g)
+		if !ok {
+			t.Fatalf("Symmetry %d: no book hit", sym)
+		}
+		if !bstats.BookHit {
+			t.Errorf("Symmetry %d: BookHit not set", sym)
+		}
+		want := ge.B.transformIdx(idx{m.row, m.col}, sym)
+		if bm.row != want.r || bm.col != want.c || bm.cellType != m.cellType {
+			t.Errorf("Symmetry %d: want move %v, got %s", sym, want, bm.String())
+		}
+		if !g.MakeMove(bm) {
+			t.Errorf("Symmetry %d: book move %s is invalid", sym, bm.String())
+		}
+	}
+	// A different position must not hit.
+	ge.MakeMove(m)
+	if _, _, ok := book.Lookup(ge); ok {
+		t.Error("Unexpected book hit after a move")
+	}
+}
+
+func TestOpeningBookSaveLoad(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(5))
+	mcts := NewMCTSFromSource(rand.NewSource(6))
+	mcts.MaxIterations = 50
+	book := NewOpeningBook()
+	for i := 0; i < 3; i++ {
+		m, stats := mcts.SuggestMove(ge, time.Hour)
+		book.Add(ge, m, stats)
+		ge.MakeMove(m)
+	}
+	fn := path.Join(t.TempDir(), "book.json")
+	if err := book.Save(fn); err != nil {
+		t.Fatal("Cannot save book: ", err)
+	}
+	loaded, err := LoadOpeningBook(fn)
+	if err != nil {
+		t.Fatal("Cannot load book: ", err)
+	}
+	if loaded.Len() != book.Len() {
+		t.Fatalf("Want %d entries, got %d", book.Len(), loaded.Len())
+	}
+	for h, e := range book.entries {
+		if got := loaded.entries[h]; got == nil || *got != *e {
+			t.Errorf("Entry %x: want %+v, got %+v", h, e, got)
+		}
+	}
+}
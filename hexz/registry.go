@@ -0,0 +1,123 @@
+package hexz
+
+// Registry of all game types.
+//
+// Each game type registers a descriptor in an init function of its engine's file.
+// Everything else (validation of new game requests, the new game page, tools)
+// learns about the available game types from the registry.
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+)
+
+// Describes a game type.
+type GameTypeDescriptor struct {
+	GameTypeInfo
+	// Creates an initialized engine for numPlayers players, which is within the
+	// game type's player count range.
+	NewEngine func(numPlayers int, src rand.Source) GameEngine
+	// True if games can be started from a level (see level.go).
+	Levels bool
+}
+
+var (
+	gameTypesByType = make(map[GameType]*GameTypeDescriptor)
+	// Game types in registration order.
+	allGameTypes []*GameTypeDescriptor
+)
+
+// Adds the game type to the registry. Panics if the descriptor is invalid
+// or its game type was already registered.
+func registerGameType(d *GameTypeDescriptor) {
+	if d.Type == "" || d.NewEngine == nil {
+		panic("invalid game type descriptor")
+	}
+	if d.MinPlayers < 1 || d.MinPlayers > d.MaxPlayers || d.MaxPlayers > maxPlayers ||
+		d.DefaultPlayers < d.MinPlayers || d.DefaultPlayers > d.MaxPlayers {
+		panic(fmt.Sprintf("invalid player counts for game type %s", d.Type))
+	}
+	if _, ok := gameTypesByType[d.Type]; ok {
+		panic(fmt.Sprintf("game type %s registered twice", d.Type))
+	}
+	gameTypesByType[d.Type] = d
+	allGameTypes = append(allGameTypes, d)
+}
+
+// Returns the descriptor of game type t, or nil if there is no such game type.
+func lookupGameType(t GameType) *GameTypeDescriptor {
+	return gameTypesByType[t]
+}
+
+// Returns the descriptors of all registered game types.
+func GameTypes() []*GameTypeDescriptor {
+	result := make([]*GameTypeDescriptor, len(allGameTypes))
+	copy(result, allGameTypes)
+	return result
+}
+
+func validGameType(gameType string) bool {
+	return lookupGameType(GameType(gameType)) != nil
+}
+
+func supportsSinglePlayer(t GameType) bool {
+	d := lookupGameType(t)
+	return d != nil && d.SinglePlayer
+}
+
+// Returns the range of player counts a game of type t can be played with.
+func playerCountRange(t GameType) (lo, hi int) {
+	d := lookupGameType(t)
+	if d == nil {
+		return 2, 2
+	}
+	return d.MinPlayers, d.MaxPlayers
+}
+
+// Option to choose the CPU player's strength, used by all game types that support single player mode.
+func difficultyOption() GameOption {
+	o := GameOption{
+		Name:             "difficulty",
+		Label:            "Difficulty",
+		Default:          defaultDifficulty,
+		SinglePlayerOnly: true,
+	}
+	for _, l := range difficultyLevels {
+		o.Choices = append(o.Choices, GameOptionChoice{Value: l.Name, Label: l.Name})
+	}
+	return o
+}
+
+// Returns the data needed to show the form to create a new game of type d.
+// Adds the level option if d supports levels and the server has any.
+func (s *Server) gameTypeInfo(d *GameTypeDescriptor) GameTypeInfo {
+	info := d.GameTypeInfo
+	info.Options = append([]GameOption(nil), d.Options...)
+	if d.Levels && len(s.levels) > 0 {
+		o := GameOption{
+			Name:    "level",
+			Label:   "Level",
+			Choices: []GameOptionChoice{{Value: "", Label: "Random"}},
+		}
+		for _, l := range s.levels {
+			o.Choices = append(o.Choices, GameOptionChoice{Value: l.Name, Label: l.Name})
+		}
+		info.Options = append(info.Options, o)
+	}
+	return info
+}
+
+// Lists all game types and their options, in the form expected by the new game page.
+func (s *Server) handleGameTypes(w http.ResponseWriter, r *http.Request) {
+	var resp GameTypeListResponse
+	for _, d := range allGameTypes {
+		resp.GameTypes = append(resp.GameTypes, s.gameTypeInfo(d))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Serialization error", http.StatusInternalServerError)
+		panic(fmt.Sprintf("Cannot serialize my own structs?! %s", err))
+	}
+}
@@ -0,0 +1,77 @@
+package hexz
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisteredGameTypes(t *testing.T) {
+	want := map[GameType]bool{gameTypeClassic: true, gameTypeFlagz: true, gameTypeFreeform: true, gameTypeConnect: true}
+	types := GameTypes()
+	if len(types) != len(want) {
+		t.Errorf("Want %d game types, got %d", len(want), len(types))
+	}
+	for _, d := range types {
+		if !want[d.Type] {
+			t.Errorf("Unexpected game type %s", d.Type)
+		}
+		for n := d.MinPlayers; n <= d.MaxPlayers; n++ {
+			ge := NewGameEngine(d.Type, n, rand.NewSource(1))
+			if ge.GameType() != d.Type || ge.NumPlayers() != n {
+				t.Errorf("%s: want %d player engine, got %s with %d players", d.Type, n, ge.GameType(), ge.NumPlayers())
+			}
+			if _, ok := ge.(SinglePlayerGameEngine); d.SinglePlayer && !ok {
+				t.Errorf("%s: engine does not support single player mode", d.Type)
+			}
+		}
+		if ge := NewGameEngine(d.Type, 0, rand.NewSource(1)); ge.NumPlayers() != d.DefaultPlayers {
+			t.Errorf("%s: want %d players by default, got %d", d.Type, d.DefaultPlayers, ge.NumPlayers())
+		}
+	}
+	if validGameType("Chess") {
+		t.Error("Chess is not a valid game type")
+	}
+}
+
+func TestRegisterGameTypeTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Want panic when registering a game type twice")
+		}
+	}()
+	registerGameType(lookupGameType(gameTypeClassic))
+}
+
+func TestHandleGameTypes(t *testing.T) {
+	s := NewServer(&ServerConfig{})
+	s.levels = []*Level{{Name: "islands"}}
+	w := httptest.NewRecorder()
+	s.handleGameTypes(w, httptest.NewRequest(http.MethodGet, "/hexz/gametypes", nil))
+	var resp GameTypeListResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	options := make(map[GameType]map[string]GameOption)
+	for _, info := range resp.GameTypes {
+		options[info.Type] = make(map[string]GameOption)
+		for _, o := range info.Options {
+			options[info.Type][o.Name] = o
+		}
+	}
+	if len(options) != len(GameTypes()) {
+		t.Errorf("Want all %d game types, got %d", len(GameTypes()), len(options))
+	}
+	level, ok := options[gameTypeFlagz]["level"]
+	if !ok || len(level.Choices) != 2 || level.Choices[1].Value != "islands" {
+		t.Errorf("Want Flagz level option with the server's levels, got %+v", level)
+	}
+	if _, ok := options[gameTypeConnect]["level"]; ok {
+		t.Error("Connect does not support levels")
+	}
+	if d, ok := options[gameTypeConnect]["difficulty"]; !ok || !d.SinglePlayerOnly || d.Default != defaultDifficulty {
+		t.Errorf("Want difficulty option for Connect, got %+v", d)
+	}
+}
@@ -0,0 +1,438 @@
+package hexz
+
+// Server-side rendering of boards to SVG and PNG images.
+//
+// Both formats are drawn from the same layout, which mirrors how game.html
+// draws the board. SVG images use the same cell icons as the browser.
+// PNG images are drawn with the standard image packages only, so they use
+// simplified icons and a small bitmap font for numbers.
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultBoardImageWidth = 600
+	minBoardImageWidth     = 100
+	maxBoardImageWidth     = 2000
+
+	renderBackgroundColor = "#1e1e1e"
+	renderGridColor       = "#cbcbcb"
+	renderDeadCellColor   = "#d03d12"
+	renderGrassCellColor  = "#008048"
+	renderGrassFgColor    = "#00331d"
+	renderRockCellColor   = "#5f5f5f"
+	renderBlockedAllColor = "#5f5f5f"
+	renderBlockedColor    = "#3e3e3e"
+)
+
+var (
+	// Icons of cell types, as SVG paths centered at 0 and about 100 units wide.
+	// Keep in sync with cellTypePaths in game.html.
+	cellTypeSvgPaths = map[CellType]string{
+		cellFire:  "M -0.8562 -49.9998 L 3.7186 -44.2813 C 9.1362 -37.509 11.1328 -30.8269 10.9476 -24.416 C 10.7676 -18.1826 8.5309 -12.6255 6.2976 -8.0391 C 5.5471 -6.4981 4.7362 -4.95 3.9933 -3.5319 C 3.649 -2.8743 3.319 -2.2448 3.0167 -1.6567 C 2.0067 0.3076 1.2348 1.9333 0.7443 3.3595 C 0.2514 4.7914 0.16 5.6971 0.2229 6.2695 C 0.27 6.7014 0.4152 7.1362 0.9862 7.7071 C 1.9305 8.6514 2.6271 8.9167 3.0495 8.9976 C 3.4809 9.0809 4.0548 9.0538 4.8757 8.7167 C 6.7119 7.9614 8.9538 5.9952 11.3062 3.0457 C 13.5657 0.2124 15.5386 -3.0286 16.9686 -5.6219 C 17.6762 -6.9057 18.2357 -8.0025 18.6147 -8.7717 C 18.8038 -9.1558 18.9476 -9.4567 19.0419 -9.6566 L 19.1452 -9.8781 L 19.1676 -9.9277 L 19.1709 -9.9341 L 19.1714 -9.9357 L 19.1719 -9.9364 L 19.1719 -9.9366 L 21.9605 -16.1081 L 26.8247 -11.3921 C 37.8381 -0.7143 41.2461 14.7043 34.0071 28.7024 C 27.7119 40.8757 14.8205 49.1695 0 49.1695 C -20.9286 49.1695 -38.0952 32.5847 -38.0952 11.8824 C -38.0952 0.9757 -32.0625 -6.8286 -25.4918 -14.5012 C -24.6346 -15.5022 -23.7585 -16.5109 -22.8687 -17.5355 C -16.7675 -24.5605 -10.0167 -32.3334 -4.2276 -43.4985 L -0.8562 -49.9998 Z M 24.4138 0.5619 C 22.9276 3.1319 20.9947 6.1719 18.7519 8.9838 C 16.1195 12.2847 12.6324 15.8243 8.4981 17.5247 C 6.3333 18.4147 3.8614 18.8528 1.2495 18.35 C -1.3719 17.8452 -3.7162 16.4733 -5.7481 14.4414 C -7.8014 12.3881 -8.9543 9.9619 -9.2448 7.3038 C -9.52 4.7857 -8.9876 2.371 -8.2614 0.26 C -7.5328 -1.8562 -6.4895 -3.9957 -5.4529 -6.0114 C -5.0824 -6.7324 -4.7167 -7.4305 -4.3543 -8.1216 C -3.6486 -9.4677 -2.9562 -10.7892 -2.2652 -12.2084 C -0.21 -16.4289 1.3071 -20.5108 1.4276 -24.691 C 1.4924 -26.933 1.1581 -29.3329 0.13 -31.9123 C -5.1862 -23.3496 -10.8945 -16.7869 -15.7256 -11.2326 C -16.6011 -10.226 -17.4478 -9.2526 -18.2581 -8.3064 C -24.8819 -0.5719 -28.5714 4.8252 -28.5714 11.8824 C -28.5714 27.1062 -15.8904 39.6457 0 39.6457 C 11.2109 39.6457 20.8657 33.3819 25.5476 24.3276 C 29.6509 16.3928 29.0709 7.8014 24.4138 0.5619 Z",
+		cellFlag:  "M 3.3072 -38.5457 C -5.0739 -45.2506 -14.9125 -45.0416 -21.9362 -43.5629 C -26.2188 -42.6613 -30.5708 -41.1876 -34.3913 -39.0083 C -36.0409 -38.0657 -37.0588 -36.3116 -37.0588 -34.4117 V 39.7059 C -37.0588 42.6298 -34.6885 45 -31.7647 45 C -28.8409 45 -26.4706 42.6298 -26.4706 39.7059 V 11.2733 C -19.185 8.2022 -9.9318 6.7759 -3.3072 12.0754 C 5.0739 18.7798 14.9125 18.5712 21.9362 17.0926 C 27.2959 15.9639 31.4688 14.0405 33.3286 13.1014 C 35.4012 12.0552 37.0588 10.4474 37.0588 7.9412 V -34.4117 C 37.0588 -36.299 36.054 -38.0434 34.4218 -38.9907 C 32.7907 -39.9373 30.7821 -39.9461 29.1441 -39.0116 L 29.1393 -39.0091 C 21.5264 -34.8494 10.5951 -32.7153 3.3072 -38.5457 Z M -26.4706 -31.0797 V -0.0053 C -16.5104 -3.1934 -5.1829 -2.9848 3.3072 3.807 C 8.1614 7.6908 14.2052 7.8999 19.755 6.7315 C 22.4132 6.1714 24.7601 5.3301 26.4706 4.6091 V -26.465 C 25.0888 -26.0227 23.5646 -25.6034 21.9362 -25.2606 C 14.9125 -23.7819 5.0739 -23.5729 -3.3072 -30.2777 C -9.9318 -35.5772 -19.185 -34.1507 -26.4706 -31.0797 Z",
+		cellPest:  "M -4.5455 -43.1818 C -4.5455 -39.4162 -7.5982 -36.3636 -11.3636 -36.3636 C -15.1292 -36.3636 -18.1818 -39.4162 -18.1818 -43.1818 C -18.1818 -46.9474 -15.1292 -50 -11.3636 -50 C -7.5982 -50 -4.5455 -46.9474 -4.5455 -43.1818 Z M -2.2727 -18.1818 C -2.2727 -15.0438 -4.8164 -12.5 -7.9545 -12.5 C -11.0927 -12.5 -13.6364 -15.0438 -13.6364 -18.1818 C -13.6364 -21.3198 -11.0927 -23.8636 -7.9545 -23.8636 C -4.8164 -23.8636 -2.2727 -21.3198 -2.2727 -18.1818 Z M 4.5455 -26.1364 C 7.6836 -26.1364 10.2273 -28.6802 10.2273 -31.8182 C 10.2273 -34.9562 7.6836 -37.5 4.5455 -37.5 C 1.4073 -37.5 -1.1364 -34.9562 -1.1364 -31.8182 C -1.1364 -28.6802 1.4073 -26.1364 4.5455 -26.1364 Z M 5.6818 18.1818 C 5.6818 21.32 3.1382 23.8636 0 23.8636 C -3.1382 23.8636 -5.6818 21.32 -5.6818 18.1818 C -5.6818 15.0436 -3.1382 12.5 0 12.5 C 3.1382 12.5 5.6818 15.0436 5.6818 18.1818 Z M -27.2727 -36.3636 C -29.7831 -36.3636 -31.8182 -34.3285 -31.8182 -31.8182 C -31.8182 -29.3078 -29.7831 -27.2727 -27.2727 -27.2727 V 22.7273 C -27.2727 28.5323 -25.5955 35.2159 -21.6166 40.5682 C -17.5166 46.0836 -11.0809 50 -2.2727 50 C 6.5355 50 12.9714 46.0836 17.0714 40.5682 C 21.05 35.2159 22.7273 28.5323 22.7273 22.7273 V -27.2727 C 25.2377 -27.2727 27.2727 -29.3078 27.2727 -31.8182 C 27.2727 -34.3285 25.2377 -36.3636 22.7273 -36.3636 H 18.1818 C 15.6714 -36.3636 13.6364 -34.3268 13.6364 -31.8165 V -2.295 C 11.6114 -1.0009 9.2532 0 6.8182 0 C 4.6114 0 2.3659 -0.8223 -0.9341 -2.0814 C -3.7286 -3.1482 -7.3914 -4.5455 -11.3636 -4.5455 C -13.8893 -4.5455 -16.2083 -3.9977 -18.1818 -3.27 L -18.1818 -31.8182 C -18.1818 -34.294 -20.2515 -36.3636 -22.7273 -36.3636 H -27.2727 Z M 6.8182 9.0909 C 9.3441 9.0909 11.6627 8.5432 13.6364 7.8155 V 22.7273 C 13.6364 26.9636 12.3782 31.6436 9.7755 35.1445 C 7.2941 38.4827 3.5023 40.9091 -2.2727 40.9091 C -8.0477 40.9091 -11.8395 38.4827 -14.3209 35.1445 C -16.9234 31.6436 -18.1818 26.9636 -18.1818 22.7273 L -18.1818 6.8405 C -16.1567 5.5464 -13.7985 4.5455 -11.3636 4.5455 C -9.1568 4.5455 -6.9114 5.3677 -3.6114 6.6268 C -0.8168 7.6936 2.8459 9.0909 6.8182 9.0909 Z",
+		cellDeath: "M 33.3333 45.2381 C 33.3333 47.8681 31.2014 50 28.5714 50 H 9.5238 H -9.5238 H -28.5714 C -31.2014 50 -33.3333 47.8681 -33.3333 45.2381 V 34.5238 C -33.3333 29.9214 -37.0643 26.1905 -41.6667 26.1905 C -44.9541 26.1905 -47.619 23.5257 -47.619 20.2381 V -2.381 C -47.619 -28.6802 -26.2993 -50 0 -50 C 26.299 -50 47.619 -28.6802 47.619 -2.381 V 20.2381 C 47.619 23.5257 44.9543 26.1905 41.6667 26.1905 C 37.0643 26.1905 33.3333 29.9214 33.3333 34.5238 V 45.2381 Z M 23.8095 40.4762 V 34.5238 C 23.8095 25.8848 29.9443 18.6786 38.0952 17.0238 V -2.381 C 38.0952 -23.4204 21.0395 -40.4762 0 -40.4762 C -21.0394 -40.4762 -38.0952 -23.4204 -38.0952 -2.381 V 17.0238 C -29.9444 18.6786 -23.8095 25.8848 -23.8095 34.5238 V 40.4762 H -14.2857 V 30.9524 C -14.2857 28.3224 -12.1538 26.1905 -9.5238 26.1905 C -6.8938 26.1905 -4.7619 28.3224 -4.7619 30.9524 V 40.4762 H 4.7619 V 30.9524 C 4.7619 28.3224 6.8938 26.1905 9.5238 26.1905 C 12.1538 26.1905 14.2857 28.3224 14.2857 30.9524 V 40.4762 H 23.8095 Z M -4.7619 4.7619 C -4.7619 11.3367 -16.0368 16.6667 -22.6072 16.6667 C -28.6443 16.6667 -28.6092 12.1667 -28.5638 6.3362 V 6.3357 C -28.5598 5.821 -28.5557 5.2957 -28.5557 4.7619 C -28.5557 -1.8129 -23.2292 -7.1429 -16.6588 -7.1429 C -10.0883 -7.1429 -4.7619 -1.8129 -4.7619 4.7619 Z M 28.5638 6.3362 C 28.5595 5.821 28.5557 5.2957 28.5557 4.7619 C 28.5557 -1.8129 23.229 -7.1429 16.6586 -7.1429 C 10.0881 -7.1429 4.7619 -1.8129 4.7619 4.7619 C 4.7619 11.3367 16.0367 16.6667 22.6071 16.6667 C 28.6443 16.6667 28.609 12.1667 28.5638 6.3362 Z",
+	}
+)
+
+// A cell of a board layout, ready to be drawn.
+type renderCell struct {
+	x, y      float64  // Center of the cell.
+	fill      string   // Fill color. Empty if the cell is not filled.
+	icon      CellType // Type of the icon drawn on top. cellNormal if none.
+	iconColor string
+	text      string // Text drawn on top, e.g. the cell's value.
+	textColor string
+}
+
+// A text of the score line.
+type renderText struct {
+	text  string
+	color string
+}
+
+// Positions and colors of everything drawn for a board.
+type boardLayout struct {
+	width, height float64
+	a             float64 // Side length of the hexagons.
+	cells         []renderCell
+	score         []renderText
+	scoreY        float64 // Baseline of the score line.
+}
+
+// Computes the layout of the board for an image of the given width.
+func layoutBoard(b *BoardView, width int) *boardLayout {
+	maxCols := 0
+	for _, row := range b.Fields {
+		if len(row) > maxCols {
+			maxCols = len(row)
+		}
+	}
+	w := float64(width)
+	// Rows with an odd index are shifted by half a cell.
+	a := w / ((float64(maxCols) + 0.5) * math.Sqrt(3))
+	hb := math.Sqrt(3) * a
+	l := &boardLayout{
+		width: w,
+		a:     a,
+	}
+	boardHeight := float64(len(b.Fields))*a*3/2 + a/2
+	l.scoreY = boardHeight + 1.5*a
+	l.height = l.scoreY + a
+	for r, row := range b.Fields {
+		xOff := 0.0
+		if r%2 == 1 {
+			xOff = hb / 2
+		}
+		for c := range row {
+			f := &row[c]
+			cell := renderCell{
+				x: xOff + float64(c)*hb + hb/2,
+				y: float64(r)*a*3/2 + a,
+			}
+			switch {
+			case f.Owner > 0 && f.Owner <= len(b.PlayerColors):
+				pc := b.PlayerColors[f.Owner-1]
+				cell.fill = pc.Cell
+				if f.Hidden {
+					cell.fill = pc.Hidden
+				}
+				if f.Type != cellNormal {
+					cell.icon = f.Type
+					cell.iconColor = pc.Icon
+				}
+				if f.Value > 0 {
+					cell.text = strconv.Itoa(f.Value)
+					cell.textColor = pc.Icon
+				}
+			case f.Type == cellDead:
+				cell.fill = renderDeadCellColor
+			case f.Type == cellRock:
+				cell.fill = renderRockCellColor
+			case f.Type == cellGrass:
+				cell.fill = renderGrassCellColor
+				if f.Value > 0 {
+					cell.text = strconv.Itoa(f.Value)
+					cell.textColor = renderGrassFgColor
+				}
+			default:
+				cell.fill = blockedCellColor(f, b.PlayerColors)
+			}
+			l.cells = append(l.cells, cell)
+		}
+	}
+	for i, s := range b.Score {
+		if i > 0 {
+			l.score = append(l.score, renderText{text: "-", color: renderGridColor})
+		}
+		color := renderGridColor
+		if i < len(b.PlayerColors) {
+			color = b.PlayerColors[i].Cell
+		}
+		l.score = append(l.score, renderText{text: strconv.Itoa(s), color: color})
+	}
+	return l
+}
+
+// Returns the color of a free cell that is blocked for some players, or "" if
+// it is not blocked for anyone. Mirrors blockedColor in game.html.
+func blockedCellColor(f *Field, colors []PlayerColors) string {
+	numBlocked := 0
+	open := -1
+	for i := range colors {
+		if f.Blocked[i] {
+			numBlocked++
+		} else {
+			open = i
+		}
+	}
+	switch {
+	case numBlocked == 0:
+		return ""
+	case numBlocked == len(colors):
+		return renderBlockedAllColor
+	case numBlocked == len(colors)-1:
+		return colors[open].Hidden
+	}
+	return renderBlockedColor
+}
+
+// Returns the corners of the hexagon with side length a centered at (x, y).
+func hexagonCorners(x, y, a float64) [6][2]float64 {
+	b2 := math.Sqrt(3) * a / 2
+	return [6][2]float64{
+		{x + b2, y + a/2}, {x, y + a}, {x - b2, y + a/2},
+		{x - b2, y - a/2}, {x, y - a}, {x + b2, y - a/2},
+	}
+}
+
+// Writes the board as an SVG image of the given width.
+func RenderBoardSVG(w io.Writer, b *BoardView, width int) error {
+	l := layoutBoard(b, width)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.2f %.2f">`+"\n",
+		l.width, l.height, l.width, l.height)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", renderBackgroundColor)
+	fontSize := math.Floor(l.a)
+	iconScale := math.Sqrt(3) * l.a / 50 / 3.5
+	for _, c := range l.cells {
+		var pts []string
+		for _, p := range hexagonCorners(c.x, c.y, l.a) {
+			pts = append(pts, fmt.Sprintf("%.2f,%.2f", p[0], p[1]))
+		}
+		fill := c.fill
+		if fill == "" {
+			fill = "none"
+		}
+		fmt.Fprintf(bw, `<polygon points="%s" fill="%s" stroke="%s"/>`+"\n", strings.Join(pts, " "), fill, renderGridColor)
+		if d, ok := cellTypeSvgPaths[c.icon]; ok {
+			fmt.Fprintf(bw, `<path d="%s" fill="%s" fill-rule="evenodd" transform="translate(%.2f %.2f) scale(%.4f)"/>`+"\n",
+				d, c.iconColor, c.x, c.y, iconScale)
+		}
+		if c.text != "" {
+			fmt.Fprintf(bw, `<text x="%.2f" y="%.2f" fill="%s" font-family="sans-serif" font-size="%.0f" text-anchor="middle" dominant-baseline="central">%s</text>`+"\n",
+				c.x, c.y, c.textColor, fontSize, html.EscapeString(c.text))
+		}
+	}
+	if len(l.score) > 0 {
+		fmt.Fprintf(bw, `<text x="%.2f" y="%.2f" font-family="sans-serif" font-size="%.0f" text-anchor="middle">`,
+			l.width/2, l.scoreY, fontSize)
+		for i, t := range l.score {
+			if i > 0 {
+				bw.WriteString(" ")
+			}
+			fmt.Fprintf(bw, `<tspan fill="%s">%s</tspan>`, t.color, html.EscapeString(t.text))
+		}
+		bw.WriteString("</text>\n")
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// Parses a color of the form #rrggbb.
+func parseHexColor(s string) color.RGBA {
+	var c color.RGBA
+	c.A = 0xff
+	if len(s) == 7 && s[0] == '#' {
+		if v, err := strconv.ParseUint(s[1:], 16, 32); err == nil {
+			c.R, c.G, c.B = uint8(v>>16), uint8(v>>8), uint8(v)
+		}
+	}
+	return c
+}
+
+// Fills the polygon with the given corners, using the even-odd rule.
+func fillPolygon(img *image.RGBA, pts [][2]float64, c color.Color) {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range pts {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	for y := int(math.Floor(minY)); y <= int(math.Ceil(maxY)); y++ {
+		for x := int(math.Floor(minX)); x <= int(math.Ceil(maxX)); x++ {
+			// Test the pixel's center.
+			px, py := float64(x)+0.5, float64(y)+0.5
+			inside := false
+			for i, j := 0, len(pts)-1; i < len(pts); j, i = i, i+1 {
+				xi, yi, xj, yj := pts[i][0], pts[i][1], pts[j][0], pts[j][1]
+				if (yi > py) != (yj > py) && px < (xj-xi)*(py-yi)/(yj-yi)+xi {
+					inside = !inside
+				}
+			}
+			if inside {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// Draws a one pixel wide line from (x0, y0) to (x1, y1).
+func drawLine(img *image.RGBA, x0, y0, x1, y1 float64, c color.Color) {
+	n := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))
+	for i := 0; i <= n; i++ {
+		t := 0.0
+		if n > 0 {
+			t = float64(i) / float64(n)
+		}
+		img.Set(int(x0+t*(x1-x0)), int(y0+t*(y1-y0)), c)
+	}
+}
+
+// 3x5 bitmap font for the characters used in cell values and scores.
+var bitmapGlyphs = map[rune][5]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'-': {"...", "...", "###", "...", "..."},
+}
+
+// Returns the width of text drawn with the bitmap font at the given pixel size.
+func bitmapTextWidth(text string, px float64) float64 {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return (float64(n)*4 - 1) * px
+}
+
+// Draws text with the bitmap font, centered at (x, y). px is the size of a font pixel.
+func drawBitmapText(img *image.RGBA, text string, x, y, px float64, c color.Color) {
+	x0 := x - bitmapTextWidth(text, px)/2
+	y0 := y - 2.5*px
+	for i, r := range []rune(text) {
+		glyph, ok := bitmapGlyphs[r]
+		if !ok {
+			continue
+		}
+		for gy, line := range glyph {
+			for gx, on := range line {
+				if on != '#' {
+					continue
+				}
+				left := x0 + float64(i*4+gx)*px
+				top := y0 + float64(gy)*px
+				fillPolygon(img, [][2]float64{{left, top}, {left + px, top}, {left + px, top + px}, {left, top + px}}, c)
+			}
+		}
+	}
+}
+
+// Draws a simplified icon of the cell type centered at (x, y), fitting into a circle of radius r.
+func drawIcon(img *image.RGBA, t CellType, x, y, r float64, c color.Color) {
+	if t == cellFlag {
+		pole := [][2]float64{{x - 0.7*r, y - r}, {x - 0.5*r, y - r}, {x - 0.5*r, y + r}, {x - 0.7*r, y + r}}
+		flag := [][2]float64{{x - 0.5*r, y - r}, {x + 0.8*r, y - 0.55*r}, {x - 0.5*r, y - 0.1*r}}
+		fillPolygon(img, pole, c)
+		fillPolygon(img, flag, c)
+		return
+	}
+	// All other icons are drawn as a diamond.
+	fillPolygon(img, [][2]float64{{x, y - r}, {x + r, y}, {x, y + r}, {x - r, y}}, c)
+}
+
+// Draws the board into a new image of the given width.
+func RenderBoardImage(b *BoardView, width int) *image.RGBA {
+	l := layoutBoard(b, width)
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(l.width)), int(math.Ceil(l.height))))
+	bg := parseHexColor(renderBackgroundColor)
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = bg.R, bg.G, bg.B, bg.A
+	}
+	grid := parseHexColor(renderGridColor)
+	px := math.Max(1, math.Floor(l.a/8))
+	for _, c := range l.cells {
+		corners := hexagonCorners(c.x, c.y, l.a)
+		if c.fill != "" {
+			fillPolygon(img, corners[:], parseHexColor(c.fill))
+		}
+		if c.icon != cellNormal {
+			drawIcon(img, c.icon, c.x, c.y, l.a*0.55, parseHexColor(c.iconColor))
+		}
+		if c.text != "" {
+			drawBitmapText(img, c.text, c.x, c.y, px, parseHexColor(c.textColor))
+		}
+		for i := range corners {
+			p, q := corners[i], corners[(i+1)%len(corners)]
+			drawLine(img, p[0], p[1], q[0], q[1], grid)
+		}
+	}
+	// Draw the score line centered below the board.
+	var total float64
+	for i, t := range l.score {
+		if i > 0 {
+			total += 4 * px
+		}
+		total += bitmapTextWidth(t.text, px)
+	}
+	x := l.width/2 - total/2
+	for _, t := range l.score {
+		tw := bitmapTextWidth(t.text, px)
+		drawBitmapText(img, t.text, x+tw/2, l.scoreY-2.5*px, px, parseHexColor(t.color))
+		x += tw + 4*px
+	}
+	return img
+}
+
+// Writes the board as a PNG image of the given width.
+func RenderBoardPNG(w io.Writer, b *BoardView, width int) error {
+	return png.Encode(w, RenderBoardImage(b, width))
+}
+
+// Board image file names served for each game.
+const (
+	boardSvgFilename = "board.svg"
+	boardPngFilename = "board.png"
+)
+
+// Returns true if p is the path of a board image of a game, i.e. /hexz/{gameId}/board.svg or .png.
+func isBoardImagePath(p string) bool {
+	segs := strings.Split(p, "/")
+	if len(segs) != 4 || segs[1] != "hexz" {
+		return false
+	}
+	return segs[3] == boardSvgFilename || segs[3] == boardPngFilename
+}
+
+// Serves the spectator view of a game's current board as an SVG or PNG image.
+// Supports the query parameter width (in pixels). Private games need the invite token.
+func (s *Server) handleBoardImage(w http.ResponseWriter, r *http.Request) {
+	gameId := gameIdFromPath(r.URL.Path)
+	game := s.lookupGame(gameId)
+	if game == nil {
+		http.Error(w, fmt.Sprintf("No game with ID %q", gameId), http.StatusNotFound)
+		return
+	}
+	if !game.canAccess(Player{}, r.URL.Query().Get(inviteTokenUrlParam)) {
+		http.Error(w, "Private game", http.StatusForbidden)
+		return
+	}
+	width := defaultBoardImageWidth
+	if v := r.URL.Query().Get("width"); v != "" {
+		var err error
+		width, err = strconv.Atoi(v)
+		if err != nil || width < minBoardImageWidth || width > maxBoardImageWidth {
+			http.Error(w, fmt.Sprintf("width must be between %d and %d", minBoardImageWidth, maxBoardImageWidth), http.StatusBadRequest)
+			return
+		}
+	}
+	snapshot, err := game.inspect(true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	view := snapshot.board.ViewFor(0)
+	w.Header().Set("Cache-Control", "no-store")
+	if path.Base(r.URL.Path) == boardSvgFilename {
+		s.IncCounter("/requests/board/svg")
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = RenderBoardSVG(w, view, width)
+	} else {
+		s.IncCounter("/requests/board/png")
+		w.Header().Set("Content-Type", "image/png")
+		err = RenderBoardPNG(w, view, width)
+	}
+	if err != nil {
+		log.Printf("Cannot render board of game %s: %s", gameId, err)
+	}
+}
@@ -0,0 +1,168 @@
+package hexz
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderBoard(t *testing.T) {
+	ge := NewGameEngineFlagz(rand.NewSource(1))
+	for i := 0; i < 6; i++ {
+		m, err := ge.Clone(rand.NewSource(int64(i))).RandomMove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ge.MakeMove(m) {
+			t.Fatalf("Invalid random move %v", m)
+		}
+	}
+	view := ge.Board().ViewFor(0)
+	var svg bytes.Buffer
+	if err := RenderBoardSVG(&svg, view, 400); err != nil {
+		t.Fatal(err)
+	}
+	// The SVG must be well-formed XML with one polygon per cell.
+	dec := xml.NewDecoder(bytes.NewReader(svg.Bytes()))
+	polygons := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("Invalid SVG: ", err)
+		}
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Local == "polygon" {
+			polygons++
+		}
+	}
+	if want := len(ge.Board().FlatFields); polygons != want {
+		t.Errorf("Want %d polygons, got %d", want, polygons)
+	}
+	var buf bytes.Buffer
+	if err := RenderBoardPNG(&buf, view, 400); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal("Invalid PNG: ", err)
+	}
+	if w := img.Bounds().Dx(); w != 400 {
+		t.Errorf("Want width 400, got %d", w)
+	}
+	// The first cell is drawn in its owner's color (or empty, if unowned).
+	f := view.Fields[0][0]
+	l := layoutBoard(view, 400)
+	c := l.cells[0]
+	// Sample above the center, where no icon or value is drawn.
+	r, g, b, _ := img.At(int(c.x), int(c.y-l.a/2)).RGBA()
+	want := parseHexColor(renderBackgroundColor)
+	if c.fill != "" {
+		want = parseHexColor(c.fill)
+	}
+	if uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+		t.Errorf("Cell %+v has color (%d,%d,%d), want %v", f, r>>8, g>>8, b>>8, want)
+	}
+}
+
+func TestBoardImageEndpoint(t *testing.T) {
+	s := NewServer(&ServerConfig{
+		PlayerRemoveDelay: time.Minute,
+		LoginTtl:          time.Hour,
+		CompThinkTime:     time.Second,
+	})
+	srv := httptest.NewServer(s.createHandler())
+	defer srv.Close()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.PostForm(srv.URL+"/hexz/login", url.Values{"name": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	resp, err = client.PostForm(srv.URL+"/hexz/new", url.Values{"type": {"Flagz"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	gameId := strings.TrimPrefix(resp.Header.Get("Location"), "/hexz/")
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/hexz/" + gameId + "/board.svg", http.StatusOK, "image/svg+xml"},
+		{"/hexz/" + gameId + "/board.png?width=200", http.StatusOK, "image/png"},
+		{"/hexz/" + gameId + "/board.png?width=5", http.StatusBadRequest, ""},
+		{"/hexz/nope/board.svg", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		// Images are public: no cookies needed.
+		resp, err := http.Get(srv.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: want status %d, got %d", test.path, test.status, resp.StatusCode)
+		}
+		if test.contentType != "" && resp.Header.Get("Content-Type") != test.contentType {
+			t.Errorf("%s: want content type %s, got %s", test.path, test.contentType, resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestReplayGame(t *testing.T) {
+	seeds := GameSeeds{Engine: 7}
+	ge := NewGameEngineFlagz(rand.NewSource(seeds.Engine))
+	events := []*GameEvent{
+		{GameId: "other", Type: gameEventCreated, GameType: gameTypeFlagz, Seeds: &GameSeeds{Engine: 8}},
+		{GameId: "g", Type: gameEventCreated, GameType: gameTypeFlagz, NumPlayers: 2, Seeds: &seeds},
+	}
+	for i := 0; i < 10; i++ {
+		m, err := ge.Clone(rand.NewSource(int64(i))).RandomMove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ge.MakeMove(m) {
+			t.Fatalf("Invalid random move %v", m)
+		}
+		events = append(events, &GameEvent{
+			GameId:    "g",
+			Type:      gameEventMove,
+			PlayerNum: m.playerNum,
+			Move:      &GameEventMove{Move: m.move, Row: m.row, Col: m.col, CellType: m.cellType},
+		})
+	}
+	boards, err := ReplayGame(events, "g", nil)
+	if err != nil {
+		t.Fatal("Cannot replay game: ", err)
+	}
+	if len(boards) != 11 {
+		t.Fatalf("Want 11 boards, got %d", len(boards))
+	}
+	last := boards[len(boards)-1]
+	for i, f := range ge.Board().FlatFields {
+		if last.FlatFields[i].Owner != f.Owner || last.FlatFields[i].Type != f.Type {
+			t.Fatalf("Replayed board differs at field %d: %+v vs. %+v", i, last.FlatFields[i], f)
+		}
+	}
+	if _, err := ReplayGame(events, "missing", nil); err == nil {
+		t.Error("Want error for missing game")
+	}
+}
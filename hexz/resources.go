@@ -0,0 +1,164 @@
+package hexz
+
+// Static resources (HTML pages and images) served by the server.
+//
+// Resources are embedded in the binary. During development, files in
+// ServerConfig.DocumentRoot take precedence over the embedded ones, so pages
+// can be edited without rebuilding the server.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	// Cache-Control header of images, which rarely change.
+	imageCacheControl = "public, max-age=2592000" // 30 days
+	// Cache-Control header of all other resources. Clients revalidate them using the ETag.
+	defaultCacheControl = "no-cache"
+	// Resources smaller than this are never compressed.
+	minGzipSize = 1024
+)
+
+//go:embed resources
+var embeddedResources embed.FS
+
+// A resource ready to be served.
+type resource struct {
+	contents    []byte
+	gzipped     []byte // Gzip-compressed contents. nil if compression is not worthwhile.
+	etag        string // Quoted content hash.
+	contentType string
+}
+
+// Prepares contents for serving as a resource named filename.
+func newResource(filename string, contents []byte) *resource {
+	h := sha256.Sum256(contents)
+	r := &resource{
+		contents:    contents,
+		etag:        `"` + hex.EncodeToString(h[:8]) + `"`,
+		contentType: validResourceFileExts[path.Ext(filename)],
+	}
+	if strings.HasPrefix(r.contentType, "text/") && len(contents) >= minGzipSize {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(contents)
+		zw.Close()
+		if buf.Len() < len(contents) {
+			r.gzipped = buf.Bytes()
+		}
+	}
+	return r
+}
+
+func (r *resource) cacheControl() string {
+	if strings.HasPrefix(r.contentType, "image/") {
+		return imageCacheControl
+	}
+	return defaultCacheControl
+}
+
+// Caches embedded resources, which never change, in their ready-to-serve form.
+type resourceCache struct {
+	resources map[string]*resource
+	mut       sync.Mutex
+}
+
+func newResourceCache() *resourceCache {
+	return &resourceCache{resources: make(map[string]*resource)}
+}
+
+func (c *resourceCache) lookup(filename string) (*resource, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if r, ok := c.resources[filename]; ok {
+		return r, nil
+	}
+	contents, err := embeddedResources.ReadFile(path.Join("resources", filename))
+	if err != nil {
+		return nil, err
+	}
+	r := newResource(filename, contents)
+	c.resources[filename] = r
+	return r, nil
+}
+
+// Returns the resource with the given name, relative to the resources directory.
+// Files in the document root, if one is configured, override embedded resources.
+func (s *Server) resource(filename string) (*resource, error) {
+	filename = path.Clean(filename)
+	if _, ok := validResourceFileExts[path.Ext(filename)]; !ok || !fs.ValidPath(filename) {
+		return nil, fs.ErrNotExist
+	}
+	if s.config.DocumentRoot != "" {
+		s.IncCounter("/storage/files/readfile")
+		contents, err := os.ReadFile(path.Join(s.config.DocumentRoot, filename))
+		if err == nil {
+			return newResource(filename, contents), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return s.resources.lookup(filename)
+}
+
+// Returns true if the If-None-Match header of the request matches etag.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes the resource with the given name to w. Honors If-None-Match and compresses
+// the response if the client accepts gzip. Callers may set additional headers,
+// such as cookies, before calling serveResource.
+func (s *Server) serveResource(w http.ResponseWriter, r *http.Request, filename string) {
+	res, err := s.resource(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	} else if err != nil {
+		s.IncCounter("/resources/errors")
+		http.Error(w, "Cannot read resource", http.StatusInternalServerError)
+		return
+	}
+	contents := res.contents
+	etag := res.etag
+	useGzip := res.gzipped != nil && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	if useGzip {
+		contents = res.gzipped
+		// Different representations need different ETags.
+		etag = strings.TrimSuffix(etag, `"`) + `-gz"`
+	}
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", res.cacheControl())
+	if res.gzipped != nil {
+		h.Set("Vary", "Accept-Encoding")
+	}
+	if etagMatches(r, etag) {
+		s.IncCounter("/resources/not_modified")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", res.contentType)
+	if useGzip {
+		h.Set("Content-Encoding", "gzip")
+	}
+	w.Write(contents)
+}
@@ -0,0 +1,76 @@
+package hexz
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestServeEmbeddedResource(t *testing.T) {
+	s := NewServer(&ServerConfig{})
+	get := func(filename string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/hexz/"+filename, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.serveResource(w, r, filename)
+		return w
+	}
+	w := get(gameHtmlFilename, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<canvas") {
+		t.Fatalf("Cannot get embedded game page: %d", w.Code)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") != defaultCacheControl {
+		t.Errorf("Missing caching headers: %v", w.Header())
+	}
+	if w := get(gameHtmlFilename, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Want 304 Not Modified for matching ETag, got %d", w.Code)
+	}
+	// Gzip-compressed responses.
+	w = get(gameHtmlFilename, map[string]string{"Accept-Encoding": "gzip, deflate"})
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("ETag") == etag {
+		t.Fatalf("Want gzip response with its own ETag, got %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := io.ReadAll(zr)
+	if err != nil || !strings.Contains(string(html), "<canvas") {
+		t.Errorf("Cannot decompress game page: %v", err)
+	}
+	// Images are cached for long.
+	w = get("images/flag_icon.png", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != imageCacheControl || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Unexpected image response: %d %v", w.Code, w.Header())
+	}
+	for _, filename := range []string{"missing.html", "../server.go", "images/../../go.mod"} {
+		if w := get(filename, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s: want 404, got %d", filename, w.Code)
+		}
+	}
+}
+
+func TestResourceOverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, rulesHtmlFilename), []byte("<p>Local rules</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(&ServerConfig{DocumentRoot: dir})
+	res, err := s.resource(rulesHtmlFilename)
+	if err != nil || string(res.contents) != "<p>Local rules</p>" {
+		t.Errorf("Want overridden rules page, got %v", err)
+	}
+	// Files missing from the override directory are taken from the embedded resources.
+	res, err = s.resource(loginHtmlFilename)
+	if err != nil || len(res.contents) == 0 {
+		t.Errorf("Want embedded login page, got %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package hexz
+
+// Rollout policies used by MCTS to play out games from a newly expanded node.
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+type RolloutPolicy interface {
+	// Returns the next move to play in a rollout of ge.
+	// Implementations must not keep any state, since the same policy
+	// can be used concurrently by several MCTS instances.
+	NextMove(ge SinglePlayerGameEngine, rnd *rand.Rand) (GameEngineMove, error)
+	String() string
+}
+
+// Lets the game engine pick a random move. This is the classic MCTS rollout.
+type UniformRolloutPolicy struct{}
+
+func (UniformRolloutPolicy) NextMove(ge SinglePlayerGameEngine, rnd *rand.Rand) (GameEngineMove, error) {
+	return ge.RandomMove()
+}
+
+func (UniformRolloutPolicy) String() string { return "uniform" }
+
+// Weights of the heuristic used to score Flagz moves.
+type HeuristicWeights struct {
+	Base  float64 // Added to the score of every normal move.
+	Value float64 // Multiplied by the value the occupied cell would get.
+	Grass float64 // Multiplied by the total value of grass cells the move would capture.
+	Flag  float64 // Score of placing a flag (on any free cell) instead of a normal move.
+}
+
+var defaultHeuristicWeights = HeuristicWeights{Base: 1, Value: 1, Grass: 2, Flag: 1}
+
+// Returns the total value of grass cells that get captured directly
+// if the current player occupies (r, c) with a cell of value val.
+func (g *GameEngineFlagz) grassCaptured(r, c, val int) int {
+	var ns [6]idx
+	n := g.B.neighbors(idx{r, c}, ns[:])
+	grass := 0
+	for i := 0; i < n; i++ {
+		nb := &g.B.Fields[ns[i].r][ns[i].c]
+		if nb.Type == cellGrass && nb.Value <= val {
+			grass += nb.Value
+		}
+	}
+	return grass
+}
+
+func (w *HeuristicWeights) score(val, grass int) float64 {
+	return w.Base + w.Value*float64(val) + w.Grass*float64(grass)
+}
+
+func flagzMove(b *Board, r, c int, cellType CellType) GameEngineMove {
+	return GameEngineMove{playerNum: b.Turn, move: b.Move, row: r, col: c, cellType: cellType}
+}
+
+// Always plays the normal move with the highest heuristic score. Ties are broken randomly.
+// Flags are only played if no normal move is available.
+type GreedyRolloutPolicy struct {
+	Weights HeuristicWeights
+}
+
+func (p *GreedyRolloutPolicy) NextMove(ge SinglePlayerGameEngine, rnd *rand.Rand) (GameEngineMove, error) {
+	g, ok := ge.(*GameEngineFlagz)
+	if !ok || g.B.State != Running || g.NormalMoves[g.B.Turn-1] == 0 {
+		return ge.RandomMove()
+	}
+	b := g.B
+	bestR, bestC := -1, -1
+	bestScore := 0.0
+	nBest := 0
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			f := &b.Fields[r][c]
+			if f.occupied() || !f.isAvail(b.Turn) {
+				continue
+			}
+			val := f.NextVal[b.Turn-1]
+			s := p.Weights.score(val, g.grassCaptured(r, c, val))
+			if nBest == 0 || s > bestScore {
+				bestR, bestC, bestScore, nBest = r, c, s, 1
+			} else if s == bestScore {
+				// Reservoir sampling among equally good moves.
+				nBest++
+				if rnd.Intn(nBest) == 0 {
+					bestR, bestC = r, c
+				}
+			}
+		}
+	}
+	return flagzMove(b, bestR, bestC, cellNormal), nil
+}
+
+func (p *GreedyRolloutPolicy) String() string { return "greedy" }
+
+// Plays a uniformly random move with probability Epsilon, otherwise the greedy move.
+type EpsilonGreedyRolloutPolicy struct {
+	Epsilon float64
+	Greedy  GreedyRolloutPolicy
+}
+
+func (p *EpsilonGreedyRolloutPolicy) NextMove(ge SinglePlayerGameEngine, rnd *rand.Rand) (GameEngineMove, error) {
+	if rnd.Float64() < p.Epsilon {
+		return ge.RandomMove()
+	}
+	return p.Greedy.NextMove(ge, rnd)
+}
+
+func (p *EpsilonGreedyRolloutPolicy) String() string {
+	return fmt.Sprintf("epsgreedy:%g", p.Epsilon)
+}
+
+// Picks moves randomly with probability proportional to their heuristic score.
+// All flag placements together are weighted with Weights.Flag.
+type WeightedRolloutPolicy struct {
+	Weights HeuristicWeights
+}
+
+func (p *WeightedRolloutPolicy) NextMove(ge SinglePlayerGameEngine, rnd *rand.Rand) (GameEngineMove, error) {
+	g, ok := ge.(*GameEngineFlagz)
+	if !ok || g.B.State != Running {
+		return ge.RandomMove()
+	}
+	b := g.B
+	pIdx := b.Turn - 1
+	flagWeight := 0.0
+	if g.FreeCells > 0 && b.Resources[pIdx].NumPieces[cellFlag] > 0 {
+		flagWeight = p.Weights.Flag
+	}
+	total := flagWeight
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			f := &b.Fields[r][c]
+			if !f.occupied() && f.isAvail(b.Turn) {
+				val := f.NextVal[pIdx]
+				total += p.Weights.score(val, g.grassCaptured(r, c, val))
+			}
+		}
+	}
+	if total <= 0 {
+		return ge.RandomMove()
+	}
+	x := rnd.Float64() * total
+	if x < flagWeight {
+		nthFlag := rnd.Intn(g.FreeCells)
+		n := 0
+		for r := 0; r < len(b.Fields); r++ {
+			for c := 0; c < len(b.Fields[r]); c++ {
+				if !b.Fields[r][c].occupied() {
+					if n == nthFlag {
+						return flagzMove(b, r, c, cellFlag), nil
+					}
+					n++
+				}
+			}
+		}
+	}
+	x -= flagWeight
+	lastR, lastC := -1, -1
+	for r := 0; r < len(b.Fields); r++ {
+		for c := 0; c < len(b.Fields[r]); c++ {
+			f := &b.Fields[r][c]
+			if f.occupied() || !f.isAvail(b.Turn) {
+				continue
+			}
+			val := f.NextVal[pIdx]
+			x -= p.Weights.score(val, g.grassCaptured(r, c, val))
+			lastR, lastC = r, c
+			if x < 0 {
+				return flagzMove(b, r, c, cellNormal), nil
+			}
+		}
+	}
+	if lastR >= 0 {
+		// Rounding errors can leave x slightly above 0.
+		return flagzMove(b, lastR, lastC, cellNormal), nil
+	}
+	return ge.RandomMove()
+}
+
+func (p *WeightedRolloutPolicy) String() string {
+	w := p.Weights
+	return fmt.Sprintf("weighted:base=%g,value=%g,grass=%g,flag=%g", w.Base, w.Value, w.Grass, w.Flag)
+}
+
+// Parses a rollout policy specification. Valid specs are
+//
+//	uniform
+//	greedy
+//	epsgreedy[:<epsilon>]
+//	weighted[:base=<w>,value=<w>,grass=<w>,flag=<w>]
+//
+// Omitted parameters take default values.
+func ParseRolloutPolicy(spec string) (RolloutPolicy, error) {
+	name, params, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch name {
+	case "", "uniform":
+		return UniformRolloutPolicy{}, nil
+	case "greedy":
+		return &GreedyRolloutPolicy{Weights: defaultHeuristicWeights}, nil
+	case "epsgreedy":
+		eps := 0.1
+		if params != "" {
+			var err error
+			eps, err = strconv.ParseFloat(params, 64)
+			if err != nil || eps < 0 || eps > 1 {
+				return nil, fmt.Errorf("epsilon must be in [0..1]: %q", params)
+			}
+		}
+		return &EpsilonGreedyRolloutPolicy{
+			Epsilon: eps,
+			Greedy:  GreedyRolloutPolicy{Weights: defaultHeuristicWeights},
+		}, nil
+	case "weighted":
+		w := defaultHeuristicWeights
+		if params != "" {
+			for _, kv := range strings.Split(params, ",") {
+				k, v, found := strings.Cut(kv, "=")
+				if !found {
+					return nil, fmt.Errorf("invalid weight %q", kv)
+				}
+				x, err := strconv.ParseFloat(v, 64)
+				if err != nil || x < 0 {
+					return nil, fmt.Errorf("weights must be non-negative numbers: %q", kv)
+				}
+				switch k {
+				case "base":
+					w.Base = x
+				case "value":
+					w.Value = x
+				case "grass":
+					w.Grass = x
+				case "flag":
+					w.Flag = x
+				default:
+					return nil, fmt.Errorf("unknown weight %q", k)
+				}
+			}
+		}
+		return &WeightedRolloutPolicy{Weights: w}, nil
+	}
+	return nil, fmt.Errorf("unknown rollout policy %q", name)
+}
@@ -0,0 +1,103 @@
+package hexz
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParseRolloutPolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"", "uniform", false},
+		{"uniform", "uniform", false},
+		{"greedy", "greedy", false},
+		{"epsgreedy", "epsgreedy:0.1", false},
+		{"epsgreedy:0.25", "epsgreedy:0.25", false},
+		{"weighted", "weighted:base=1,value=1,grass=2,flag=1", false},
+		{"weighted:flag=0.5,grass=3", "weighted:base=1,value=1,grass=3,flag=0.5", false},
+		{"epsgreedy:1.5", "", true},
+		{"weighted:foo=1", "", true},
+		{"weighted:flag=-1", "", true},
+		{"smart", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			p, err := ParseRolloutPolicy(test.spec)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %s", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if p.String() != test.want {
+				t.Errorf("want %s, got %s", test.want, p)
+			}
+		})
+	}
+}
+
+func TestRolloutPoliciesPlayFullGames(t *testing.T) {
+	for _, spec := range []string{"uniform", "greedy", "epsgreedy:0.3", "weighted"} {
+		t.Run(spec, func(t *testing.T) {
+			policy, err := ParseRolloutPolicy(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rnd := rand.New(rand.NewSource(123))
+			for i := 0; i < 10; i++ {
+				ge := NewGameEngineFlagz(rnd)
+				for !ge.IsDone() {
+					m, err := policy.NextMove(ge, rnd)
+					if err != nil {
+						t.Fatalf("Cannot get next move: %s", err)
+					}
+					if !ge.MakeMove(m) {
+						t.Fatalf("Policy suggested an invalid move: %s", m.String())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGreedyRolloutPolicyPrefersGrass(t *testing.T) {
+	b := NewBoard()
+	b.Score = []int{0, 0}
+	b.Resources = []ResourceInfo{{}, {}}
+	// P1 owns two cells with value 1. Only the neighbor of (5, 1) can capture grass.
+	b.Fields[5][1] = Field{Type: cellNormal, Owner: 1, Value: 1}
+	b.Fields[0][5] = Field{Type: cellNormal, Owner: 1, Value: 1}
+	b.Fields[5][3] = Field{Type: cellGrass, Value: 2}
+	b.State = Running
+	ge := NewGameEngineFlagzFromBoard(b, rand.NewSource(1))
+	policy := &GreedyRolloutPolicy{Weights: defaultHeuristicWeights}
+	m, err := policy.NextMove(ge, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.row != 5 || m.col != 2 || m.cellType != cellNormal {
+		t.Errorf("Want move at (5,2), got %s", m.String())
+	}
+}
+
+func BenchmarkRolloutPolicies(b *testing.B) {
+	for _, spec := range []string{"uniform", "greedy", "weighted"} {
+		b.Run(spec, func(b *testing.B) {
+			policy, _ := ParseRolloutPolicy(spec)
+			rnd := rand.New(rand.NewSource(123))
+			for i := 0; i < b.N; i++ {
+				ge := NewGameEngineFlagz(rnd)
+				for !ge.IsDone() {
+					m, _ := policy.NextMove(ge, rnd)
+					ge.MakeMove(m)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package hexz
+
+// Self-play training data and its file format.
+//
+// A self-play file starts with a header followed by any number of game records.
+// All integers are little-endian.
+//
+//	header:   magic "HXSP" | version uint16
+//	game:     winner uint8 (0: draw) | numPositions uint16 | position...
+//	position: turn uint8 | move uint16 | score int16[2] | flagsLeft uint8[2] |
+//	          cells cell[numCells] | numVisits uint16 | visit...
+//	cell:     type uint8 | owner uint8 | value int8
+//	visit:    row uint8 | col uint8 | cellType uint8 | visits uint32
+//
+// Cells are stored row by row in the order of Board.FlatFields. numCells is
+// the number of fields of a board created by NewBoard. visits holds the number
+// of MCTS iterations spent on each move at the search tree's root, i.e. the
+// root visit distribution for the position.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	selfPlayMagic   = "HXSP"
+	selfPlayVersion = 1
+)
+
+type SelfPlayVisit struct {
+	Row      int
+	Col      int
+	CellType CellType
+	Visits   int
+}
+
+type SelfPlayPosition struct {
+	// The position before the move was made. Only the visible state of the
+	// board (turn, move, score, flags left and cell types, owners, values) is stored.
+	Board  *Board
+	Visits []SelfPlayVisit
+}
+
+type SelfPlayGame struct {
+	Winner    int // 0 for a draw.
+	Positions []*SelfPlayPosition
+}
+
+// Plays a game between two MCTS players, starting at ge's current state,
+// and records every position with the search's root visit distribution.
+func PlaySelfPlayGame(ge SinglePlayerGameEngine, players [2]*MCTS, thinkTime time.Duration) (*SelfPlayGame, error) {
+	if ge.NumPlayers() != 2 {
+		// The file format only holds two-player positions.
+		return nil, fmt.Errorf("self-play requires a two-player game, got %d players", ge.NumPlayers())
+	}
+	game := &SelfPlayGame{}
+	for !ge.IsDone() {
+		b := ge.Board()
+		pos := &SelfPlayPosition{Board: b.copy()}
+		m, stats := players[b.Turn-1].SuggestMove(ge, thinkTime)
+		pos.Visits = make([]SelfPlayVisit, len(stats.Moves))
+		for i, s := range stats.Moves {
+			pos.Visits[i] = SelfPlayVisit{Row: s.row, Col: s.col, CellType: s.cellType, Visits: s.iterations}
+		}
+		game.Positions = append(game.Positions, pos)
+		if !ge.MakeMove(m) {
+			return nil, fmt.Errorf("cannot make suggested move %s", m.String())
+		}
+	}
+	game.Winner = ge.Winner()
+	return game, nil
+}
+
+type SelfPlayWriter struct {
+	w *bufio.Writer
+}
+
+// Creates a writer and writes the file header to w.
+// Call Flush when done to make sure all data was written.
+func NewSelfPlayWriter(w io.Writer) (*SelfPlayWriter, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(selfPlayMagic); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint16(selfPlayVersion)); err != nil {
+		return nil, err
+	}
+	return &SelfPlayWriter{w: bw}, nil
+}
+
+func (w *SelfPlayWriter) WriteGame(g *SelfPlayGame) error {
+	if len(g.Positions) > 0xffff {
+		return fmt.Errorf("too many positions: %d", len(g.Positions))
+	}
+	bw := w.w
+	bw.WriteByte(uint8(g.Winner))
+	binary.Write(bw, binary.LittleEndian, uint16(len(g.Positions)))
+	for _, p := range g.Positions {
+		if err := w.writePosition(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *SelfPlayWriter) writePosition(p *SelfPlayPosition) error {
+	b := p.Board
+	if len(b.Score) != 2 || len(b.Resources) != 2 {
+		return fmt.Errorf("only two-player boards are supported")
+	}
+	if len(p.Visits) > 0xffff {
+		return fmt.Errorf("too many visits: %d", len(p.Visits))
+	}
+	bw := w.w
+	bw.WriteByte(uint8(b.Turn))
+	binary.Write(bw, binary.LittleEndian, uint16(b.Move))
+	binary.Write(bw, binary.LittleEndian, [2]int16{int16(b.Score[0]), int16(b.Score[1])})
+	bw.WriteByte(uint8(b.Resources[0].NumPieces[cellFlag]))
+	bw.WriteByte(uint8(b.Resources[1].NumPieces[cellFlag]))
+	for i := range b.FlatFields {
+		f := &b.FlatFields[i]
+		bw.WriteByte(uint8(f.Type))
+		bw.WriteByte(uint8(f.Owner))
+		bw.WriteByte(uint8(int8(f.Value)))
+	}
+	binary.Write(bw, binary.LittleEndian, uint16(len(p.Visits)))
+	for _, v := range p.Visits {
+		bw.WriteByte(uint8(v.Row))
+		bw.WriteByte(uint8(v.Col))
+		bw.WriteByte(uint8(v.CellType))
+		if err := binary.Write(bw, binary.LittleEndian, uint32(v.Visits)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *SelfPlayWriter) Flush() error {
+	return w.w.Flush()
+}
+
+type SelfPlayReader struct {
+	r *bufio.Reader
+}
+
+// Creates a reader and validates the file header read from r.
+func NewSelfPlayReader(r io.Reader) (*SelfPlayReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(selfPlayMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	if string(magic) != selfPlayMagic {
+		return nil, fmt.Errorf("not a self-play file")
+	}
+	var version uint16
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("cannot read header: %w", err)
+	}
+	if version != selfPlayVersion {
+		return nil, fmt.Errorf("unsupported version: %d", version)
+	}
+	return &SelfPlayReader{r: br}, nil
+}
+
+// Reads the next game. Returns io.EOF if there are no more games.
+func (r *SelfPlayReader) ReadGame() (*SelfPlayGame, error) {
+	var hdr struct {
+		Winner       uint8
+		NumPositions uint16
+	}
+	if err := binary.Read(r.r, binary.LittleEndian, &hdr); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated game record: %w", err)
+		}
+		return nil, err // io.EOF if there are no more games.
+	}
+	g := &SelfPlayGame{
+		Winner:    int(hdr.Winner),
+		Positions: make([]*SelfPlayPosition, hdr.NumPositions),
+	}
+	for i := range g.Positions {
+		p, err := r.readPosition()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read position %d: %w", i, err)
+		}
+		g.Positions[i] = p
+	}
+	return g, nil
+}
+
+func (r *SelfPlayReader) readPosition() (*SelfPlayPosition, error) {
+	var hdr struct {
+		Turn      uint8
+		Move      uint16
+		Score     [2]int16
+		FlagsLeft [2]uint8
+	}
+	if err := binary.Read(r.r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	b := NewBoard()
+	b.Turn = int(hdr.Turn)
+	b.Move = int(hdr.Move)
+	b.Score = []int{int(hdr.Score[0]), int(hdr.Score[1])}
+	b.Resources = make([]ResourceInfo, 2)
+	for i := range b.Resources {
+		b.Resources[i].NumPieces[cellNormal] = -1
+		b.Resources[i].NumPieces[cellFlag] = int(hdr.FlagsLeft[i])
+	}
+	b.State = Running
+	cells := make([]byte, 3*len(b.FlatFields))
+	if _, err := io.ReadFull(r.r, cells); err != nil {
+		return nil, err
+	}
+	for i := range b.FlatFields {
+		f := &b.FlatFields[i]
+		f.Type = CellType(cells[3*i])
+		f.Owner = int(cells[3*i+1])
+		f.Value = int(int8(cells[3*i+2]))
+		f.Lifetime = -1
+		if !f.Type.valid() {
+			return nil, fmt.Errorf("invalid cell type %d", f.Type)
+		}
+	}
+	var numVisits uint16
+	if err := binary.Read(r.r, binary.LittleEndian, &numVisits); err != nil {
+		return nil, err
+	}
+	p := &SelfPlayPosition{Board: b, Visits: make([]SelfPlayVisit, numVisits)}
+	for i := range p.Visits {
+		var v struct {
+			Row, Col, CellType uint8
+			Visits             uint32
+		}
+		if err := binary.Read(r.r, binary.LittleEndian, &v); err != nil {
+			return nil, err
+		}
+		p.Visits[i] = SelfPlayVisit{Row: int(v.Row), Col: int(v.Col), CellType: CellType(v.CellType), Visits: int(v.Visits)}
+	}
+	return p, nil
+}
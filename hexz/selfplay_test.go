@@ -0,0 +1,97 @@
+package hexz
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func playTestSelfPlayGame(t *testing.T, seed int64) *SelfPlayGame {
+	t.Helper()
+	ge := NewGameEngineFlagz(rand.NewSource(seed))
+	var players [2]*MCTS
+	for i := range players {
+		players[i] = NewMCTSFromSource(rand.NewSource(seed + int64(i) + 1))
+		players[i].MaxIterations = 20
+	}
+	g, err := PlaySelfPlayGame(ge, players, time.Hour)
+	if err != nil {
+		t.Fatalf("Self-play failed: %s", err)
+	}
+	return g
+}
+
+func TestSelfPlayRoundTrip(t *testing.T) {
+	games := []*SelfPlayGame{
+		playTestSelfPlayGame(t, 1),
+		playTestSelfPlayGame(t, 2),
+	}
+	var buf bytes.Buffer
+	w, err := NewSelfPlayWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range games {
+		if err := w.WriteGame(g); err != nil {
+			t.Fatalf("Cannot write game: %s", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSelfPlayReader(&buf)
+	if err != nil {
+		t.Fatalf("Cannot read header: %s", err)
+	}
+	for i, want := range games {
+		got, err := r.ReadGame()
+		if err != nil {
+			t.Fatalf("Cannot read game %d: %s", i, err)
+		}
+		if got.Winner != want.Winner || len(got.Positions) != len(want.Positions) {
+			t.Fatalf("Game %d: want winner %d with %d positions, got %d with %d",
+				i, want.Winner, len(want.Positions), got.Winner, len(got.Positions))
+		}
+		for j, p := range got.Positions {
+			wp := want.Positions[j]
+			if !cmp.Equal(p.Visits, wp.Visits) {
+				t.Errorf("Game %d, position %d: visits differ: %s", i, j, cmp.Diff(wp.Visits, p.Visits))
+			}
+			if p.Board.Turn != wp.Board.Turn || p.Board.Move != wp.Board.Move || !cmp.Equal(p.Board.Score, wp.Board.Score) {
+				t.Errorf("Game %d, position %d: board state differs", i, j)
+			}
+			for k, f := range p.Board.FlatFields {
+				wf := wp.Board.FlatFields[k]
+				if f.Type != wf.Type || f.Owner != wf.Owner || f.Value != wf.Value {
+					t.Errorf("Game %d, position %d: field %d differs: want %+v, got %+v", i, j, k, wf, f)
+				}
+			}
+		}
+	}
+	if _, err := r.ReadGame(); err != io.EOF {
+		t.Errorf("Want io.EOF after last game, got %v", err)
+	}
+}
+
+func TestSelfPlayIsReproducible(t *testing.T) {
+	g1 := playTestSelfPlayGame(t, 7)
+	g2 := playTestSelfPlayGame(t, 7)
+	if len(g1.Positions) != len(g2.Positions) || g1.Winner != g2.Winner {
+		t.Fatalf("Games differ: %d vs %d positions", len(g1.Positions), len(g2.Positions))
+	}
+	for i := range g1.Positions {
+		if !cmp.Equal(g1.Positions[i].Visits, g2.Positions[i].Visits) {
+			t.Fatalf("Visits differ at position %d", i)
+		}
+	}
+}
+
+func TestSelfPlayReaderRejectsGarbage(t *testing.T) {
+	if _, err := NewSelfPlayReader(bytes.NewReader([]byte("JUNK\x01\x00"))); err == nil {
+		t.Error("Expected error for invalid magic")
+	}
+}
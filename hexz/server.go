@@ -1,16 +1,20 @@
 package hexz
 
 import (
+	"context"
 	crand "crypto/rand"
 	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httputil"
 	"os"
 	"path"
 	"regexp"
@@ -18,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,15 +31,34 @@ type tok struct{}
 type ServerConfig struct {
 	ServerAddress     string
 	ServerPort        int
-	DocumentRoot      string
+	DocumentRoot      string // Files in this directory override embedded resources. Only embedded resources are used if empty.
 	PlayerRemoveDelay time.Duration
 	LoginTtl          time.Duration
 	CompThinkTime     time.Duration
-	AuthTokenSha256   string // Used in http Basic authentication for /statusz. Must be a SHA256 checksum.
+	// Maximum number of MCTS iterations per CPU move. If > 0, CompThinkTime is
+	// ignored, which makes CPU play deterministic for given seeds.
+	CpuMaxIterations int
+	// The CPU player solves positions with at most this many free cells or legal moves exactly.
+	CpuEndgameFreeCells int
+	CpuEndgameMoves     int
+	AuthTokenSha256     string // Used in http Basic authentication for /statusz. Must be a SHA256 checksum.
 
 	TlsCertChain string
 	TlsPrivKey   string
 	DebugMode    bool
+
+	EventLogDir      string // Directory to write game event logs to. No event log is written if empty.
+	EventLogMaxBytes int64  // Maximum size of a single event log file before a new one is started.
+
+	// Settings for running multiple instances behind one address.
+	InstanceId       string            // ID of this instance. Used as a prefix of all game IDs it creates.
+	Peers            map[string]string // Base URLs of peer instances, keyed by their instance ID.
+	PlayerStoreDir   string            // Directory shared by all instances to store logged in players.
+	UserDatabaseFile string            // File to persist logged in players to if no PlayerStoreDir is set.
+
+	CpuRolloutPolicy string // Rollout policy spec used by the CPU player. See ParseRolloutPolicy.
+	OpeningBookFile  string // Flagz opening book consulted by the CPU player. No book is used if empty.
+	LevelDir         string // Directory with Flagz level files. No levels are available if empty.
 }
 
 var (
@@ -53,6 +77,14 @@ type Server struct {
 
 	// Server configuration (set from command-line flags).
 	config *ServerConfig
+	// Initialized from config.DebugMode, but can be toggled at runtime via /admin/debug.
+	debugMode atomic.Bool
+	// Settings that can be reloaded at runtime. Always use these instead of the ones in config.
+	liveCfg atomic.Pointer[liveConfig]
+	// TLS certificate used for serving. nil if TLS is not enabled.
+	tlsCert atomic.Pointer[tls.Certificate]
+	// The HTTP server started by Serve. nil if Serve was not called.
+	httpServer atomic.Pointer[http.Server]
 
 	// Counters
 	counters    map[string]*Counter
@@ -62,6 +94,26 @@ type Server struct {
 	distrib    map[string]*Distribution
 	distribMut sync.Mutex
 
+	// Receives game lifecycle events for offline analysis.
+	eventSink GameEventSink
+
+	// Rate limits position analysis requests.
+	analyzeLimiter *analyzeLimiter
+
+	// Shared storage for logged in players. nil if this instance runs standalone.
+	playerStore PlayerStore
+	// Reverse proxies to forward requests for games owned by peer instances.
+	peerProxies map[string]*httputil.ReverseProxy
+
+	// Rollout policy used by CPU players.
+	cpuRollout RolloutPolicy
+	// Opening book consulted by CPU players before searching. nil if no book is configured.
+	openingBook *OpeningBook
+	// Flagz levels new games can be started from, sorted by name.
+	levels []*Level
+	// Embedded HTML pages and images.
+	resources *resourceCache
+
 	started time.Time
 }
 
@@ -72,9 +124,54 @@ func NewServer(cfg *ServerConfig) *Server {
 		config:          cfg,
 		counters:        make(map[string]*Counter),
 		distrib:         make(map[string]*Distribution),
+		eventSink:       nopGameEventSink{},
+		analyzeLimiter:  newAnalyzeLimiter(maxConcurrentAnalyses),
+		peerProxies:     newPeerProxies(cfg.Peers),
+		resources:       newResourceCache(),
 		started:         time.Now(),
 	}
+	s.debugMode.Store(cfg.DebugMode)
+	s.liveCfg.Store(newLiveConfig(cfg))
 	s.InitCounters()
+	if cfg.EventLogDir != "" {
+		sink, err := NewRotatingFileSink(cfg.EventLogDir, cfg.EventLogMaxBytes)
+		if err != nil {
+			log.Printf("Cannot create game event log, events will not be logged: %s", err)
+		} else {
+			s.eventSink = sink
+		}
+	}
+	rollout, err := ParseRolloutPolicy(cfg.CpuRolloutPolicy)
+	if err != nil {
+		log.Printf("Invalid CPU rollout policy, using uniform rollouts: %s", err)
+		rollout = UniformRolloutPolicy{}
+	}
+	s.cpuRollout = rollout
+	if cfg.OpeningBookFile != "" {
+		book, err := LoadOpeningBook(cfg.OpeningBookFile)
+		if err != nil {
+			log.Printf("Cannot load opening book, CPU players will not use one: %s", err)
+		} else {
+			log.Printf("Loaded opening book with %d positions", book.Len())
+			s.openingBook = book
+		}
+	}
+	if cfg.LevelDir != "" {
+		levels, err := LoadLevels(cfg.LevelDir)
+		if err != nil {
+			log.Printf("Cannot load levels: %s", err)
+		} else {
+			log.Printf("Loaded %d levels", len(levels))
+			s.levels = levels
+		}
+	}
+	if cfg.PlayerStoreDir != "" {
+		store, err := NewFileSystemPlayerStore(cfg.PlayerStoreDir)
+		if err != nil {
+			log.Fatal("Cannot create player store: ", err)
+		}
+		s.playerStore = store
+	}
 	return s
 }
 
@@ -84,10 +181,17 @@ func (s *Server) InitCounters() {
 			panic("Cannot create counter")
 		}
 	}
-	checkedAdd(fmt.Sprintf("/games/%s/mcts/elapsed", gameTypeFlagz), DistribRange(0.001, 60*60, 1.1))
-	checkedAdd(fmt.Sprintf("/games/%s/mcts/iterations", gameTypeFlagz), DistribRange(1, 1e9, 1.2))
-	checkedAdd(fmt.Sprintf("/games/%s/mcts/tree_size", gameTypeFlagz), DistribRange(1, 1e9, 1.2))
-	checkedAdd(fmt.Sprintf("/games/%s/mcts/iterations_per_sec", gameTypeFlagz), DistribRange(1, 1e6, 1.1))
+	// Distributions of the CPU player's search, for all game types it can play.
+	for _, d := range GameTypes() {
+		if !d.SinglePlayer {
+			continue
+		}
+		checkedAdd(fmt.Sprintf("/games/%s/mcts/elapsed", d.Type), DistribRange(0.001, 60*60, 1.1))
+		checkedAdd(fmt.Sprintf("/games/%s/mcts/iterations", d.Type), DistribRange(1, 1e9, 1.2))
+		checkedAdd(fmt.Sprintf("/games/%s/mcts/tree_size", d.Type), DistribRange(1, 1e9, 1.2))
+		checkedAdd(fmt.Sprintf("/games/%s/mcts/iterations_per_sec", d.Type), DistribRange(1, 1e6, 1.1))
+	}
+	checkedAdd("/requests/sse/duration", sseDurationBounds)
 }
 
 func (s *Server) Counter(name string) *Counter {
@@ -106,6 +210,18 @@ func (s *Server) IncCounter(name string) {
 	s.Counter(name).Increment()
 }
 
+func (s *Server) logGameEvent(game *GameHandle, e *GameEvent) {
+	e.Timestamp = time.Now()
+	e.GameId = game.id
+	e.GameType = game.gameType
+	if err := s.eventSink.Write(e); err != nil {
+		s.IncCounter("/eventlog/errors")
+		log.Printf("Cannot write game event: %s", err)
+		return
+	}
+	s.IncCounter("/eventlog/written")
+}
+
 func (s *Server) AddDistribution(name string, bounds []float64) error {
 	s.distribMut.Lock()
 	defer s.distribMut.Unlock()
@@ -136,12 +252,11 @@ func (s *Server) AddDistribValue(name string, value float64) bool {
 const (
 	maxLoggedInPlayers = 10000
 
-	playerIdCookieName   = "playerId"
-	gameHtmlFilename     = "game.html"
-	loginHtmlFilename    = "login.html"
-	newGameHtmlFilename  = "new.html"
-	rulesHtmlFilename    = "rules.html"
-	userDatabaseFilename = "_users.json"
+	playerIdCookieName  = "playerId"
+	gameHtmlFilename    = "game.html"
+	loginHtmlFilename   = "login.html"
+	newGameHtmlFilename = "new.html"
+	rulesHtmlFilename   = "rules.html"
 )
 
 var (
@@ -176,9 +291,51 @@ type GameHandle struct {
 	started      time.Time
 	gameType     GameType
 	host         string            // Name of the player hosting the game (the one who created it)
+	hostId       string            // Player ID of the host.
 	singlePlayer bool              // If true, only player 1 is human, the rest are computer-controlled.
+	numPlayers   int               // Number of players. The game type's default is used if 0.
+	private      bool              // If true, the game is not listed and can only be joined with the invite token.
+	inviteToken  string            // Token required to join private games.
+	reservedFor  string            // If not empty, only the host and the player with this name can take a seat.
+	seeds        GameSeeds         // Seeds of the game engine's and CPU player's random number generators.
+	difficulty   *difficultyLevel  // Strength of the CPU player. nil if the game is not single player.
+	level        *Level            // Starting layout of Flagz games. Random if nil.
 	controlEvent chan ControlEvent // The channel to communicate with the game coordinating goroutine.
 	done         chan struct{}     // Closed by the game master goroutine when it is done.
+	openSeats    atomic.Int32      // Number of seats not taken yet. Updated by the game master goroutine.
+}
+
+// Returns the game's public info. Its seeds are only included if withSeeds is true
+// or the game is over.
+func (g *GameHandle) info(withSeeds bool) *GameInfo {
+	info := &GameInfo{
+		Id:         g.id,
+		Host:       g.host,
+		Started:    g.started,
+		GameType:   g.gameType,
+		OpenSeats:  int(g.openSeats.Load()),
+		Difficulty: g.difficulty.String(),
+		NumPlayers: g.numPlayers,
+		Level:      g.levelName(),
+	}
+	select {
+	case <-g.done:
+		withSeeds = true
+	default:
+	}
+	if withSeeds {
+		seeds := g.seeds
+		info.Seeds = &seeds
+	}
+	return info
+}
+
+// Returns the name of the game's level, or "" if it uses random layouts.
+func (g *GameHandle) levelName() string {
+	if g.level == nil {
+		return ""
+	}
+	return g.level.Name
 }
 
 // Player has JSON annotations for serialization to disk.
@@ -195,7 +352,28 @@ func (s *Server) lookupPlayer(playerId string) (Player, bool) {
 
 	p, ok := s.loggedInPlayers[playerId]
 	if !ok {
-		return Player{}, false
+		if s.playerStore == nil {
+			return Player{}, false
+		}
+		// The player might have logged in on a peer instance.
+		s.loggedInPlayersMut.Unlock()
+		p, err := s.playerStore.Load(playerId)
+		s.loggedInPlayersMut.Lock()
+		if err != nil {
+			if err != errPlayerNotFound {
+				log.Printf("Cannot load player %s from store: %s", playerId, err)
+			}
+			return Player{}, false
+		}
+		s.IncCounter("/storage/playerstore/loaded")
+		if existing, ok := s.loggedInPlayers[playerId]; ok {
+			// Another goroutine was faster.
+			p = existing
+		} else {
+			s.loggedInPlayers[playerId] = p
+		}
+		p.LastActive = time.Now()
+		return *p, true
 	}
 	p.LastActive = time.Now()
 	return *p, true
@@ -216,6 +394,12 @@ func (s *Server) loginPlayer(playerId string, name string) bool {
 		LastActive: time.Now(),
 	}
 	s.loggedInPlayers[playerId] = p
+	if s.playerStore != nil {
+		// Make the player known to peer instances right away.
+		if err := s.playerStore.Save(p); err != nil {
+			log.Printf("Cannot save player %s to store: %s", playerId, err)
+		}
+	}
 	return true
 }
 
@@ -226,6 +410,7 @@ type ControlEvent interface {
 
 type ControlEventRegister struct {
 	player    Player
+	spectator bool // If true, the player only watches the game and does not take a seat.
 	replyChan chan chan ServerEvent
 }
 
@@ -237,6 +422,7 @@ type ControlEventMove struct {
 	playerId string
 	MoveRequest
 	confidence float64 // In [0..1], can be populated by CPU players to express their confidence in winning.
+	iterations int     // Can be populated by CPU players to report the search effort spent on the move.
 }
 
 type ControlEventReset struct {
@@ -244,10 +430,28 @@ type ControlEventReset struct {
 	message  string
 }
 
-func (e ControlEventRegister) controlEventImpl()   {}
-func (e ControlEventUnregister) controlEventImpl() {}
-func (e ControlEventMove) controlEventImpl()       {}
-func (e ControlEventReset) controlEventImpl()      {}
+type ControlEventAnalyze struct {
+	playerId  string
+	replyChan chan analyzeSnapshot
+}
+
+type ControlEventResync struct {
+	playerId string
+}
+
+type ControlEventExportLevel struct {
+	playerId  string
+	name      string
+	replyChan chan levelExport
+}
+
+func (e ControlEventRegister) controlEventImpl()    {}
+func (e ControlEventUnregister) controlEventImpl()  {}
+func (e ControlEventMove) controlEventImpl()        {}
+func (e ControlEventReset) controlEventImpl()       {}
+func (e ControlEventAnalyze) controlEventImpl()     {}
+func (e ControlEventExportLevel) controlEventImpl() {}
+func (e ControlEventResync) controlEventImpl()      {}
 
 func (g *GameHandle) sendEvent(e ControlEvent) bool {
 	select {
@@ -258,9 +462,9 @@ func (g *GameHandle) sendEvent(e ControlEvent) bool {
 	}
 }
 
-func (g *GameHandle) registerPlayer(p Player) (chan ServerEvent, error) {
+func (g *GameHandle) registerPlayer(p Player, spectator bool) (chan ServerEvent, error) {
 	ch := make(chan chan ServerEvent)
-	if g.sendEvent(ControlEventRegister{player: p, replyChan: ch}) {
+	if g.sendEvent(ControlEventRegister{player: p, spectator: spectator, replyChan: ch}) {
 		return <-ch, nil
 	}
 	return nil, fmt.Errorf("cannot register player %s in game %s: game over", p.Id, g.id)
@@ -270,9 +474,24 @@ func (g *GameHandle) unregisterPlayer(playerId string) {
 	g.sendEvent(ControlEventUnregister{playerId: playerId})
 }
 
-func (s *Server) readFile(filename string) ([]byte, error) {
-	s.IncCounter("/storage/files/readfile")
-	return os.ReadFile(path.Join(s.config.DocumentRoot, filename))
+// Returns a copy of the game's engine that can be analyzed by the given player.
+func (g *GameHandle) analyzeSnapshot(playerId string) (SinglePlayerGameEngine, error) {
+	ch := make(chan analyzeSnapshot)
+	if !g.sendEvent(ControlEventAnalyze{playerId: playerId, replyChan: ch}) {
+		return nil, fmt.Errorf("game %s is over", g.id)
+	}
+	snapshot := <-ch
+	return snapshot.ge, snapshot.err
+}
+
+// Returns the game's current board as a level with the given name.
+func (g *GameHandle) exportLevel(playerId, name string) (*Level, error) {
+	ch := make(chan levelExport)
+	if !g.sendEvent(ControlEventExportLevel{playerId: playerId, name: name, replyChan: ch}) {
+		return nil, fmt.Errorf("game %s is over", g.id)
+	}
+	e := <-ch
+	return e.level, e.err
 }
 
 // Generates a random 128-bit hex string representing a player ID.
@@ -292,24 +511,69 @@ func generateGameId() string {
 	return b.String()
 }
 
+// Generates random seeds for a new game.
+func generateGameSeeds() GameSeeds {
+	var p [16]byte
+	crand.Read(p[:])
+	return GameSeeds{
+		Engine: int64(binary.LittleEndian.Uint64(p[:8]) >> 1),
+		Cpu:    int64(binary.LittleEndian.Uint64(p[8:]) >> 1),
+	}
+}
+
 // Looks up the game ID from the URL path.
 func gameIdFromPath(path string) string {
 	pathSegs := strings.Split(path, "/")
 	l := len(pathSegs)
+	if isBoardImagePath(path) {
+		return pathSegs[l-2]
+	}
 	if l >= 2 && pathSegs[1] == "hexz" {
 		return pathSegs[l-1]
 	}
 	return ""
 }
 
-func cpuPlayer(s *Server, playerId string, thinkTime time.Duration, ge SinglePlayerGameEngine, req chan tok, ctrl chan ControlEvent) {
+func cpuPlayer(s *Server, playerId string, thinkTime time.Duration, seed int64, level *difficultyLevel, ge SinglePlayerGameEngine, req chan tok, ctrl chan ControlEvent) {
 	gameType := ge.GameType()
-	mcts := NewMCTS()
+	mcts := NewMCTSFromSource(rand.NewSource(seed))
+	mcts.EndgameFreeCells = s.config.CpuEndgameFreeCells
+	mcts.EndgameMoves = s.config.CpuEndgameMoves
+	if err := level.configure(mcts, s.cpuRollout); err != nil {
+		// Levels are static, so this is a programming error.
+		log.Printf("Cannot configure CPU player for difficulty %s: %s", level.Name, err)
+	}
+	// Used to pick moves according to the level's temperature and blunder rate.
+	moveRnd := rand.New(rand.NewSource(seed + 1))
+	if n := s.config.CpuMaxIterations; n > 0 {
+		// Only the iteration budget should limit the search.
+		if mcts.MaxIterations == 0 || n < mcts.MaxIterations {
+			mcts.MaxIterations = n
+		}
+		thinkTime = time.Duration(24) * time.Hour
+	}
 	// Minimum time to spend thinking about a move, even if we're dead certain about the result.
 	minTime := time.Duration(100) * time.Millisecond
 	t := thinkTime
 	for range req {
+		if s.openingBook != nil && level.Exact {
+			if m, stats, ok := s.openingBook.Lookup(ge); ok {
+				ctrl <- ControlEventMove{
+					playerId:   playerId,
+					confidence: stats.MaxQ(),
+					MoveRequest: MoveRequest{
+						Move: m.move,
+						Row:  m.row,
+						Col:  m.col,
+						Type: m.cellType,
+					},
+				}
+				s.IncCounter(fmt.Sprintf("/games/%s/mcts/book_hits", gameType))
+				continue
+			}
+		}
 		m, stats := mcts.SuggestMove(ge, t)
+		m = level.selectMove(m, stats, moveRnd)
 		if minQ := stats.MinQ(); minQ >= 0.98 || minQ <= 0.02 {
 			// Speed up if we think we (almost) won or lost.
 			t = t / 2
@@ -323,6 +587,7 @@ func cpuPlayer(s *Server, playerId string, thinkTime time.Duration, ge SinglePla
 		ctrl <- ControlEventMove{
 			playerId:   playerId,
 			confidence: stats.MaxQ(),
+			iterations: stats.Iterations,
 			MoveRequest: MoveRequest{
 				Move: m.move,
 				Row:  m.row,
@@ -335,6 +600,9 @@ func cpuPlayer(s *Server, playerId string, thinkTime time.Duration, ge SinglePla
 		if stats.FullyExplored {
 			s.IncCounter(fmt.Sprintf("/games/%s/mcts/fully_explored", gameType))
 		}
+		if stats.Proven {
+			s.IncCounter(fmt.Sprintf("/games/%s/mcts/proven", gameType))
+		}
 		s.AddDistribValue(fmt.Sprintf("/games/%s/mcts/elapsed", gameType), stats.Elapsed.Seconds())
 		s.AddDistribValue(fmt.Sprintf("/games/%s/mcts/iterations", gameType), float64(stats.Iterations))
 		s.AddDistribValue(fmt.Sprintf("/games/%s/mcts/tree_size", gameType), float64(stats.TreeSize))
@@ -349,8 +617,25 @@ func gameMaster(s *Server, game *GameHandle) {
 	const playerIdComputer = "comp"
 	s.IncCounter(fmt.Sprintf("/games/%s/started", game.gameType))
 	log.Printf("Started new %q game: %s", game.gameType, game.id)
-	randomSrc := rand.NewSource(time.Now().UnixNano())
-	gameEngine := NewGameEngine(game.gameType, randomSrc)
+	log.Printf("Game %s uses seeds engine=%d cpu=%d", game.id, game.seeds.Engine, game.seeds.Cpu)
+	randomSrc := rand.NewSource(game.seeds.Engine)
+	gameEngine := NewGameEngine(game.gameType, game.numPlayers, randomSrc)
+	if game.level != nil {
+		// Levels are only accepted for Flagz games.
+		gameEngine.(*GameEngineFlagz).SetLevel(game.level)
+	}
+	seeds := game.seeds
+	s.logGameEvent(game, &GameEvent{
+		Type:         gameEventCreated,
+		Host:         game.host,
+		NumPlayers:   gameEngine.NumPlayers(),
+		SinglePlayer: game.singlePlayer,
+		Seeds:        &seeds,
+		Difficulty:   game.difficulty.String(),
+		Level:        game.levelName(),
+	})
+	lastMoveTime := time.Now()
+	game.openSeats.Store(int32(gameEngine.NumPlayers()))
 	// Player and spectator channels, keyed by playerId.
 	eventListeners := make(map[string]chan ServerEvent)
 	defer func() {
@@ -364,13 +649,33 @@ func gameMaster(s *Server, game *GameHandle) {
 		Player
 	}
 	players := make(map[string]pInfo) // keyed by playerId
+	kicked := make(map[string]bool)   // Players removed by an operator. They can only watch the game.
 	playerNames := func() []string {
-		r := make([]string, len(players))
+		n := 0
+		for _, p := range players {
+			if p.playerNum > n {
+				n = p.playerNum
+			}
+		}
+		r := make([]string, n)
 		for _, p := range players {
 			r[p.playerNum-1] = p.Name
 		}
 		return r
 	}
+	// Returns the lowest player number whose seat is not taken.
+	freeSeat := func() int {
+		taken := make([]bool, gameEngine.NumPlayers()+1)
+		for _, p := range players {
+			taken[p.playerNum] = true
+		}
+		for i := 1; i < len(taken); i++ {
+			if !taken[i] {
+				return i
+			}
+		}
+		return 0
+	}
 	playerRmCancel := make(map[string]chan struct{})
 	playerRm := make(chan string)
 	broadcastPing := func(message string) {
@@ -413,7 +718,7 @@ func gameMaster(s *Server, game *GameHandle) {
 		// Start CPU player.
 		cpuCh = make(chan tok)
 		defer close(cpuCh)
-		go cpuPlayer(s, playerIdComputer, s.config.CompThinkTime, gameEngine.(SinglePlayerGameEngine), cpuCh, game.controlEvent)
+		go cpuPlayer(s, playerIdComputer, s.live().compThinkTime, game.seeds.Cpu, game.difficulty, gameEngine.(SinglePlayerGameEngine), cpuCh, game.controlEvent)
 	}
 
 	for {
@@ -431,28 +736,32 @@ func gameMaster(s *Server, game *GameHandle) {
 						delete(playerRmCancel, e.player.Id)
 					}
 					playerNum = p.playerNum
-				} else if len(players) < gameEngine.NumPlayers() {
+				} else if len(players) < gameEngine.NumPlayers() && !e.spectator && !kicked[e.player.Id] {
 					added = true
-					playerNum = len(players) + 1
+					playerNum = freeSeat()
 					players[e.player.Id] = pInfo{playerNum, e.player}
+					s.logGameEvent(game, &GameEvent{Type: gameEventPlayerJoined, PlayerNum: playerNum, PlayerName: e.player.Name})
 					if game.singlePlayer {
 						players[playerIdComputer] =
 							pInfo{playerNum: 2, Player: Player{Id: playerIdComputer, Name: "Computer"}}
+						s.logGameEvent(game, &GameEvent{Type: gameEventPlayerJoined, PlayerNum: 2, PlayerName: "Computer"})
 					}
+					lastMoveTime = time.Now()
+					game.openSeats.Store(int32(gameEngine.NumPlayers() - len(players)))
 				}
 				ch := make(chan ServerEvent)
 				eventListeners[e.player.Id] = ch
 				e.replyChan <- ch
 				// Send board and player role initially so client can display the UI.
 				singlecast(e.player.Id, &ServerEvent{Role: int(playerNum)})
-				announcements := []string{}
+				evt := &ServerEvent{Announcements: []string{}}
 				if added {
-					announcements = append(announcements, fmt.Sprintf("Welcome %s!", e.player.Name))
+					evt.announce(newAnnouncement(announcePlayerJoined, "name", e.player.Name))
 				}
 				if added && gameEngine.Board().State == Running {
-					announcements = append(announcements, "The game begins!")
+					evt.announce(newAnnouncement(announceGameBegins))
 				}
-				broadcast(&ServerEvent{Announcements: announcements})
+				broadcast(evt)
 			case ControlEventUnregister:
 				delete(eventListeners, e.playerId)
 				if _, ok := playerRmCancel[e.playerId]; ok {
@@ -466,7 +775,7 @@ func gameMaster(s *Server, game *GameHandle) {
 					cancel := make(chan struct{})
 					playerRmCancel[e.playerId] = cancel
 					go func(playerId string) {
-						t := time.After(s.config.PlayerRemoveDelay)
+						t := time.After(s.live().playerRemoveDelay)
 						select {
 						case <-t:
 							playerRm <- playerId
@@ -481,24 +790,50 @@ func gameMaster(s *Server, game *GameHandle) {
 					break
 				}
 				before := time.Now()
-				if s.config.DebugMode {
+				if s.debugMode.Load() {
 					debugReq, _ := json.Marshal(e.MoveRequest)
 					log.Printf("%s: move request: P%d %s", game.id, p.playerNum, debugReq)
 				}
 				if gameEngine.MakeMove(GameEngineMove{playerNum: p.playerNum, move: e.Move, row: e.Row, col: e.Col, cellType: e.Type}) {
+					s.logGameEvent(game, &GameEvent{
+						Type:       gameEventMove,
+						PlayerNum:  p.playerNum,
+						PlayerName: p.Name,
+						Move: &GameEventMove{
+							Move:       e.Move,
+							Row:        e.Row,
+							Col:        e.Col,
+							CellType:   e.Type,
+							MoveTimeMs: before.Sub(lastMoveTime).Milliseconds(),
+							Confidence: e.confidence,
+							Iterations: e.iterations,
+						},
+					})
+					lastMoveTime = before
+					if s.debugMode.Load() {
+						if err := gameEngine.Validate(); err != nil {
+							s.IncCounter(fmt.Sprintf("/games/%s/invalid_state", game.gameType))
+							log.Printf("%s: after move %d: %s", game.id, gameEngine.Board().Move, err)
+						}
+					}
 					evt := &ServerEvent{Announcements: []string{}}
 					if gameEngine.IsDone() {
 						s.IncCounter(fmt.Sprintf("/games/%s/finished", game.gameType))
+						s.logGameEvent(game, &GameEvent{
+							Type:       gameEventResult,
+							Difficulty: game.difficulty.String(),
+							Result: &GameEventResult{
+								Winner: gameEngine.Winner(),
+								Score:  gameEngine.Board().Score,
+							},
+						})
 						if winner := gameEngine.Winner(); winner > 0 {
 							evt.Winner = winner
-							winnerName := playerNames()[winner-1]
-							evt.Announcements = append(evt.Announcements,
-								fmt.Sprintf("&#127942; &#127942; &#127942; %s won &#127942; &#127942; &#127942;",
-									winnerName))
+							evt.announce(newAnnouncement(announceGameWon, "winner", playerNames()[winner-1]))
 						}
 					}
 					if e.confidence > 0 {
-						evt.Announcements = append(evt.Announcements, fmt.Sprintf("CPU confidence: %.3f", e.confidence))
+						evt.announce(newAnnouncement(announceCpuConfidence, "confidence", fmt.Sprintf("%.3f", e.confidence)))
 					}
 					if game.singlePlayer && gameEngine.Board().Turn != 1 && !gameEngine.IsDone() {
 						// Ask CPU player to make a move.
@@ -506,7 +841,7 @@ func gameMaster(s *Server, game *GameHandle) {
 					}
 					broadcast(evt)
 				}
-				if s.config.DebugMode {
+				if s.debugMode.Load() {
 					log.Printf("MakeMove took %dus.", time.Since(before).Microseconds())
 				}
 			case ControlEventReset:
@@ -515,42 +850,150 @@ func gameMaster(s *Server, game *GameHandle) {
 					break // Only players are allowed to reset
 				}
 				gameEngine.Reset()
-				announcements := []string{
-					fmt.Sprintf("Player %s restarted the game.", p.Name),
+				lastMoveTime = time.Now()
+				s.logGameEvent(game, &GameEvent{Type: gameEventReset, PlayerNum: p.playerNum, PlayerName: p.Name})
+				evt := &ServerEvent{}
+				evt.announce(newAnnouncement(announceGameReset, "name", p.Name))
+				broadcast(evt)
+			case ControlEventAnalyze:
+				p, ok := players[e.playerId]
+				if !ok {
+					e.replyChan <- analyzeSnapshot{err: fmt.Errorf("only players can analyze the game")}
+					break
 				}
-				broadcast(&ServerEvent{Announcements: announcements})
+				e.replyChan <- snapshotForAnalysis(gameEngine, p.playerNum)
+			case ControlEventResync:
+				// The client's board is out of sync. Send it the full board.
+				singlecast(e.playerId, &ServerEvent{resync: true})
+			case ControlEventExportLevel:
+				if _, ok := players[e.playerId]; !ok {
+					e.replyChan <- levelExport{err: fmt.Errorf("only players can export levels")}
+					break
+				}
+				e.replyChan <- exportLevel(gameEngine, e.name)
+			case ControlEventInspect:
+				snapshot := adminGameSnapshot{
+					state:   gameEngine.Board().State,
+					move:    gameEngine.Board().Move,
+					players: make([]AdminPlayerInfo, 0, len(players)),
+				}
+				if e.withBoard {
+					snapshot.board = gameEngine.Board().copy()
+				}
+				for pId, p := range players {
+					_, connected := eventListeners[pId]
+					snapshot.players = append(snapshot.players, AdminPlayerInfo{
+						Id:        pId,
+						Name:      p.Name,
+						PlayerNum: p.playerNum,
+						Connected: connected || pId == playerIdComputer,
+					})
+				}
+				sort.Slice(snapshot.players, func(i, j int) bool {
+					return snapshot.players[i].PlayerNum < snapshot.players[j].PlayerNum
+				})
+				for pId := range eventListeners {
+					if _, ok := players[pId]; !ok {
+						snapshot.spectators++
+					}
+				}
+				e.replyChan <- snapshot
+			case ControlEventAnnounce:
+				evt := &ServerEvent{}
+				evt.announce(newAnnouncement(announceOperatorMessage, "message", e.message))
+				broadcast(evt)
+			case ControlEventTerminate:
+				log.Printf("Game %s was terminated by an operator", game.id)
+				evt := &ServerEvent{}
+				evt.announce(newAnnouncement(announceGameTerminated))
+				if e.message != "" {
+					evt.announce(newAnnouncement(announceOperatorMessage, "message", e.message))
+				}
+				broadcast(evt)
+				return
+			case ControlEventKick:
+				p, isPlayer := players[e.playerId]
+				isPlayer = isPlayer && e.playerId != playerIdComputer
+				ch, connected := eventListeners[e.playerId]
+				if connected {
+					close(ch)
+					delete(eventListeners, e.playerId)
+				}
+				e.replyChan <- isPlayer || connected
+				if !isPlayer {
+					// Spectators only lose their connection.
+					break
+				}
+				// Free the player's seat. The game goes on and waits for another player to take it.
+				if cancel, ok := playerRmCancel[e.playerId]; ok {
+					close(cancel)
+					delete(playerRmCancel, e.playerId)
+				}
+				delete(players, e.playerId)
+				kicked[e.playerId] = true
+				game.openSeats.Store(int32(gameEngine.NumPlayers() - len(players)))
+				log.Printf("Player %s was removed from game %s by an operator", e.playerId, game.id)
+				s.logGameEvent(game, &GameEvent{Type: gameEventPlayerLeft, PlayerNum: p.playerNum, PlayerName: p.Name})
+				evt := &ServerEvent{}
+				evt.announce(newAnnouncement(announcePlayerRemoved, "name", p.Name))
+				broadcast(evt)
 			}
 		case <-tick:
 			broadcastPing("ping")
 		case playerId := <-playerRm:
+			if _, ok := players[playerId]; !ok {
+				// The player was removed by an operator in the meantime.
+				break
+			}
 			log.Printf("Player %s left game %s: game over", playerId, game.id)
 			playerName := "?"
 			if p, ok := players[playerId]; ok {
 				playerName = p.Name
+				s.logGameEvent(game, &GameEvent{Type: gameEventPlayerLeft, PlayerNum: p.playerNum, PlayerName: p.Name})
 			}
-			broadcast(&ServerEvent{
-				// Send sad emoji.
-				Announcements: []string{fmt.Sprintf("Player %s left the game &#128546;. Game over.", playerName)},
-			})
+			evt := &ServerEvent{}
+			evt.announce(newAnnouncement(announcePlayerLeft, "name", playerName))
+			broadcast(evt)
 			return
 		}
 	}
 }
 
-func (s *Server) startNewGame(host string, gameType GameType, singlePlayer bool) (*GameHandle, error) {
+func (s *Server) startNewGame(host Player, gameType GameType, opts gameOptions) (*GameHandle, error) {
 	// Try a few times to find an unused game Id, else give up.
 	// (I don't like forever loops... 100 attempts is plenty.)
+	seeds := generateGameSeeds()
+	if opts.seeds != nil {
+		seeds = *opts.seeds
+	}
+	if opts.singlePlayer && opts.difficulty == nil {
+		opts.difficulty, _ = lookupDifficulty(defaultDifficulty)
+	}
 	var game *GameHandle
 	for i := 0; i < 100; i++ {
 		id := generateGameId()
+		inviteToken := ""
+		if opts.private {
+			id = generatePrivateGameId()
+			inviteToken = generateInviteToken()
+		}
+		id = s.qualifyGameId(id)
 		s.ongoingGamesMut.Lock()
 		if _, ok := s.ongoingGames[id]; !ok {
 			game = &GameHandle{
 				id:           id,
 				started:      time.Now(),
 				gameType:     gameType,
-				host:         host,
-				singlePlayer: singlePlayer,
+				host:         host.Name,
+				hostId:       host.Id,
+				singlePlayer: opts.singlePlayer,
+				numPlayers:   opts.numPlayers,
+				private:      opts.private,
+				inviteToken:  inviteToken,
+				reservedFor:  opts.reservedFor,
+				seeds:        seeds,
+				difficulty:   opts.difficulty,
+				level:        opts.level,
 				controlEvent: make(chan ControlEvent),
 				done:         make(chan struct{}),
 			}
@@ -577,35 +1020,8 @@ func (s *Server) lookupGame(id string) *GameHandle {
 	return s.ongoingGames[id]
 }
 
-func (s *Server) listRecentGames(limit int) []*GameInfo {
-	s.ongoingGamesMut.Lock()
-	gameInfos := []*GameInfo{}
-	for _, g := range s.ongoingGames {
-		gameInfos = append(gameInfos, &GameInfo{
-			Id:       g.id,
-			Host:     g.host,
-			Started:  g.started,
-			GameType: g.gameType,
-		})
-	}
-	s.ongoingGamesMut.Unlock()
-	sort.Slice(gameInfos, func(i, j int) bool {
-		return gameInfos[i].Started.After(gameInfos[j].Started)
-	})
-	if limit > len(gameInfos) {
-		limit = len(gameInfos)
-	}
-	return gameInfos[:limit]
-}
-
 func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
-	html, err := s.readFile(loginHtmlFilename)
-	if err != nil {
-		http.Error(w, "Failed to load login screen", http.StatusInternalServerError)
-		log.Fatal("Cannot read login HTML page: ", err.Error())
-	}
-	w.Header().Set("Content-Type", "text/html")
-	w.Write(html)
+	s.serveResource(w, r, loginHtmlFilename)
 }
 
 func isValidPlayerName(name string) bool {
@@ -649,7 +1065,7 @@ func (s *Server) handleLoginRequest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Cannot log in right now", http.StatusPreconditionFailed)
 	}
 	s.IncCounter("/requests/login/success")
-	http.SetCookie(w, makePlayerCookie(playerId, s.config.LoginTtl))
+	http.SetCookie(w, makePlayerCookie(playerId, s.live().loginTtl))
 	http.Redirect(w, r, "/hexz", http.StatusSeeOther)
 }
 
@@ -659,15 +1075,9 @@ func (s *Server) handleHexz(w http.ResponseWriter, r *http.Request) {
 		s.handleLoginPage(w, r)
 		return
 	}
-	html, err := s.readFile(newGameHtmlFilename)
-	if err != nil {
-		http.Error(w, "Failed to load html", http.StatusInternalServerError)
-		log.Fatal("Cannot read new game HTML page: ", err.Error())
-	}
-	w.Header().Set("Content-Type", "text/html")
 	// Prolong cookie ttl.
-	http.SetCookie(w, makePlayerCookie(p.Id, s.config.LoginTtl))
-	w.Write(html)
+	http.SetCookie(w, makePlayerCookie(p.Id, s.live().loginTtl))
+	s.serveResource(w, r, newGameHtmlFilename)
 }
 
 func (s *Server) handleNewGame(w http.ResponseWriter, r *http.Request) {
@@ -694,24 +1104,91 @@ func (s *Server) handleNewGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	gameType := GameType(typeParam)
-	singlePlayer := false
+	var opts gameOptions
 	if r.Form.Has("singlePlayer") {
-		singlePlayer, err = strconv.ParseBool(r.Form.Get("singlePlayer"))
+		opts.singlePlayer, err = strconv.ParseBool(r.Form.Get("singlePlayer"))
 		if err != nil {
 			http.Error(w, "Invalid value for 'singlePlayer'", http.StatusBadRequest)
 			return
 		}
-		if singlePlayer && !supportsSinglePlayer(gameType) {
+		if opts.singlePlayer && !supportsSinglePlayer(gameType) {
 			http.Error(w, "Single player mode not supported", http.StatusBadRequest)
 			return
 		}
 	}
-	game, err := s.startNewGame(p.Name, GameType(typeParam), singlePlayer)
+	if r.Form.Has("players") {
+		opts.numPlayers, err = strconv.Atoi(r.Form.Get("players"))
+		lo, hi := playerCountRange(gameType)
+		if err != nil || opts.numPlayers < lo || opts.numPlayers > hi {
+			http.Error(w, "Invalid value for 'players'", http.StatusBadRequest)
+			return
+		}
+		if opts.singlePlayer && opts.numPlayers != 2 {
+			http.Error(w, "Single player mode is only supported for two players", http.StatusBadRequest)
+			return
+		}
+	}
+	if r.Form.Has("private") {
+		opts.private, err = strconv.ParseBool(r.Form.Get("private"))
+		if err != nil {
+			http.Error(w, "Invalid value for 'private'", http.StatusBadRequest)
+			return
+		}
+	}
+	if reservedFor := strings.TrimSpace(r.Form.Get("reservedFor")); reservedFor != "" {
+		if !isValidPlayerName(reservedFor) {
+			http.Error(w, "Invalid value for 'reservedFor'", http.StatusBadRequest)
+			return
+		}
+		opts.reservedFor = reservedFor
+	}
+	if d := r.Form.Get("difficulty"); d != "" || opts.singlePlayer {
+		if !opts.singlePlayer {
+			http.Error(w, "A difficulty can only be set for single player games", http.StatusBadRequest)
+			return
+		}
+		if d == "" {
+			d = defaultDifficulty
+		}
+		opts.difficulty, err = lookupDifficulty(d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if name := r.Form.Get("level"); name != "" {
+		if !lookupGameType(gameType).Levels {
+			http.Error(w, fmt.Sprintf("Levels are not supported for %s games", gameType), http.StatusBadRequest)
+			return
+		}
+		opts.level = s.lookupLevel(name)
+		if opts.level == nil {
+			http.Error(w, fmt.Sprintf("No level named %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+	if r.Form.Get("engineSeed") != "" || r.Form.Get("cpuSeed") != "" {
+		if !s.debugMode.Load() {
+			http.Error(w, "Seeds can only be set in debug mode", http.StatusBadRequest)
+			return
+		}
+		seeds, err := parseGameSeeds(r.Form.Get("engineSeed"), r.Form.Get("cpuSeed"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.seeds = &seeds
+	}
+	game, err := s.startNewGame(p, gameType, opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
 	}
 	s.IncCounter("/games/started")
-	http.Redirect(w, r, fmt.Sprintf("/hexz/%s", game.id), http.StatusSeeOther)
+	if opts.private {
+		s.IncCounter("/games/started/private")
+	}
+	http.Redirect(w, r, game.inviteUrlPath(), http.StatusSeeOther)
 }
 
 func (s *Server) validatePostRequest(r *http.Request) (Player, error) {
@@ -781,6 +1258,23 @@ func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Asks the game to send the player's board in full, e.g. after the client lost track of delta updates.
+func (s *Server) handleResync(w http.ResponseWriter, r *http.Request) {
+	p, err := s.validatePostRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gameId := gameIdFromPath(r.URL.Path)
+	game := s.lookupGame(gameId)
+	if game == nil {
+		http.Error(w, fmt.Sprintf("No game with ID %q", gameId), http.StatusNotFound)
+		return
+	}
+	s.IncCounter("/requests/resync")
+	game.sendEvent(ControlEventResync{playerId: p.Id})
+}
+
 func (s *Server) handleSse(w http.ResponseWriter, r *http.Request) {
 	s.IncCounter("/requests/sse/incoming")
 	// We expect a cookie to identify the p.
@@ -795,12 +1289,26 @@ func (s *Server) handleSse(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Game %s does not exist", gameId), http.StatusNotFound)
 		return
 	}
-	serverEventChan, err := game.registerPlayer(p)
+	if !game.canAccess(p, r.URL.Query().Get(inviteTokenUrlParam)) {
+		s.IncCounter("/requests/sse/forbidden")
+		http.Error(w, "Private game", http.StatusForbidden)
+		return
+	}
+	serverEventChan, err := game.registerPlayer(p, !game.canTakeSeat(p))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusPreconditionFailed)
 		return
 	}
 	s.IncCounter("/requests/sse/accepted")
+	connected := time.Now()
+	defer func() {
+		s.AddDistribValue("/requests/sse/duration", time.Since(connected).Seconds())
+	}()
+	// Clients can opt into receiving only the changes of the board.
+	var deltas *deltaEncoder
+	if r.URL.Query().Get("delta") == "true" {
+		deltas = &deltaEncoder{}
+	}
 	// Headers to establish server-sent events (SSE) communication.
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-store")
@@ -814,6 +1322,14 @@ func (s *Server) handleSse(w http.ResponseWriter, r *http.Request) {
 					LastEvent: true,
 				}
 			}
+			if deltas != nil {
+				deltas.encode(&ev)
+				if ev.Delta != nil {
+					s.IncCounter("/requests/sse/events/delta")
+				} else if ev.Resync {
+					s.IncCounter("/requests/sse/events/resync")
+				}
+			}
 			// Send ServerEvent JSON on SSE connection.
 			var buf strings.Builder
 			enc := json.NewEncoder(&buf)
@@ -839,12 +1355,39 @@ func (s *Server) handleSse(w http.ResponseWriter, r *http.Request) {
 }
 
 // /hexz/gamez: async request by clients to obtain a list of games to join.
+// Supports the query parameters type, open, host, offset and limit.
 func (s *Server) handleGamez(w http.ResponseWriter, r *http.Request) {
-	gameInfos := s.listRecentGames(5)
-	json, err := json.Marshal(gameInfos)
+	maxLimit := maxLobbyLimit
+	if s.isPeerRequest(r) {
+		// Peers ask for the first offset+limit games to assemble their own page.
+		maxLimit = 0
+	}
+	filter, err := parseGameFilter(r.URL.Query(), maxLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gameInfos, total := s.listGames(filter)
+	if len(s.config.Peers) > 0 && r.Header.Get(forwardedByHeader) == "" {
+		// Include the games of all peers, unless a peer is asking.
+		localGames, localTotal := s.listGames(gameFilter{
+			gameType:  filter.gameType,
+			openSeats: filter.openSeats,
+			host:      filter.host,
+			limit:     filter.offset + filter.limit,
+		})
+		peerGames, peerTotal := s.listPeerGames(filter)
+		gameInfos, total = mergeGamePages(localGames, localTotal, peerGames, peerTotal, filter)
+	}
+	json, err := json.Marshal(GameListResponse{
+		Games:  gameInfos,
+		Total:  total,
+		Offset: filter.offset,
+		Limit:  filter.limit,
+	})
 	if err != nil {
 		http.Error(w, "marshal error", http.StatusInternalServerError)
-		panic("Cannot marshal []GameInfo: " + err.Error())
+		panic("Cannot marshal GameListResponse: " + err.Error())
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(json)
@@ -861,29 +1404,13 @@ func (s *Server) handleGame(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/hexz", http.StatusSeeOther)
 		return
 	}
-	gameHtml, err := s.readFile(gameHtmlFilename)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
-	w.Header().Set("Content-Type", "text/html")
-	// Prolong cookie ttl.
-	http.SetCookie(w, makePlayerCookie(p.Id, s.config.LoginTtl))
-	w.Write(gameHtml)
-}
-
-func (s *Server) handleFile(filepath string, w http.ResponseWriter, r *http.Request) {
-	contentType, ok := validResourceFileExts[path.Ext(filepath)]
-	if !ok {
-		http.Error(w, "", http.StatusNotFound)
+	if !g.canAccess(p, r.URL.Query().Get(inviteTokenUrlParam)) {
+		http.Error(w, "This is a private game. You need an invitation to join.", http.StatusForbidden)
 		return
 	}
-	contents, err := s.readFile(filepath)
-	if err != nil {
-		http.Error(w, "", http.StatusNotFound)
-		return
-	}
-	w.Header().Set("Content-Type", contentType)
-	w.Write(contents)
+	// Prolong cookie ttl.
+	http.SetCookie(w, makePlayerCookie(p.Id, s.live().loginTtl))
+	s.serveResource(w, r, gameHtmlFilename)
 }
 
 func (s *Server) handleStaticResource(w http.ResponseWriter, r *http.Request) {
@@ -892,7 +1419,22 @@ func (s *Server) handleStaticResource(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusNotFound)
 		return
 	}
-	s.handleFile(r.URL.Path[len(hexz):], w, r)
+	s.serveResource(w, r, r.URL.Path[len(hexz):])
+}
+
+func statuszDistribSummary(d *Distribution) StatuszDistribSummary {
+	if d.totalCount == 0 {
+		return StatuszDistribSummary{}
+	}
+	return StatuszDistribSummary{
+		Count: d.totalCount,
+		Mean:  d.Mean(),
+		Min:   d.min,
+		Max:   d.max,
+		P50:   d.Quantile(0.5),
+		P90:   d.Quantile(0.9),
+		P99:   d.Quantile(0.99),
+	}
 }
 
 func (s *Server) handleStatusz(w http.ResponseWriter, r *http.Request) {
@@ -920,19 +1462,30 @@ func (s *Server) handleStatusz(w http.ResponseWriter, r *http.Request) {
 	resp.Counters = counters
 
 	// Distributions. Copy them under the mutex, then prepare JSON structs.
+	now := time.Now()
 	s.distribMut.Lock()
 	distribCopies := make([]*Distribution, len(s.distrib))
+	windowCopies := make([][]*Distribution, len(s.distrib))
 	j := 0
 	for _, d := range s.distrib {
 		distribCopies[j] = d.Copy()
+		windowCopies[j] = d.CopyWindows(now)
 		j++
 	}
 	s.distribMut.Unlock()
 	distribs := make([]*StatuszDistrib, len(s.distrib))
 	for i, d := range distribCopies {
 		distribs[i] = &StatuszDistrib{
-			Name:    d.name,
-			Buckets: []StatuszDistribBucket{},
+			Name:                  d.name,
+			StatuszDistribSummary: statuszDistribSummary(d),
+			Buckets:               []StatuszDistribBucket{},
+			Windows:               make([]StatuszDistribWindow, len(windowCopies[i])),
+		}
+		for j, w := range windowCopies[i] {
+			distribs[i].Windows[j] = StatuszDistribWindow{
+				Window:                distribWindows[j].name,
+				StatuszDistribSummary: statuszDistribSummary(w),
+			}
 		}
 		for j := range d.counts {
 			if d.counts[j] == 0 {
@@ -940,12 +1493,14 @@ func (s *Server) handleStatusz(w http.ResponseWriter, r *http.Request) {
 			}
 			var b StatuszDistribBucket
 			b.Count = d.counts[j]
+			// The first and last buckets are unbounded. Use the observed min and max
+			// instead, since JSON cannot represent infinity.
 			if j == 0 {
-				b.Lower = math.Inf(-1)
+				b.Lower = d.min
 				b.Upper = d.upperBounds[j]
 			} else if j == len(d.counts)-1 {
 				b.Lower = d.upperBounds[j-1]
-				b.Upper = math.Inf(1)
+				b.Upper = d.max
 			} else {
 				b.Lower = d.upperBounds[j-1]
 				b.Upper = d.upperBounds[j]
@@ -977,13 +1532,7 @@ func (s *Server) defaultHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	if isFavicon(r.URL.Path) {
 		s.IncCounter("/requests/favicon")
-		ico, err := s.readFile(path.Join("images", path.Base(r.URL.Path)))
-		if err != nil {
-			http.Error(w, "favicon not found", http.StatusNotFound)
-			return
-		}
-		w.Header().Set("Content-Type", "image/png")
-		w.Write(ico)
+		s.serveResource(w, r, path.Join("images", path.Base(r.URL.Path)))
 		return
 	}
 	s.IncCounter("/requests/other")
@@ -991,7 +1540,11 @@ func (s *Server) defaultHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) loadUserDatabase() {
-	r, err := os.Open(userDatabaseFilename)
+	if s.playerStore != nil {
+		// Players are loaded lazily from the shared store.
+		return
+	}
+	r, err := os.Open(s.config.UserDatabaseFile)
 	if err != nil {
 		if err != os.ErrNotExist {
 			log.Print("Failed to read user database: ", err.Error())
@@ -1016,7 +1569,7 @@ func (s *Server) loadUserDatabase() {
 }
 
 func (s *Server) saveUserDatabase(players []Player) {
-	w, err := os.Create(userDatabaseFilename)
+	w, err := os.Create(s.config.UserDatabaseFile)
 	if err != nil {
 		log.Print("userMaintenance: cannot save user db: ", err.Error())
 		return
@@ -1033,7 +1586,7 @@ func (s *Server) saveUserDatabase(players []Player) {
 func (s *Server) updateLoggedInPlayers() {
 	lastIteration := time.Now()
 	period := time.Duration(5) * time.Minute
-	if s.config.DebugMode {
+	if s.debugMode.Load() {
 		// Clean up active users more frequently in debug mode.
 		period = time.Duration(5) * time.Second
 	}
@@ -1042,7 +1595,7 @@ func (s *Server) updateLoggedInPlayers() {
 		<-t
 		activity := false
 		now := time.Now()
-		logoutThresh := now.Add(-s.config.LoginTtl)
+		logoutThresh := now.Add(-s.live().loginTtl)
 		s.loggedInPlayersMut.Lock()
 		del := []*Player{}
 		for _, p := range s.loggedInPlayers {
@@ -1060,7 +1613,9 @@ func (s *Server) updateLoggedInPlayers() {
 		for _, p := range del {
 			log.Printf("Logged out player %s(%s)", p.Name, p.Id)
 		}
-		if activity || len(del) > 0 {
+		if s.playerStore != nil {
+			s.syncPlayerStore(lastIteration, logoutThresh, del)
+		} else if activity || len(del) > 0 {
 			s.loggedInPlayersMut.Lock()
 			// Create copies of the players to avoid data race during serialization.
 			// (LastActive can get updated at any time by other goroutines.)
@@ -1077,6 +1632,37 @@ func (s *Server) updateLoggedInPlayers() {
 	}
 }
 
+// Writes players who were active since lastSync to the shared player store
+// and removes logged out players from it.
+func (s *Server) syncPlayerStore(lastSync, logoutThresh time.Time, loggedOut []*Player) {
+	s.loggedInPlayersMut.Lock()
+	active := []Player{}
+	for _, p := range s.loggedInPlayers {
+		if p.LastActive.After(lastSync) {
+			active = append(active, *p)
+		}
+	}
+	s.loggedInPlayersMut.Unlock()
+	for i := range active {
+		if err := s.playerStore.Save(&active[i]); err != nil {
+			log.Printf("Cannot save player %s to store: %s", active[i].Id, err)
+		}
+	}
+	for _, p := range loggedOut {
+		// A peer instance might have seen the player more recently than we did.
+		stored, err := s.playerStore.Load(p.Id)
+		if err != nil || stored.LastActive.After(logoutThresh) {
+			continue
+		}
+		if err := s.playerStore.Delete(p.Id); err != nil {
+			log.Printf("Cannot delete player %s from store: %s", p.Id, err)
+		}
+	}
+	if len(active) > 0 || len(loggedOut) > 0 {
+		s.IncCounter("/storage/playerstore/synced")
+	}
+}
+
 func (s *Server) loggingHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// t := time.Now().Format("2006-01-02 15:04:05.999Z07:00")
@@ -1112,7 +1698,7 @@ func (s *Server) basicAuthHandlerFunc(h http.HandlerFunc) http.HandlerFunc {
 				h(w, r)
 				return
 			}
-			if s.config.AuthTokenSha256 == "" {
+			if s.live().authTokenSha256 == "" {
 				// No auth token: only local access is allowed.
 				s.IncCounter("/auth/rejected/nonlocal")
 				http.Error(w, "Forbidden", http.StatusForbidden)
@@ -1123,7 +1709,7 @@ func (s *Server) basicAuthHandlerFunc(h http.HandlerFunc) http.HandlerFunc {
 			rejected := true
 			if !ok {
 				s.IncCounter("/auth/rejected/missing_token")
-			} else if passSha256 != s.config.AuthTokenSha256 {
+			} else if passSha256 != s.live().authTokenSha256 {
 				s.IncCounter("/auth/rejected/bad_passwd")
 			} else {
 				rejected = false
@@ -1138,41 +1724,105 @@ func (s *Server) basicAuthHandlerFunc(h http.HandlerFunc) http.HandlerFunc {
 		})
 }
 
+// Returns the handler serving all of the server's endpoints.
+func (s *Server) createHandler() http.Handler {
+	mux := &http.ServeMux{}
+	handle := func(route, pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, s.metricsHandler(route, h))
+	}
+	handle("move", "/hexz/move/", s.handleMove)
+	handle("reset", "/hexz/reset/", s.handleReset)
+	handle("sse", "/hexz/sse/", s.handleSse)
+	handle("resync", "/hexz/resync/", s.handleResync)
+	handle("login", "/hexz/login", s.handleLoginRequest)
+	handle("rules", "/hexz/rules", func(w http.ResponseWriter, r *http.Request) {
+		s.serveResource(w, r, rulesHtmlFilename)
+	})
+	handle("images", "/hexz/images/", s.handleStaticResource)
+	handle("hexz", "/hexz", s.handleHexz)
+	handle("new", "/hexz/new", s.handleNewGame)
+	handle("gamez", "/hexz/gamez", s.handleGamez)
+	handle("analyze", "/hexz/analyze", s.handleAnalyze)
+	handle("gametypes", "/hexz/gametypes", s.handleGameTypes)
+	handle("levels", "/hexz/levels", s.handleLevels)
+	handle("levels_validate", "/hexz/levels/validate", s.handleValidateLevel)
+	handle("level_export", "/hexz/level/", s.handleExportLevel)
+	boardImage := s.metricsHandler("board_image", s.handleBoardImage)
+	game := s.metricsHandler("game", s.handleGame)
+	mux.HandleFunc("/hexz/", func(w http.ResponseWriter, r *http.Request) {
+		if isBoardImagePath(r.URL.Path) {
+			boardImage.ServeHTTP(w, r)
+			return
+		}
+		game.ServeHTTP(w, r)
+	})
+	handle("statusz", "/statusz", s.basicAuthHandlerFunc(s.handleStatusz))
+	handle("admin_games", "/admin/games", s.basicAuthHandlerFunc(s.handleAdminGames))
+	handle("admin_game", "/admin/game/", s.basicAuthHandlerFunc(s.handleAdminGame))
+	handle("admin_terminate", "/admin/terminate/", s.basicAuthHandlerFunc(s.handleAdminTerminate))
+	handle("admin_kick", "/admin/kick/", s.basicAuthHandlerFunc(s.handleAdminKick))
+	handle("admin_logout", "/admin/logout/", s.basicAuthHandlerFunc(s.handleAdminKick))
+	handle("admin_announce", "/admin/announce", s.basicAuthHandlerFunc(s.handleAdminAnnounce))
+	handle("admin_debug", "/admin/debug", s.basicAuthHandlerFunc(s.handleAdminDebug))
+	handle("default", "/", s.defaultHandler)
+	return s.loggingHandler(s.routingHandler(mux))
+}
+
 func (s *Server) Serve() {
 	addr := fmt.Sprintf("%s:%d", s.config.ServerAddress, s.config.ServerPort)
-	mux := &http.ServeMux{}
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: s.loggingHandler(mux),
+		Handler: s.createHandler(),
 	}
+	s.httpServer.Store(srv)
 
 	// Quick sanity check that we have access to the game HTML file.
-	if _, err := s.readFile(gameHtmlFilename); err != nil {
+	if _, err := s.resource(gameHtmlFilename); err != nil {
 		log.Fatal("Cannot load game HTML: ", err)
 	}
-	mux.HandleFunc("/hexz/move/", s.handleMove)
-	mux.HandleFunc("/hexz/reset/", s.handleReset)
-	mux.HandleFunc("/hexz/sse/", s.handleSse)
-	mux.HandleFunc("/hexz/login", s.handleLoginRequest)
-	mux.HandleFunc("/hexz/rules", func(w http.ResponseWriter, r *http.Request) {
-		s.handleFile(rulesHtmlFilename, w, r)
-	})
-	mux.HandleFunc("/hexz/images/", s.handleStaticResource)
-	mux.HandleFunc("/hexz", s.handleHexz)
-	mux.HandleFunc("/hexz/new", s.handleNewGame)
-	mux.HandleFunc("/hexz/gamez", s.handleGamez)
-	mux.HandleFunc("/hexz/", s.handleGame)
-	mux.Handle("/statusz", s.basicAuthHandlerFunc(s.handleStatusz))
-	mux.HandleFunc("/", s.defaultHandler)
-
+	if s.config.InstanceId != "" {
+		log.Printf("Running as instance %s with %d peers", s.config.InstanceId, len(s.config.Peers))
+	}
 	log.Printf("Listening on %s", addr)
 
 	s.loadUserDatabase()
 	// Start login GC routine
 	go s.updateLoggedInPlayers()
 
+	var err error
 	if s.config.TlsCertChain != "" && s.config.TlsPrivKey != "" {
-		log.Fatal(srv.ListenAndServeTLS(s.config.TlsCertChain, s.config.TlsPrivKey))
+		if err := s.loadTlsCert(s.config); err != nil {
+			log.Fatal("Cannot load TLS certificate: ", err)
+		}
+		// Look up the certificate on each handshake, so it can be reloaded.
+		srv.TLSConfig = &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return s.tlsCert.Load(), nil
+			},
+		}
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
 	}
-	log.Fatal(srv.ListenAndServe())
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// Stops serving requests, waiting for active ones until ctx is done, and closes the server.
+// Serve returns as soon as Shutdown is called, but Shutdown only returns once it is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if srv := s.httpServer.Load(); srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Closes the game event log. Events of games still running afterwards are not logged.
+func (s *Server) Close() error {
+	return s.eventSink.Close()
 }
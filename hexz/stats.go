@@ -5,6 +5,7 @@ import (
 	"math"
 	"sort"
 	"sync"
+	"time"
 )
 
 type Counter struct {
@@ -24,7 +25,39 @@ type Distribution struct {
 	sum         float64
 	min         float64
 	max         float64
-	mut         sync.Mutex
+	// Rolling windows, in the same order as distribWindows.
+	// nil for copies of a Distribution.
+	windows []*distribWindow
+	mut     sync.Mutex
+}
+
+// Rolling time windows maintained by each Distribution. Each window is a ring buffer
+// of numSlots slots that hold the values added during slotDuration. Older slots
+// are overwritten, so a window covers between numSlots-1 and numSlots slot durations.
+var distribWindows = []struct {
+	name         string
+	slotDuration time.Duration
+	numSlots     int
+}{
+	{"1m", 10 * time.Second, 6},
+	{"10m", time.Minute, 10},
+	{"1h", 5 * time.Minute, 12},
+}
+
+// Ring buffer of bucket snapshots for one rolling window.
+type distribWindow struct {
+	slotDuration time.Duration
+	slots        []distribSlot
+}
+
+// Bucket counts of the values added during [start, start+slotDuration).
+type distribSlot struct {
+	start      time.Time // Zero if the slot was never used.
+	counts     []int64
+	totalCount int64
+	sum        float64
+	min        float64
+	max        float64
 }
 
 func NewCounter(name string) *Counter {
@@ -61,12 +94,21 @@ func NewDistribution(name string, upperBounds []float64) (*Distribution, error)
 		}
 	}
 	counts := make([]int64, len(copiedBounds)+1)
+	windows := make([]*distribWindow, len(distribWindows))
+	for i, w := range distribWindows {
+		slots := make([]distribSlot, w.numSlots)
+		for j := range slots {
+			slots[j].counts = make([]int64, len(counts))
+		}
+		windows[i] = &distribWindow{slotDuration: w.slotDuration, slots: slots}
+	}
 	return &Distribution{
 		name:        name,
 		upperBounds: copiedBounds,
 		counts:      counts,
 		min:         math.Inf(1),
 		max:         math.Inf(-1),
+		windows:     windows,
 	}, nil
 }
 
@@ -85,6 +127,10 @@ func DistribRange(low, high, factor float64) []float64 {
 }
 
 func (d *Distribution) Add(value float64) {
+	d.addAt(value, time.Now())
+}
+
+func (d *Distribution) addAt(value float64, now time.Time) {
 	d.mut.Lock()
 	defer d.mut.Unlock()
 	ix := sort.Search(len(d.upperBounds), func(i int) bool { return d.upperBounds[i] > value })
@@ -97,6 +143,74 @@ func (d *Distribution) Add(value float64) {
 	if value > d.max {
 		d.max = value
 	}
+	for _, w := range d.windows {
+		s := w.slotAt(now)
+		s.counts[ix]++
+		s.totalCount++
+		s.sum += value
+		if value < s.min {
+			s.min = value
+		}
+		if value > s.max {
+			s.max = value
+		}
+	}
+}
+
+// Returns the slot for time t, resetting it if it still holds older values.
+func (w *distribWindow) slotAt(t time.Time) *distribSlot {
+	start := t.Truncate(w.slotDuration)
+	s := &w.slots[int(start.UnixNano()/int64(w.slotDuration))%len(w.slots)]
+	if !s.start.Equal(start) {
+		s.start = start
+		for i := range s.counts {
+			s.counts[i] = 0
+		}
+		s.totalCount = 0
+		s.sum = 0
+		s.min = math.Inf(1)
+		s.max = math.Inf(-1)
+	}
+	return s
+}
+
+// Returns the arithmetic mean of all values, or 0 if the distribution is empty.
+func (d *Distribution) Mean() float64 {
+	if d.totalCount == 0 {
+		return 0
+	}
+	return d.sum / float64(d.totalCount)
+}
+
+// Estimates the q-quantile (0 < q <= 1) of the distribution's values by linear
+// interpolation inside the bucket containing it. Bucket bounds are clamped to
+// the observed min and max, so the estimate never leaves the range of added values.
+// Returns 0 if the distribution is empty.
+func (d *Distribution) Quantile(q float64) float64 {
+	if d.totalCount == 0 {
+		return 0
+	}
+	rank := q * float64(d.totalCount)
+	var cum int64
+	for i, c := range d.counts {
+		if c == 0 || float64(cum+c) < rank {
+			cum += c
+			continue
+		}
+		lower, upper := d.min, d.max
+		if i > 0 && d.upperBounds[i-1] > lower {
+			lower = d.upperBounds[i-1]
+		}
+		if i < len(d.upperBounds) && d.upperBounds[i] < upper {
+			upper = d.upperBounds[i]
+		}
+		frac := (rank - float64(cum)) / float64(c)
+		if frac < 0 {
+			frac = 0
+		}
+		return lower + frac*(upper-lower)
+	}
+	return d.max
 }
 
 // For now, instead of providing synchronized access to all individual fields,
@@ -118,3 +232,43 @@ func (d *Distribution) Copy() *Distribution {
 		max:         d.max,
 	}
 }
+
+// Returns copies of d that only contain the values added during each of the
+// rolling windows ending at now, in the order of distribWindows.
+func (d *Distribution) CopyWindows(now time.Time) []*Distribution {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	result := make([]*Distribution, len(d.windows))
+	for i, w := range d.windows {
+		upperBounds := make([]float64, len(d.upperBounds))
+		copy(upperBounds, d.upperBounds)
+		c := &Distribution{
+			name:        d.name,
+			counts:      make([]int64, len(d.counts)),
+			upperBounds: upperBounds,
+			min:         math.Inf(1),
+			max:         math.Inf(-1),
+		}
+		// Slots that started before this are outside the window.
+		oldest := now.Truncate(w.slotDuration).Add(-time.Duration(len(w.slots)-1) * w.slotDuration)
+		for j := range w.slots {
+			s := &w.slots[j]
+			if s.start.IsZero() || s.start.Before(oldest) || s.start.After(now) {
+				continue
+			}
+			for k, n := range s.counts {
+				c.counts[k] += n
+			}
+			c.totalCount += s.totalCount
+			c.sum += s.sum
+			if s.min < c.min {
+				c.min = s.min
+			}
+			if s.max > c.max {
+				c.max = s.max
+			}
+		}
+		result[i] = c
+	}
+	return result
+}
@@ -1,7 +1,9 @@
 package hexz
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -69,3 +71,82 @@ func TestDistribution(t *testing.T) {
 		t.Errorf("want sum: %v, got %v", 9, d.sum)
 	}
 }
+
+func TestDistributionQuantiles(t *testing.T) {
+	d, err := NewDistribution("test", DistribRange(1, 1000, 1.1))
+	if err != nil {
+		t.Fatalf("Failed to create distribution: %s", err.Error())
+	}
+	for i := 1; i <= 1000; i++ {
+		d.Add(float64(i))
+	}
+	if got := d.Mean(); got != 500.5 {
+		t.Errorf("want mean 500.5, got %v", got)
+	}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0.5, 500},
+		{0.9, 900},
+		{0.99, 990},
+		{1, 1000},
+	}
+	for _, test := range tests {
+		// Buckets grow by 10%, so estimates must be within 10% of the true value.
+		if got := d.Quantile(test.q); math.Abs(got-test.want) > 0.1*test.want {
+			t.Errorf("q=%v: want ~%v, got %v", test.q, test.want, got)
+		}
+	}
+	// A single value is estimated exactly, even in the underflow and overflow buckets.
+	for _, v := range []float64{-3, 42, 5000} {
+		d, _ := NewDistribution("test", []float64{1, 10, 100})
+		d.Add(v)
+		if got := d.Quantile(0.5); got != v {
+			t.Errorf("want median %v, got %v", v, got)
+		}
+	}
+}
+
+func TestDistributionWindows(t *testing.T) {
+	d, err := NewDistribution("test", []float64{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Failed to create distribution: %s", err.Error())
+	}
+	start := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	d.addAt(1, start)
+	d.addAt(2, start.Add(30*time.Minute))
+	d.addAt(3, start.Add(59*time.Minute))
+	d.addAt(4, start.Add(59*time.Minute+30*time.Second))
+	now := start.Add(59*time.Minute + 45*time.Second)
+	ws := d.CopyWindows(now)
+	if len(ws) != len(distribWindows) {
+		t.Fatalf("want %d windows, got %d", len(distribWindows), len(ws))
+	}
+	wantCounts := map[string]int64{"1m": 2, "10m": 2, "1h": 4}
+	for i, w := range ws {
+		name := distribWindows[i].name
+		if w.totalCount != wantCounts[name] {
+			t.Errorf("%s: want %d values, got %d", name, wantCounts[name], w.totalCount)
+		}
+	}
+	if ws[0].min != 3 || ws[0].max != 4 || ws[0].sum != 7 {
+		t.Errorf("1m: want min/max/sum 3/4/7, got %v/%v/%v", ws[0].min, ws[0].max, ws[0].sum)
+	}
+	// Old values leave the windows, but stay in the cumulative distribution.
+	ws = d.CopyWindows(start.Add(3 * time.Hour))
+	for i, w := range ws {
+		if w.totalCount != 0 {
+			t.Errorf("%s: want no values, got %d", distribWindows[i].name, w.totalCount)
+		}
+	}
+	if c := d.Copy(); c.totalCount != 4 {
+		t.Errorf("want 4 values in total, got %d", c.totalCount)
+	}
+	// Slots are reused when the ring buffer wraps around.
+	d.addAt(5, start.Add(2*time.Hour))
+	ws = d.CopyWindows(start.Add(2 * time.Hour))
+	if ws[2].totalCount != 1 || ws[2].max != 5 {
+		t.Errorf("1h: want only the new value, got %d values, max %v", ws[2].totalCount, ws[2].max)
+	}
+}